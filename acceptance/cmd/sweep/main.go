@@ -0,0 +1,71 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// sweep lists the helm releases, namespaces and COSI classes left behind by
+// interrupted acceptance runs, and deletes them when run with -delete.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aquarist-labs/s3gw/acceptance/helpers"
+)
+
+func main() {
+	var (
+		target helpers.ClusterTarget
+		opts   helpers.SweepOptions
+		del    bool
+	)
+	// ginkgo, imported by the helpers, registers its flags on the default flag set
+	flags := flag.NewFlagSet("sweep", flag.ExitOnError)
+	flags.StringVar(&target.Kubeconfig, "kubeconfig", "", "kubeconfig of the cluster, the ambient one if empty")
+	flags.StringVar(&target.Context, "context", "", "context of the cluster, the current one if empty")
+	flags.DurationVar(&opts.MinAge, "min-age", time.Hour, "spare the resources younger than this, which may belong to a running suite")
+	flags.BoolVar(&del, "delete", false, "delete the orphans instead of listing them")
+	_ = flags.Parse(os.Args[1:])
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	ctx = helpers.WithClusterTarget(ctx, target)
+
+	orphans, err := helpers.FindOrphans(ctx, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sweep: %v\n", err)
+		os.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAMESPACE\tNAME\tAGE\tREASON")
+	for _, o := range orphans {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", o.Kind, o.Namespace, o.Name, o.Age.Round(time.Second), o.Reason)
+	}
+	w.Flush()
+
+	if !del {
+		if len(orphans) > 0 {
+			fmt.Printf("\n%d orphans found, run with -delete to delete them\n", len(orphans))
+		}
+		return
+	}
+
+	if err := helpers.DeleteOrphans(ctx, orphans); err != nil {
+		fmt.Fprintf(os.Stderr, "sweep: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("\n%d orphans deleted\n", len(orphans))
+}
@@ -0,0 +1,97 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// upgrade-matrix runs the upgrade suite for every forward pair of a list of
+// versions and prints the result of each pair as a JSON line.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/aquarist-labs/s3gw/acceptance/helpers"
+	"github.com/pkg/errors"
+)
+
+func main() {
+	var (
+		opts         helpers.UpgradeMatrixOptions
+		versionsSpec string
+		incompatible string
+		ginkgoArgs   string
+		table        string
+	)
+	// the helpers register the ginkgo flags on the default flag set
+	flags := flag.NewFlagSet("upgrade-matrix", flag.ExitOnError)
+	flags.StringVar(&versionsSpec, "versions", "", "comma separated versions in release order, each chart version optionally followed by :image-tag")
+	flags.StringVar(&incompatible, "incompatible", "", "comma separated pairs not to run, e.g. 0.14.0_0.17.0")
+	flags.StringVar(&opts.Dir, "suite", "acceptance/upgrade", "directory of the upgrade suite")
+	flags.StringVar(&opts.ReportDir, "report-dir", "upgrade-matrix", "directory of the ginkgo reports of the pairs")
+	flags.StringVar(&ginkgoArgs, "ginkgo-args", "", "extra ginkgo arguments, split like a shell, a label filter is combined with the one excluding the chain specs")
+	flags.IntVar(&opts.Parallel, "parallel", 2, "number of pairs tested at once")
+	flags.DurationVar(&opts.Timeout, "timeout", time.Hour, "timeout of the run of a pair")
+	flags.StringVar(&table, "table", "", "write the markdown table of the results to this file")
+	_ = flags.Parse(os.Args[1:])
+
+	versions, err := helpers.ParseUpgradeChain(versionsSpec)
+	if err == nil && versions == nil {
+		err = errors.New("-versions is required")
+	}
+	if err != nil {
+		fail(err)
+	}
+	if opts.GinkgoArgs, err = helpers.SplitShellWords(ginkgoArgs); err != nil {
+		fail(err)
+	}
+	opts.Incompatible = map[string]bool{}
+	for _, name := range strings.Split(incompatible, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			opts.Incompatible[name] = true
+		}
+	}
+	if err := os.MkdirAll(opts.ReportDir, 0o755); err != nil {
+		fail(err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	enc := json.NewEncoder(os.Stdout)
+	opts.OnResult = func(r helpers.UpgradeResult) {
+		_ = enc.Encode(r)
+	}
+	results, err := helpers.RunUpgradeMatrix(ctx, opts, helpers.UpgradePairs(versions))
+	if err != nil {
+		fail(err)
+	}
+
+	if table != "" {
+		if err := os.WriteFile(table, []byte(helpers.UpgradeMatrixTable(versions, results)), 0o644); err != nil {
+			fail(err)
+		}
+	}
+	for _, r := range results {
+		if r.Status == helpers.UpgradeFailed {
+			os.Exit(1)
+		}
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "upgrade-matrix: %v\n", err)
+	os.Exit(2)
+}
@@ -3,11 +3,17 @@ package cosi_test
 import (
 	"testing"
 
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
 
 func TestCosi(t *testing.T) {
 	RegisterFailHandler(Fail)
+	DefaultRetryPolicy = &IdempotentRetryPolicy
 	RunSpecs(t, "Cosi Suite")
 }
+
+var _ = SynchronizedAfterSuite(func() {}, func(ctx SpecContext) {
+	ReportLeakedNamespaces(ctx)
+})
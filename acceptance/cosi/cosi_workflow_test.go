@@ -14,11 +14,11 @@ package cosi
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"os"
-	"strings"
+	"time"
 
 	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	"github.com/aquarist-labs/s3gw/acceptance/helpers/helm"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -54,187 +54,195 @@ spec:
 `
 
 var _ = Describe("COSI workflow - single instance", Label("COSI"), func() {
-	var suiteProperties map[string]interface{}
+	var suiteProperties *SuiteProperties
 	chartsRoot := "charts/charts/s3gw"
-	namespace := NanoSecName("s3gw-cosi-wf")
-	releaseName := NanoSecName("s3gw-cosi-wf")
-	driverName := releaseName + "." + namespace + ".objectstorage.k8s.io"
-
-	BeforeEach(func() {
-		if suitePropertiesF, err := os.Open("../suiteProperties.json"); err == nil {
-			defer suitePropertiesF.Close()
-			byteValue, _ := io.ReadAll(suitePropertiesF)
-			err = json.Unmarshal([]byte(byteValue), &suiteProperties)
-			Expect(err).ToNot(HaveOccurred())
-		} else {
-			//make this fail
-			Expect(err).ToNot(HaveOccurred())
-			Expect(suiteProperties).ToNot(BeNil())
-		}
-		args := []string{"install", "--create-namespace", "-n", namespace,
-			"--set", "publicDomain=" + suiteProperties["S3GW_SYSTEM_DOMAIN"].(string),
-			"--set", "ui.publicDomain=" + suiteProperties["S3GW_SYSTEM_DOMAIN"].(string),
-			"--set", "imageTag=v" + suiteProperties["IMAGE_TAG"].(string),
-			"--set", "ui.imageTag=v" + suiteProperties["IMAGE_TAG"].(string),
-			"--set", "cosi.driver.imageTag=v" + suiteProperties["IMAGE_TAG"].(string),
-			"--set", "cosi.sidecar.imageTag=v" + suiteProperties["IMAGE_TAG"].(string),
-			"--set", "cosi.enabled=true",
-			releaseName, chartsRoot, "--wait"}
-
-		if extraArgs := suiteProperties["CHARTS_EXTRA_ARGS"].(string); len(extraArgs) > 0 {
-			out, err := Run("../..", true, "helm", append(args, strings.Split(extraArgs, " ")...)...)
-			Expect(err).ToNot(HaveOccurred(), out)
-		} else {
-			out, err := Run("../..", true, "helm", args...)
-			Expect(err).ToNot(HaveOccurred(), out)
-		}
-	})
-
-	AfterEach(func() {
-		out, err := Run("../..", true, "helm", "uninstall", "-n", namespace, releaseName, "--wait")
-		Expect(err).ToNot(HaveOccurred(), out)
-	})
-
-	When("specifying deletionPolicy:Delete in BucketClass", func() {
-		bucketClassName := "bucket-class-delete"
-		deletionPolicy := "Delete"
-
-		BeforeEach(func() {
-			BucketClassFileName := NanoSecName("BucketClass") + ".yaml"
-			if BucketClassFile, err := os.Create(BucketClassFileName); err != nil {
-				//make this fail
-				Expect(err).ToNot(HaveOccurred())
-			} else {
-				defer os.Remove(BucketClassFileName)
-				if _, err := fmt.Fprintf(BucketClassFile, bucketClassFMT,
-					bucketClassName,
-					driverName,
-					deletionPolicy); err != nil {
-					//make this fail
-					Expect(err).ToNot(HaveOccurred())
-				} else {
-					out, err := Kubectl("apply", "-f", BucketClassFileName)
-					Expect(err).ToNot(HaveOccurred(), out)
 
-					By("checking BucketClass", func() {
-						out, err = Kubectl("get", "bucketclass", bucketClassName, "-ojson")
-						Expect(err).ToNot(HaveOccurred(), out)
+	for _, target := range SuiteClusterTargets() {
+		target := target
 
-						var dJson map[string]interface{}
-						err = json.Unmarshal([]byte(out), &dJson)
-						Expect(err).ToNot(HaveOccurred())
-						Expect(dJson).ToNot(BeNil())
-
-						Expect(dJson["deletionPolicy"].(string)).To(Equal(deletionPolicy))
-						Expect(dJson["metadata"].(map[string]interface{})["name"].(string)).To(Equal(bucketClassName))
-					})
-				}
-			}
-		})
+		Context("on cluster "+target.Name, func() {
+			BeforeEach(func() {
+				UseClusterTarget(target)
+			})
 
-		AfterEach(func() {
-			out, err := Kubectl("delete", "bucketclass", bucketClassName)
-			Expect(err).ToNot(HaveOccurred(), out)
-		})
+			namespace := UniqueName("s3gw-wf")
+			releaseName := UniqueName("s3gw-wf")
+			driverName := releaseName + "." + namespace + ".objectstorage.k8s.io"
 
-		When("specifying authenticationType:KEY in BucketAccessClass", func() {
-			bucketAccessClassName := "bucket-access-class-key"
-			authenticationType := "KEY"
+			BeforeEach(func(ctx SpecContext) {
+				UseSpecCassette()
+				AuditSpecCommands()
 
-			BeforeEach(func() {
-				BucketAccessClassFileName := NanoSecName("BucketAccessClass") + ".yaml"
-				if BucketAccessClassFile, err := os.Create(BucketAccessClassFileName); err != nil {
-					//make this fail
-					Expect(err).ToNot(HaveOccurred())
-				} else {
-					defer os.Remove(BucketAccessClassFileName)
-					if _, err := fmt.Fprintf(BucketAccessClassFile, bucketAccessClassFMT,
-						bucketAccessClassName,
-						driverName,
-						authenticationType); err != nil {
-						//make this fail
-						Expect(err).ToNot(HaveOccurred())
-					} else {
-						out, err := Kubectl("apply", "-f", BucketAccessClassFileName)
-						Expect(err).ToNot(HaveOccurred(), out)
+				var err error
+				suiteProperties, err = LoadSuiteProperties(SuitePropertiesFile)
+				Expect(err).ToNot(HaveOccurred())
 
-						By("checking BucketAccessClass", func() {
-							out, err = Kubectl("get", "bucketaccessclass", bucketAccessClassName, "-ojson")
-							Expect(err).ToNot(HaveOccurred(), out)
+				Expect(CheckChartNames(releaseName, namespace)).To(Succeed())
+				TestNamespace(ctx, namespace)
+
+				values := helm.Values{
+					PublicDomain: suiteProperties.S3GWSystemDomain,
+					ImageTag:     "v" + suiteProperties.ImageTag,
+					UI: helm.UIValues{
+						PublicDomain: suiteProperties.S3GWSystemDomain,
+						ImageTag:     "v" + suiteProperties.ImageTag,
+					},
+					Cosi: helm.CosiValues{
+						Enabled: helm.Bool(true),
+						Driver:  helm.ImageValues{ImageTag: "v" + suiteProperties.ImageTag},
+						Sidecar: helm.ImageValues{ImageTag: "v" + suiteProperties.ImageTag},
+					},
+				}
+				Expect(values.ParseExtraArgs(suiteProperties.ChartsExtraArgs)).To(Succeed())
 
-							var dJson map[string]interface{}
-							err = json.Unmarshal([]byte(out), &dJson)
-							Expect(err).ToNot(HaveOccurred())
-							Expect(dJson).ToNot(BeNil())
+				client, err := helm.New(ctx, namespace)
+				Expect(err).ToNot(HaveOccurred())
+				client.Dir = "../.."
 
-							Expect(dJson["authenticationType"].(string)).To(Equal(authenticationType))
-							Expect(dJson["metadata"].(map[string]interface{})["name"].(string)).To(Equal(bucketAccessClassName))
-						})
-					}
-				}
+				_, err = client.Install(ctx, releaseName, chartsRoot, values, helm.WithWait())
+				Expect(err).ToNot(HaveOccurred())
+				DeferCleanup(func(ctx SpecContext) {
+					Expect(client.Uninstall(ctx, releaseName, helm.WithWait())).To(Succeed())
+				})
 			})
 
-			AfterEach(func() {
-				out, err := Kubectl("delete", "bucketaccessclass", bucketAccessClassName)
-				Expect(err).ToNot(HaveOccurred(), out)
+			JustAfterEach(func(ctx SpecContext) {
+				CollectDiagnosticsOnFailure(ctx, namespace)
 			})
 
-			When("creating a BucketClaim", func() {
-				bucketClaimName := "bucket-claim-0"
+			When("specifying deletionPolicy:Delete in BucketClass", func() {
+				bucketClassName := "bucket-class-delete"
+				deletionPolicy := "Delete"
 
-				BeforeEach(func() {
-					BucketClaimFileName := NanoSecName("BucketClaim") + ".yaml"
-					if BucketClaimFile, err := os.Create(BucketClaimFileName); err != nil {
+				BeforeEach(func(ctx SpecContext) {
+					BucketClassFileName := UniqueName("bucketclass") + ".yaml"
+					if BucketClassFile, err := os.Create(BucketClassFileName); err != nil {
 						//make this fail
 						Expect(err).ToNot(HaveOccurred())
 					} else {
-						defer os.Remove(BucketClaimFileName)
-						if _, err := fmt.Fprintf(BucketClaimFile, bucketClaimFMT,
-							namespace,
-							bucketClaimName,
-							bucketClassName); err != nil {
+						defer os.Remove(BucketClassFileName)
+						if _, err := fmt.Fprintf(BucketClassFile, bucketClassFMT,
+							bucketClassName,
+							driverName,
+							deletionPolicy); err != nil {
 							//make this fail
 							Expect(err).ToNot(HaveOccurred())
 						} else {
-							out, err := Kubectl("apply", "-f", BucketClaimFileName)
+							out, err := KubectlContext(ctx, "apply", "-f", BucketClassFileName)
 							Expect(err).ToNot(HaveOccurred(), out)
 
-							Eventually(func() bool {
-								out, err = Kubectl("get", "bucketclaim", "-n", namespace, bucketClaimName, "-ojson")
-								Expect(err).ToNot(HaveOccurred(), out)
+							By("checking BucketClass", func() {
+								res, err := KubectlResult(ctx, "get", "bucketclass", bucketClassName, "-ojson")
+								Expect(err).ToNot(HaveOccurred(), res.Stderr)
 
 								var dJson map[string]interface{}
-								err = json.Unmarshal([]byte(out), &dJson)
+								err = json.Unmarshal([]byte(res.Stdout), &dJson)
 								Expect(err).ToNot(HaveOccurred())
 								Expect(dJson).ToNot(BeNil())
 
-								return dJson["status"].(map[string]interface{})["bucketReady"].(bool)
-							}, "1m").Should(Equal(true))
+								Expect(dJson).To(HaveJSONPath("deletionPolicy", Equal(deletionPolicy)))
+								Expect(dJson).To(HaveJSONPath("metadata.name", Equal(bucketClassName)))
+							})
 						}
 					}
 				})
 
-				AfterEach(func() {
-					out, err := Kubectl("delete", "bucketclaim", "-n", namespace, bucketClaimName)
+				AfterEach(func(ctx SpecContext) {
+					out, err := KubectlContext(ctx, "delete", "bucketclass", bucketClassName)
 					Expect(err).ToNot(HaveOccurred(), out)
 				})
 
-				It("deploys expected resources", func() {
-					By("getting the s3gw deployment", func() {
-						out, err := Kubectl("get", "deployments",
-							"-n", namespace,
-							releaseName,
-							"-ojson")
-						Expect(err).ToNot(HaveOccurred())
+				When("specifying authenticationType:KEY in BucketAccessClass", func() {
+					bucketAccessClassName := "bucket-access-class-key"
+					authenticationType := "KEY"
 
-						var dJson map[string]interface{}
-						err = json.Unmarshal([]byte(out), &dJson)
-						Expect(err).ToNot(HaveOccurred())
-						Expect(dJson).ToNot(BeNil())
+					BeforeEach(func(ctx SpecContext) {
+						BucketAccessClassFileName := UniqueName("bucketaccessclass") + ".yaml"
+						if BucketAccessClassFile, err := os.Create(BucketAccessClassFileName); err != nil {
+							//make this fail
+							Expect(err).ToNot(HaveOccurred())
+						} else {
+							defer os.Remove(BucketAccessClassFileName)
+							if _, err := fmt.Fprintf(BucketAccessClassFile, bucketAccessClassFMT,
+								bucketAccessClassName,
+								driverName,
+								authenticationType); err != nil {
+								//make this fail
+								Expect(err).ToNot(HaveOccurred())
+							} else {
+								out, err := KubectlContext(ctx, "apply", "-f", BucketAccessClassFileName)
+								Expect(err).ToNot(HaveOccurred(), out)
+
+								By("checking BucketAccessClass", func() {
+									res, err := KubectlResult(ctx, "get", "bucketaccessclass", bucketAccessClassName, "-ojson")
+									Expect(err).ToNot(HaveOccurred(), res.Stderr)
+
+									var dJson map[string]interface{}
+									err = json.Unmarshal([]byte(res.Stdout), &dJson)
+									Expect(err).ToNot(HaveOccurred())
+									Expect(dJson).ToNot(BeNil())
+
+									Expect(dJson).To(HaveJSONPath("authenticationType", Equal(authenticationType)))
+									Expect(dJson).To(HaveJSONPath("metadata.name", Equal(bucketAccessClassName)))
+								})
+							}
+						}
+					})
+
+					AfterEach(func(ctx SpecContext) {
+						out, err := KubectlContext(ctx, "delete", "bucketaccessclass", bucketAccessClassName)
+						Expect(err).ToNot(HaveOccurred(), out)
+					})
 
+					When("creating a BucketClaim", func() {
+						bucketClaimName := "bucket-claim-0"
+
+						BeforeEach(func(ctx SpecContext) {
+							BucketClaimFileName := UniqueName("bucketclaim") + ".yaml"
+							if BucketClaimFile, err := os.Create(BucketClaimFileName); err != nil {
+								//make this fail
+								Expect(err).ToNot(HaveOccurred())
+							} else {
+								defer os.Remove(BucketClaimFileName)
+								if _, err := fmt.Fprintf(BucketClaimFile, bucketClaimFMT,
+									namespace,
+									bucketClaimName,
+									bucketClassName); err != nil {
+									//make this fail
+									Expect(err).ToNot(HaveOccurred())
+								} else {
+									out, err := KubectlContext(ctx, "apply", "-f", BucketClaimFileName)
+									Expect(err).ToNot(HaveOccurred(), out)
+
+									WaitForJSONPath(ctx, namespace, "bucketclaim", bucketClaimName, "status.bucketReady", BeTrue(),
+										WithWaitTimeout(time.Minute))
+								}
+							}
+						})
+
+						AfterEach(func(ctx SpecContext) {
+							out, err := KubectlContext(ctx, "delete", "bucketclaim", "-n", namespace, bucketClaimName)
+							Expect(err).ToNot(HaveOccurred(), out)
+						})
+
+						It("deploys expected resources", func(ctx SpecContext) {
+							By("getting the s3gw deployment", func() {
+								res, err := KubectlResult(ctx, "get", "deployments",
+									"-n", namespace,
+									releaseName,
+									"-ojson")
+								Expect(err).ToNot(HaveOccurred(), res.Stderr)
+
+								var dJson map[string]interface{}
+								err = json.Unmarshal([]byte(res.Stdout), &dJson)
+								Expect(err).ToNot(HaveOccurred())
+								Expect(dJson).ToNot(BeNil())
+
+							})
+						})
 					})
 				})
 			})
 		})
-	})
+	}
 })
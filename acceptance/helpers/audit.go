@@ -0,0 +1,131 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+)
+
+// AuditReportEntry is the name of the report entry holding the commands
+// executed during a spec.
+const AuditReportEntry = "commands"
+
+// MaxAuditOutput is the number of trailing bytes of output kept for every
+// audited command.
+var MaxAuditOutput = 4096
+
+// AuditEntry describes a command executed during a spec.
+type AuditEntry struct {
+	Time     time.Time     `json:"time"`
+	Command  string        `json:"command"`
+	Args     []string      `json:"args"`
+	Dir      string        `json:"dir,omitempty"`
+	Duration time.Duration `json:"duration"`
+	ExitCode int           `json:"exitCode"`
+	Output   string        `json:"output,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// AuditEntries is the history of the commands executed during a spec.
+// It renders as a readable log in the ginkgo report.
+type AuditEntries []AuditEntry
+
+func (a AuditEntries) String() string {
+	var b strings.Builder
+	for _, e := range a {
+		fmt.Fprintf(&b, "[%s] %s (%s, exit code %d)\n",
+			e.Time.Format("15:04:05.000"), commandLine(e.Command, e.Args),
+			e.Duration.Round(time.Millisecond), e.ExitCode)
+		if e.Error != "" {
+			fmt.Fprintf(&b, "  error: %s\n", e.Error)
+		}
+		for _, line := range strings.Split(strings.TrimRight(e.Output, "\n"), "\n") {
+			if line != "" {
+				fmt.Fprintf(&b, "  | %s\n", line)
+			}
+		}
+	}
+	return b.String()
+}
+
+var (
+	auditMu     sync.Mutex
+	auditActive bool
+	auditLog    AuditEntries
+)
+
+// AuditSpecCommands records every command executed through the helpers until
+// the end of the current spec, and attaches them to the spec report.
+// The entry is visible in the console output on failure or in verbose mode,
+// and always included in the JSON and JUnit reports.
+// It must be called from a setup node, e.g. the outermost BeforeEach.
+func AuditSpecCommands() {
+	StartAudit()
+	DeferCleanup(func() {
+		AddReportEntry(AuditReportEntry, StopAudit(), ReportEntryVisibilityFailureOrVerbose)
+	})
+}
+
+// StartAudit starts recording the executed commands, discarding any
+// previous record.
+func StartAudit() {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	auditActive = true
+	auditLog = nil
+}
+
+// StopAudit stops recording and returns the commands executed since StartAudit.
+func StopAudit() AuditEntries {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	auditActive = false
+	entries := auditLog
+	auditLog = nil
+	return entries
+}
+
+func auditCommand(start time.Time, res *CommandResult, err error) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	if !auditActive {
+		return
+	}
+
+	e := AuditEntry{
+		Time:     start,
+		Command:  res.Command,
+		Args:     res.Args,
+		Dir:      res.Dir,
+		Duration: res.Duration,
+		ExitCode: res.ExitCode,
+		Output:   truncateOutput(res.Combined, MaxAuditOutput),
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	auditLog = append(auditLog, e)
+}
+
+// truncateOutput keeps the last max bytes of out, where errors usually are.
+func truncateOutput(out string, max int) string {
+	if max <= 0 || len(out) <= max {
+		return out
+	}
+	return fmt.Sprintf("... (%d bytes truncated)\n%s", len(out)-max, out[len(out)-max:])
+}
@@ -0,0 +1,85 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers_test
+
+import (
+	"strings"
+
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Audit", func() {
+	It("records the commands executed between start and stop", func(ctx SpecContext) {
+		_, err := RunContext(ctx, "", false, "sh", "-c", "echo before")
+		Expect(err).ToNot(HaveOccurred())
+
+		StartAudit()
+		_, err = RunContext(ctx, "", false, "sh", "-c", "echo first")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = RunContext(ctx, "", false, "sh", "-c", "echo second >&2; exit 3")
+		Expect(err).To(HaveOccurred())
+		entries := StopAudit()
+
+		_, err = RunContext(ctx, "", false, "sh", "-c", "echo after")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].Args).To(Equal([]string{"-c", "echo first"}))
+		Expect(entries[0].Output).To(Equal("first\n"))
+		Expect(entries[1].ExitCode).To(Equal(3))
+		Expect(entries[1].Error).To(ContainSubstring("exit code 3"))
+
+		log := entries.String()
+		Expect(log).To(ContainSubstring("sh -c echo first"))
+		Expect(log).To(ContainSubstring("exit code 3"))
+		Expect(log).To(ContainSubstring("  | second"))
+	})
+
+	It("keeps the tail of long outputs", func(ctx SpecContext) {
+		prev := MaxAuditOutput
+		MaxAuditOutput = 8
+		DeferCleanup(func() { MaxAuditOutput = prev })
+
+		StartAudit()
+		_, err := RunContext(ctx, "", false, "sh", "-c", "printf 0123456789abcdef")
+		Expect(err).ToNot(HaveOccurred())
+		entries := StopAudit()
+
+		Expect(entries[0].Output).To(HavePrefix("... (8 bytes truncated)"))
+		Expect(entries[0].Output).To(HaveSuffix("89abcdef"))
+	})
+
+	When("auditing a spec", func() {
+		BeforeEach(func() {
+			AuditSpecCommands()
+		})
+
+		ReportAfterEach(func(report SpecReport) {
+			var found bool
+			for _, entry := range report.ReportEntries {
+				if entry.Name == AuditReportEntry {
+					found = true
+					Expect(entry.StringRepresentation()).To(ContainSubstring("echo audited"))
+				}
+			}
+			Expect(found).To(BeTrue())
+		})
+
+		It("attaches the commands to the report", func(ctx SpecContext) {
+			out, err := RunContext(ctx, "", false, "sh", "-c", "echo audited")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strings.TrimSpace(out)).To(Equal("audited"))
+		})
+	})
+})
@@ -0,0 +1,373 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	"github.com/pkg/errors"
+)
+
+// CassetteMode selects whether commands are executed, recorded or replayed.
+type CassetteMode string
+
+const (
+	CassetteOff    CassetteMode = ""
+	CassetteRecord CassetteMode = "record"
+	CassetteReplay CassetteMode = "replay"
+)
+
+const (
+	// CassetteModeEnv selects the CassetteMode of the suites.
+	CassetteModeEnv = "S3GW_CASSETTE_MODE"
+	// CassetteDirEnv overrides the directory cassettes are stored in,
+	// relative to the suite directory.
+	CassetteDirEnv = "S3GW_CASSETTE_DIR"
+
+	defaultCassetteDir = "cassettes"
+)
+
+// ErrUnrecordedInvocation is returned when replaying a command that is not
+// the next one recorded in the cassette.
+var ErrUnrecordedInvocation = errors.New("unrecorded invocation")
+
+// Interaction is a single command recorded in a cassette.
+type Interaction struct {
+	Command  string        `json:"command"`
+	Args     []string      `json:"args"`
+	Dir      string        `json:"dir"`
+	Stdout   string        `json:"stdout"`
+	Stderr   string        `json:"stderr"`
+	Combined string        `json:"combined"`
+	ExitCode int           `json:"exitCode"`
+	Duration time.Duration `json:"duration"`
+	// Reason is the message of the CommandError reason, empty on success.
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Cassette holds the commands executed during a spec.
+// In record mode every command is appended to it, in replay mode commands are
+// served from it in the recorded order.
+type Cassette struct {
+	Path string       `json:"-"`
+	Mode CassetteMode `json:"-"`
+	// Names are the names issued by UniqueName when the spec was recorded,
+	// in the order they were issued. They appear in the interactions, which
+	// are replayed with the names issued by the replaying process instead.
+	Names        []string      `json:"names"`
+	Interactions []Interaction `json:"interactions"`
+
+	mu   sync.Mutex
+	next int
+	errs []string
+}
+
+var (
+	cassetteMu     sync.Mutex
+	activeCassette *Cassette
+)
+
+// CassetteModeFromEnv returns the CassetteMode selected by CassetteModeEnv.
+func CassetteModeFromEnv() (CassetteMode, error) {
+	switch mode := CassetteMode(os.Getenv(CassetteModeEnv)); mode {
+	case CassetteOff, CassetteRecord, CassetteReplay:
+		return mode, nil
+	default:
+		return CassetteOff, errors.Errorf("invalid %s %q", CassetteModeEnv, mode)
+	}
+}
+
+// CassetteDir returns the directory cassettes are stored in.
+func CassetteDir() string {
+	if dir := os.Getenv(CassetteDirEnv); dir != "" {
+		return dir
+	}
+	return defaultCassetteDir
+}
+
+// NewCassette returns a cassette stored at path. In replay mode the recorded
+// interactions are loaded from path, with the recorded names replaced by the
+// ones issued by this process, see UniqueName.
+func NewCassette(path string, mode CassetteMode) (*Cassette, error) {
+	c := &Cassette{Path: path, Mode: mode}
+	if mode != CassetteReplay {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading cassette")
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, errors.Wrapf(err, "parsing cassette %s", path)
+	}
+	if err := c.renameInteractions(issuedNamesInOrder()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// renameInteractions replaces the recorded names in the interactions with
+// the names issued at the same position by the replaying process. Names are
+// issued in the same order by every process, when the ginkgo tree is built,
+// whichever specs run, in whatever order, on whatever node.
+func (c *Cassette) renameInteractions(issued []string) error {
+	if c.Names == nil {
+		return errors.Errorf("cassette %s has no names journal, record it again", c.Path)
+	}
+	if len(c.Names) > len(issued) {
+		return errors.Errorf("cassette %s was recorded with %d names, %d were issued: record it again",
+			c.Path, len(c.Names), len(issued))
+	}
+
+	var pairs []string
+	for i, name := range c.Names {
+		if name != issued[i] {
+			pairs = append(pairs, name, issued[i])
+		}
+	}
+	if len(pairs) == 0 {
+		return nil
+	}
+	r := strings.NewReplacer(pairs...)
+	for i := range c.Interactions {
+		in := &c.Interactions[i]
+		for j := range in.Args {
+			in.Args[j] = r.Replace(in.Args[j])
+		}
+		in.Stdout = r.Replace(in.Stdout)
+		in.Stderr = r.Replace(in.Stderr)
+		in.Combined = r.Replace(in.Combined)
+		in.Error = r.Replace(in.Error)
+	}
+	return nil
+}
+
+// InsertCassette makes c the cassette used by every following command.
+func InsertCassette(c *Cassette) {
+	cassetteMu.Lock()
+	defer cassetteMu.Unlock()
+	activeCassette = c
+}
+
+// EjectCassette stops using the active cassette, saving it in record mode.
+// It returns an error if, in replay mode, an invocation was not recorded or
+// recorded interactions were not replayed.
+func EjectCassette() error {
+	cassetteMu.Lock()
+	c := activeCassette
+	activeCassette = nil
+	cassetteMu.Unlock()
+
+	if c == nil {
+		return nil
+	}
+
+	switch c.Mode {
+	case CassetteRecord:
+		return c.save()
+	case CassetteReplay:
+		return c.Err()
+	}
+	return nil
+}
+
+// UseSpecCassette inserts a cassette named after the current spec when the
+// suite runs in record or replay mode, and ejects it when the spec ends.
+// It must be called from a setup node, e.g. the outermost BeforeEach.
+func UseSpecCassette() {
+	mode, err := CassetteModeFromEnv()
+	if err != nil {
+		Fail(err.Error())
+	}
+	if mode == CassetteOff {
+		return
+	}
+
+	path := filepath.Join(CassetteDir(), cassetteFileName(CurrentSpecReport().FullText()))
+	c, err := NewCassette(path, mode)
+	if err != nil {
+		Fail(err.Error())
+	}
+
+	InsertCassette(c)
+	DeferCleanup(func() {
+		if err := EjectCassette(); err != nil {
+			Fail(err.Error())
+		}
+	})
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func cassetteFileName(specText string) string {
+	name := strings.Trim(unsafeFileChars.ReplaceAllString(specText, "_"), "_")
+	return name + ".json"
+}
+
+func currentCassette() *Cassette {
+	cassetteMu.Lock()
+	defer cassetteMu.Unlock()
+	return activeCassette
+}
+
+// Err returns an error describing every replay mismatch and every recorded
+// interaction that has not been replayed.
+func (c *Cassette) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	errs := append([]string{}, c.errs...)
+	for _, i := range c.Interactions[c.next:] {
+		errs = append(errs, "not replayed: "+commandLine(i.Command, i.Args))
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errors.Errorf("cassette %s:\n%s", c.Path, strings.Join(errs, "\n"))
+}
+
+func (c *Cassette) record(res *CommandResult, err error) {
+	i := Interaction{
+		Command:  res.Command,
+		Args:     res.Args,
+		Dir:      res.Dir,
+		Stdout:   res.Stdout,
+		Stderr:   res.Stderr,
+		Combined: res.Combined,
+		ExitCode: res.ExitCode,
+		Duration: res.Duration,
+	}
+	if err != nil {
+		i.Error = err.Error()
+		var cerr *CommandError
+		if errors.As(err, &cerr) {
+			i.Reason = cerr.Reason.Error()
+			i.Error = cerr.Err.Error()
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Interactions = append(c.Interactions, i)
+}
+
+// replay returns the next recorded interaction, which must match the command
+// and args. The directory is not compared as it depends on the checkout.
+func (c *Cassette) replay(command string, args []string, dir string) (*CommandResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res := &CommandResult{Command: command, Args: args, Dir: dir, ExitCode: -1}
+
+	if c.next >= len(c.Interactions) {
+		err := errors.Wrapf(ErrUnrecordedInvocation, "%s: cassette exhausted", commandLine(command, args))
+		c.errs = append(c.errs, err.Error())
+		return res, err
+	}
+
+	i := c.Interactions[c.next]
+	if i.Command != command || !equalArgs(i.Args, args) {
+		err := errors.Wrapf(ErrUnrecordedInvocation, "%s: expected %s",
+			commandLine(command, args), commandLine(i.Command, i.Args))
+		c.errs = append(c.errs, err.Error())
+		return res, err
+	}
+	c.next++
+
+	res.Stdout = i.Stdout
+	res.Stderr = i.Stderr
+	res.Combined = i.Combined
+	res.ExitCode = i.ExitCode
+	res.Duration = i.Duration
+
+	if i.Reason == "" && i.Error == "" {
+		return res, nil
+	}
+
+	var reason error
+	for _, r := range []error{ErrCommandExit, ErrCommandTimeout, ErrCommandCanceled} {
+		if r.Error() == i.Reason {
+			reason = r
+		}
+	}
+	if reason == nil {
+		return res, errors.New(i.Error)
+	}
+	return res, &CommandError{
+		Command:  command,
+		Args:     args,
+		ExitCode: i.ExitCode,
+		Stderr:   i.Stderr,
+		Reason:   reason,
+		Err:      errors.New(i.Error),
+	}
+}
+
+func (c *Cassette) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0o755); err != nil {
+		return errors.Wrap(err, "creating cassette dir")
+	}
+	c.Names = issuedNamesInOrder()
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.Path, append(data, '\n'), 0o644)
+}
+
+func equalArgs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func commandLine(command string, args []string) string {
+	return strings.TrimSpace(fmt.Sprintf("%s %s", command, strings.Join(args, " ")))
+}
+
+// The names generated by UniqueName are part of the recorded arguments, so
+// each cassette records them, see Cassette.Names.
+var (
+	namesMu      sync.Mutex
+	namesJournal []string
+)
+
+func journalName(name string) {
+	namesMu.Lock()
+	defer namesMu.Unlock()
+	namesJournal = append(namesJournal, name)
+}
+
+func issuedNamesInOrder() []string {
+	namesMu.Lock()
+	defer namesMu.Unlock()
+	return append([]string{}, namesJournal...)
+}
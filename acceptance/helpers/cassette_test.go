@@ -0,0 +1,157 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	"github.com/aquarist-labs/s3gw/acceptance/helpers/fakebin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+var _ = Describe("Cassette", func() {
+	var path, marker string
+	// issued when the tree is built, like the names of the suites
+	name := UniqueName("cassette")
+
+	BeforeEach(func() {
+		dir := GinkgoT().TempDir()
+		path = filepath.Join(dir, "spec.json")
+		marker = filepath.Join(dir, "executed")
+	})
+
+	record := func(ctx SpecContext) {
+		c, err := NewCassette(path, CassetteRecord)
+		Expect(err).ToNot(HaveOccurred())
+		InsertCassette(c)
+
+		out, err := RunContext(ctx, "", false, "sh", "-c", "echo recorded; touch "+marker)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out).To(Equal("recorded\n"))
+		_, err = RunContext(ctx, "", false, "sh", "-c", "exit 4")
+		Expect(err).To(HaveOccurred())
+
+		Expect(EjectCassette()).To(Succeed())
+		Expect(path).To(BeAnExistingFile())
+		Expect(os.Remove(marker)).To(Succeed())
+	}
+
+	It("replays recorded invocations without executing them", func(ctx SpecContext) {
+		record(ctx)
+
+		c, err := NewCassette(path, CassetteReplay)
+		Expect(err).ToNot(HaveOccurred())
+		InsertCassette(c)
+
+		out, err := RunContext(ctx, "", false, "sh", "-c", "echo recorded; touch "+marker)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out).To(Equal("recorded\n"))
+		Expect(marker).ToNot(BeAnExistingFile())
+
+		res, err := RunResult(ctx, "", false, "sh", "-c", "exit 4")
+		Expect(errors.Is(err, ErrCommandExit)).To(BeTrue())
+		Expect(res.ExitCode).To(Equal(4))
+
+		Expect(EjectCassette()).To(Succeed())
+	})
+
+	It("fails on unrecorded and unreplayed invocations", func(ctx SpecContext) {
+		record(ctx)
+
+		c, err := NewCassette(path, CassetteReplay)
+		Expect(err).ToNot(HaveOccurred())
+		InsertCassette(c)
+
+		_, err = RunContext(ctx, "", false, "sh", "-c", "echo something else")
+		Expect(errors.Is(err, ErrUnrecordedInvocation)).To(BeTrue())
+
+		err = EjectCassette()
+		Expect(err).To(MatchError(ContainSubstring("echo something else")))
+		Expect(err).To(MatchError(ContainSubstring("not replayed: sh -c exit 4")))
+	})
+
+	It("replays the recorded names as the names issued by the replaying process", func(ctx SpecContext) {
+		c, err := NewCassette(path, CassetteRecord)
+		Expect(err).ToNot(HaveOccurred())
+		InsertCassette(c)
+		_, err = RunContext(ctx, "", false, "echo", name)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(EjectCassette()).To(Succeed())
+
+		// as recorded by another node
+		data, err := os.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring(name))
+		other := strings.ReplaceAll(string(data), name, "cassette-9zzzzz")
+		Expect(os.WriteFile(path, []byte(other), 0o644)).To(Succeed())
+
+		c, err = NewCassette(path, CassetteReplay)
+		Expect(err).ToNot(HaveOccurred())
+		InsertCassette(c)
+		out, err := RunContext(ctx, "", false, "echo", name)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out).To(Equal(name + "\n"))
+		Expect(EjectCassette()).To(Succeed())
+	})
+
+	It("replays the commands recorded against another kubeconfig", func(ctx SpecContext) {
+		GinkgoT().Setenv(RenderOnlyEnv, "")
+		fake := fakebin.New(GinkgoT(), "kubectl")
+		fake.On("kubectl", `get pods`, fakebin.Response{Stdout: "s3gw-0\n"})
+
+		c, err := NewCassette(path, CassetteRecord)
+		Expect(err).ToNot(HaveOccurred())
+		InsertCassette(c)
+		recording := WithClusterTarget(ctx, ClusterTarget{Kubeconfig: "/home/alice/s3gw/tmp/kubeconfig", Context: "k3d-a"})
+		_, err = KubectlResult(recording, "get", "pods")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(EjectCassette()).To(Succeed())
+		Expect(fake.Invocations("kubectl")[0].Args).To(HaveExactElements(
+			"--kubeconfig", "/home/alice/s3gw/tmp/kubeconfig", "--context", "k3d-a", "get", "pods"))
+
+		data, err := os.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).ToNot(ContainSubstring("kubeconfig"))
+
+		c, err = NewCassette(path, CassetteReplay)
+		Expect(err).ToNot(HaveOccurred())
+		InsertCassette(c)
+		replaying := WithClusterTarget(ctx, ClusterTarget{Kubeconfig: "/builds/ci/s3gw/tmp/kubeconfig", Context: "k3d-b"})
+		res, err := KubectlResult(replaying, "get", "pods")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Stdout).To(Equal("s3gw-0\n"))
+		Expect(res.Args).To(HaveExactElements(
+			"--kubeconfig", "/builds/ci/s3gw/tmp/kubeconfig", "--context", "k3d-b", "get", "pods"))
+		Expect(EjectCassette()).To(Succeed())
+		Expect(fake.Invocations("kubectl")).To(HaveLen(1))
+	})
+
+	DescribeTable("fails when the names journal can't be replayed",
+		func(names, message string) {
+			Expect(os.WriteFile(path, []byte(`{`+names+`"interactions": []}`), 0o644)).To(Succeed())
+			_, err := NewCassette(path, CassetteReplay)
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("missing", ``, "has no names journal"),
+		Entry("exhausted", `"names": [`+strings.Repeat(`"a",`, 10000)+`"a"],`, "10001 names"),
+	)
+
+	It("fails when the cassette does not exist in replay mode", func() {
+		_, err := NewCassette(path, CassetteReplay)
+		Expect(err).To(HaveOccurred())
+	})
+})
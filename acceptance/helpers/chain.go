@@ -0,0 +1,85 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ChainVersion is a step of an upgrade chain: the chart version installed
+// and the image tag it is expected to run.
+type ChainVersion struct {
+	ChartsVer string
+	ImageTag  string
+}
+
+func (v ChainVersion) String() string {
+	if v.ImageTag == v.ChartsVer {
+		return v.ChartsVer
+	}
+	return v.ChartsVer + ":" + v.ImageTag
+}
+
+// Hop names the upgrade from the version at index i-1 of chain to the one
+// at index i, e.g. `hop 2/3 (0.15.0 -> 0.16.0)`.
+func Hop(chain []ChainVersion, i int) string {
+	return fmt.Sprintf("hop %d/%d (%s -> %s)", i, len(chain)-1, chain[i-1], chain[i])
+}
+
+// ParseUpgradeChain parses a comma separated list of versions, in upgrade
+// order, e.g. `0.14.0,0.15.0,0.16.0:0.16.1`. A version is a chart version
+// optionally followed by the image tag it runs, the chart version by
+// default. An empty list is valid, otherwise there must be at least two
+// versions.
+func ParseUpgradeChain(s string) ([]ChainVersion, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	var chain []ChainVersion
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		chartsVer, imageTag, found := strings.Cut(part, ":")
+		if !found {
+			imageTag = chartsVer
+		}
+		for _, v := range []string{chartsVer, imageTag} {
+			if !versionRegex.MatchString(v) {
+				return nil, errors.Errorf("%q is not a semantic version", v)
+			}
+		}
+		chain = append(chain, ChainVersion{
+			ChartsVer: strings.TrimPrefix(chartsVer, "v"),
+			ImageTag:  strings.TrimPrefix(imageTag, "v"),
+		})
+	}
+	if len(chain) < 2 {
+		return nil, errors.Errorf("an upgrade chain needs at least two versions, got %q", s)
+	}
+	return chain, nil
+}
+
+// UpgradeChain returns the versions of UPGRADE_CHAIN, or the single hop
+// from CHARTS_VER_PREV/IMAGE_TAG_PREV to CHARTS_VER/IMAGE_TAG when it is not
+// set.
+func (p *SuiteProperties) UpgradeChain() ([]ChainVersion, error) {
+	if p.UpgradeChainSpec != "" {
+		return ParseUpgradeChain(p.UpgradeChainSpec)
+	}
+	return []ChainVersion{
+		{ChartsVer: p.ChartsVerPrev, ImageTag: p.ImageTagPrev},
+		{ChartsVer: p.ChartsVer, ImageTag: p.ImageTag},
+	}, nil
+}
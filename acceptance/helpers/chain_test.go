@@ -0,0 +1,56 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers_test
+
+import (
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Upgrade chains", func() {
+	It("parses the versions and their image tags", func() {
+		chain, err := ParseUpgradeChain(" 0.14.0, v0.15.0 ,0.16.0:v0.16.1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(chain).To(Equal([]ChainVersion{
+			{ChartsVer: "0.14.0", ImageTag: "0.14.0"},
+			{ChartsVer: "0.15.0", ImageTag: "0.15.0"},
+			{ChartsVer: "0.16.0", ImageTag: "0.16.1"},
+		}))
+		Expect(Hop(chain, 2)).To(Equal("hop 2/2 (0.15.0 -> 0.16.0:0.16.1)"))
+	})
+
+	DescribeTable("rejects malformed chains",
+		func(s, message string) {
+			_, err := ParseUpgradeChain(s)
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry(nil, "0.14.0", "at least two versions"),
+		Entry(nil, "0.14.0,latest", `"latest" is not a semantic version`),
+		Entry(nil, "0.14.0,0.15.0:", `"" is not a semantic version`),
+		Entry(nil, "0.14.0,,0.15.0", `"" is not a semantic version`),
+	)
+
+	It("falls back to the previous and target versions", func() {
+		props := &SuiteProperties{
+			ChartsVerPrev: "0.16.0", ImageTagPrev: "0.16.0",
+			ChartsVer: "0.17.0", ImageTag: "0.17.1",
+		}
+		Expect(props.UpgradeChain()).To(Equal([]ChainVersion{
+			{ChartsVer: "0.16.0", ImageTag: "0.16.0"},
+			{ChartsVer: "0.17.0", ImageTag: "0.17.1"},
+		}))
+
+		props.UpgradeChainSpec = "0.15.0,0.17.0"
+		Expect(props.UpgradeChain()).To(HaveLen(2))
+	})
+})
@@ -0,0 +1,207 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	"github.com/pkg/errors"
+)
+
+// ClusterTarget selects the cluster kubectl and helm talk to.
+// Empty fields fall back to the ambient kubeconfig and current context.
+type ClusterTarget struct {
+	Name       string
+	Kubeconfig string
+	Context    string
+}
+
+// DefaultClusterName is the name of the target built from CLUSTER_KUBECONFIG
+// and CLUSTER_CONTEXT.
+const DefaultClusterName = "default"
+
+// String returns the target name along with its kubeconfig and context.
+func (t ClusterTarget) String() string {
+	s := t.Name
+	if t.Kubeconfig != "" {
+		s += " kubeconfig=" + t.Kubeconfig
+	}
+	if t.Context != "" {
+		s += " context=" + t.Context
+	}
+	return s
+}
+
+// IsAmbient reports whether the target uses the ambient kubeconfig and context.
+func (t ClusterTarget) IsAmbient() bool {
+	return t.Kubeconfig == "" && t.Context == ""
+}
+
+// args returns the global flags selecting the target for command, which
+// must be kubectl or helm.
+func (t ClusterTarget) args(command string) []string {
+	var args []string
+	if t.Kubeconfig != "" {
+		args = append(args, "--kubeconfig", t.Kubeconfig)
+	}
+	if t.Context != "" {
+		switch command {
+		case "kubectl":
+			args = append(args, "--context", t.Context)
+		case "helm":
+			args = append(args, "--kube-context", t.Context)
+		}
+	}
+	return args
+}
+
+// ParseClusterTargets parses a comma separated list of targets in the
+// `name=[kubeconfig][@context]` format.
+// Relative kubeconfig paths are resolved against root.
+func ParseClusterTargets(s, root string) ([]ClusterTarget, error) {
+	var targets []ClusterTarget
+	seen := map[string]bool{}
+
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, spec, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, errors.Errorf("cluster target %q: expected name=[kubeconfig][@context]", entry)
+		}
+		if seen[name] {
+			return nil, errors.Errorf("cluster target %q: duplicate name", name)
+		}
+		seen[name] = true
+
+		kubeconfig, kubeContext, _ := strings.Cut(spec, "@")
+		targets = append(targets, ClusterTarget{
+			Name:       name,
+			Kubeconfig: resolvePath(root, strings.TrimSpace(kubeconfig)),
+			Context:    strings.TrimSpace(kubeContext),
+		})
+	}
+	return targets, nil
+}
+
+func resolvePath(root, path string) string {
+	if path == "" || filepath.IsAbs(path) || root == "" {
+		return path
+	}
+	if abs, err := filepath.Abs(filepath.Join(root, path)); err == nil {
+		return abs
+	}
+	return path
+}
+
+// repositoryRoot returns the root of the repository, given the location of
+// the suite properties file in the acceptance directory.
+func repositoryRoot(propertiesPath string) string {
+	return filepath.Join(filepath.Dir(propertiesPath), "..")
+}
+
+// ClusterTargets returns the targets selected by CLUSTER_TARGETS, or a single
+// target named DefaultClusterName built from CLUSTER_KUBECONFIG and
+// CLUSTER_CONTEXT.
+func (p *SuiteProperties) ClusterTargets() ([]ClusterTarget, error) {
+	root := repositoryRoot(p.path)
+	if strings.TrimSpace(p.ClusterTargetsSpec) != "" {
+		return ParseClusterTargets(p.ClusterTargetsSpec, root)
+	}
+	return []ClusterTarget{{
+		Name:       DefaultClusterName,
+		Kubeconfig: resolvePath(root, p.ClusterKubeconfig),
+		Context:    p.ClusterContext,
+	}}, nil
+}
+
+// SuiteClusterTargets returns the cluster targets of the suite properties at
+// SuitePropertiesFile, without validating the other properties.
+// It is meant to be used while building the spec tree, before the properties
+// are loaded; on any error the ambient cluster is returned, and the error
+// is reported by LoadSuiteProperties.
+func SuiteClusterTargets() []ClusterTarget {
+	props := &SuiteProperties{path: SuitePropertiesFile}
+	if data, err := os.ReadFile(SuitePropertiesFile); err == nil {
+		_ = json.Unmarshal(data, props)
+	}
+	props.applyEnv()
+
+	targets, err := props.ClusterTargets()
+	if err != nil || len(targets) == 0 {
+		return []ClusterTarget{{Name: DefaultClusterName}}
+	}
+	return targets
+}
+
+var (
+	clusterTargetMu      sync.Mutex
+	defaultClusterTarget ClusterTarget
+)
+
+type clusterTargetKey struct{}
+
+// WithClusterTarget returns a context whose kubectl and helm commands are run
+// against target.
+func WithClusterTarget(ctx context.Context, target ClusterTarget) context.Context {
+	return context.WithValue(ctx, clusterTargetKey{}, target)
+}
+
+// ClusterTargetFrom returns the cluster target of ctx, or the default one,
+// see SetDefaultClusterTarget.
+func ClusterTargetFrom(ctx context.Context) ClusterTarget {
+	if target, ok := ctx.Value(clusterTargetKey{}).(ClusterTarget); ok {
+		return target
+	}
+	clusterTargetMu.Lock()
+	defer clusterTargetMu.Unlock()
+	return defaultClusterTarget
+}
+
+// SetDefaultClusterTarget sets the target of the commands whose context
+// carries none, and returns the previous one.
+func SetDefaultClusterTarget(target ClusterTarget) ClusterTarget {
+	clusterTargetMu.Lock()
+	defer clusterTargetMu.Unlock()
+	prev := defaultClusterTarget
+	defaultClusterTarget = target
+	return prev
+}
+
+// UseClusterTarget runs the commands of the current spec against target.
+// It must be called from a setup node, the previous target is restored when
+// the spec ends.
+func UseClusterTarget(target ClusterTarget) {
+	prev := SetDefaultClusterTarget(target)
+	DeferCleanup(func() {
+		SetDefaultClusterTarget(prev)
+	})
+}
+
+// clusterTargetArgs returns the flags selecting the cluster target of ctx,
+// for kubectl and helm commands.
+func clusterTargetArgs(ctx context.Context, command string) []string {
+	switch filepath.Base(command) {
+	case "kubectl", "helm":
+		return ClusterTargetFrom(ctx).args(filepath.Base(command))
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers_test
+
+import (
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	"github.com/aquarist-labs/s3gw/acceptance/helpers/fakebin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ClusterTarget", func() {
+	It("parses a list of targets", func() {
+		targets, err := ParseClusterTargets("a=tmp/a-kubeconfig, b=/etc/b@ctx-b,c=@ctx-c", "/repo")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(targets).To(Equal([]ClusterTarget{
+			{Name: "a", Kubeconfig: "/repo/tmp/a-kubeconfig"},
+			{Name: "b", Kubeconfig: "/etc/b", Context: "ctx-b"},
+			{Name: "c", Context: "ctx-c"},
+		}))
+	})
+
+	It("rejects malformed and duplicate targets", func() {
+		_, err := ParseClusterTargets("a=x,a=y", "")
+		Expect(err).To(MatchError(ContainSubstring("duplicate")))
+		_, err = ParseClusterTargets("kubeconfig", "")
+		Expect(err).To(MatchError(ContainSubstring("expected name=")))
+	})
+
+	When("running kubectl and helm", func() {
+		var fake *fakebin.Harness
+
+		BeforeEach(func() {
+			fake = fakebin.New(GinkgoT(), "kubectl", "helm")
+			fake.On("kubectl", `.*`, fakebin.Response{})
+			fake.On("helm", `.*`, fakebin.Response{})
+		})
+
+		It("selects the target of the context", func(ctx SpecContext) {
+			ctx2 := WithClusterTarget(ctx, ClusterTarget{Kubeconfig: "/tmp/kc", Context: "k3d-a"})
+
+			_, err := KubectlContext(ctx2, "get", "pods")
+			Expect(err).ToNot(HaveOccurred())
+			_, err = RunContext(ctx2, "", false, "helm", "list")
+			Expect(err).ToNot(HaveOccurred())
+			_, err = RunContext(ctx2, "", false, "true")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fake.Invocations("kubectl")[0].Args).To(Equal(
+				[]string{"--kubeconfig", "/tmp/kc", "--context", "k3d-a", "get", "pods"}))
+			Expect(fake.Invocations("helm")[0].Args).To(Equal(
+				[]string{"--kubeconfig", "/tmp/kc", "--kube-context", "k3d-a", "list"}))
+		})
+
+		When("a spec uses a cluster target", func() {
+			BeforeEach(func() {
+				UseClusterTarget(ClusterTarget{Name: "b", Context: "k3d-b"})
+			})
+
+			It("runs every command against it", func(ctx SpecContext) {
+				_, err := KubectlContext(ctx, "get", "pods")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fake.Invocations("kubectl")[0].Args).To(Equal(
+					[]string{"--context", "k3d-b", "get", "pods"}))
+			})
+		})
+
+		It("uses the ambient cluster by default", func(ctx SpecContext) {
+			_, err := KubectlContext(ctx, "get", "pods")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fake.Invocations("kubectl")[0].Args).To(Equal([]string{"get", "pods"}))
+		})
+	})
+})
@@ -0,0 +1,185 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ArtifactsDirEnv overrides the directory failure diagnostics are dumped
+	// to, relative to the suite directory.
+	ArtifactsDirEnv = "S3GW_ARTIFACTS_DIR"
+	// DiagnosticsReportEntry is the name of the report entry linking the
+	// diagnostics of a failed spec.
+	DiagnosticsReportEntry = "diagnostics"
+
+	defaultArtifactsDir = "artifacts"
+)
+
+// diagnosticsResources are dumped from the namespace of a failed spec, one
+// file each. The COSI resources are missing on clusters without COSI, which
+// is recorded in their file.
+var diagnosticsResources = []struct {
+	file string
+	args []string
+}{
+	{"pods.yaml", []string{"get", "pods", "-oyaml"}},
+	{"deployments.yaml", []string{"get", "deployments", "-oyaml"}},
+	{"pvcs.yaml", []string{"get", "persistentvolumeclaims", "-oyaml"}},
+	{"events.txt", []string{"get", "events", "--sort-by=.lastTimestamp"}},
+	{"bucketclaims.yaml", []string{"get", "bucketclaims", "-oyaml"}},
+	{"bucketaccesses.yaml", []string{"get", "bucketaccesses", "-oyaml"}},
+}
+
+// clusterDiagnosticsResources are cluster scoped.
+var clusterDiagnosticsResources = []struct {
+	file string
+	args []string
+}{
+	{"buckets.yaml", []string{"get", "buckets", "-oyaml"}},
+}
+
+// ArtifactsDir returns the directory failure diagnostics are dumped to.
+func ArtifactsDir() string {
+	if dir := os.Getenv(ArtifactsDirEnv); dir != "" {
+		return dir
+	}
+	return defaultArtifactsDir
+}
+
+// CollectDiagnosticsOnFailure dumps the state of namespace when the current
+// spec has failed, see CollectDiagnostics, into a directory of ArtifactsDir
+// named after the spec, and links it in the report.
+// It must be called from a JustAfterEach, which runs before the AfterEach
+// nodes uninstalling the release. There is nothing to collect in render-only
+// mode.
+func CollectDiagnosticsOnFailure(ctx context.Context, namespace string) {
+	report := CurrentSpecReport()
+	if !report.Failed() || RenderOnly() {
+		return
+	}
+
+	name := strings.TrimSuffix(cassetteFileName(report.FullText()), ".json")
+	if report.NumAttempts > 1 {
+		name += fmt.Sprintf("-attempt-%d", report.NumAttempts)
+	}
+	dir, err := filepath.Abs(filepath.Join(ArtifactsDir(), name))
+	if err != nil {
+		dir = filepath.Join(ArtifactsDir(), name)
+	}
+
+	if err := CollectDiagnostics(ctx, namespace, dir); err != nil {
+		fmt.Fprintf(GinkgoWriter, "collecting diagnostics of namespace %s: %v\n", namespace, err)
+	}
+	AddReportEntry(DiagnosticsReportEntry, dir, ReportEntryVisibilityFailureOrVerbose)
+}
+
+// CollectDiagnostics dumps the pods, deployments, events, PVCs and COSI
+// objects of namespace, and the current and previous logs of its containers,
+// into dir. Failing commands don't stop the collection, their error is
+// written in place of the output.
+func CollectDiagnostics(ctx context.Context, namespace, dir string) error {
+	if err := os.MkdirAll(filepath.Join(dir, "logs"), 0o755); err != nil {
+		return errors.Wrap(err, "creating diagnostics dir")
+	}
+
+	var errs []string
+	dump := func(file string, args ...string) {
+		res, err := KubectlResult(ctx, args...)
+		out := res.Stdout
+		if err != nil {
+			errs = append(errs, err.Error())
+			out = err.Error() + "\n"
+		}
+		if werr := os.WriteFile(filepath.Join(dir, file), []byte(out), 0o644); werr != nil {
+			errs = append(errs, werr.Error())
+		}
+	}
+
+	for _, r := range diagnosticsResources {
+		dump(r.file, append(r.args, "-n", namespace)...)
+	}
+	for _, r := range clusterDiagnosticsResources {
+		dump(r.file, r.args...)
+	}
+
+	res, err := KubectlResult(ctx, "get", "pods", "-n", namespace, "-ojson")
+	if err != nil {
+		errs = append(errs, err.Error())
+	} else if pods, err := ToJSONObject(res.Stdout); err != nil {
+		errs = append(errs, err.Error())
+	} else {
+		for _, c := range podContainers(pods) {
+			logs := filepath.Join("logs", c.pod+"_"+c.container)
+			dump(logs+".log", "logs", "-n", namespace, c.pod, "-c", c.container)
+			if c.restarts > 0 {
+				dump(logs+".previous.log", "logs", "-n", namespace, c.pod, "-c", c.container, "--previous")
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Errorf("%d diagnostics could not be collected:\n%s", len(errs), strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+type podContainer struct {
+	pod       string
+	container string
+	restarts  int
+}
+
+// podContainers lists the init and regular containers of a pod list.
+func podContainers(pods interface{}) []podContainer {
+	var containers []podContainer
+
+	items, _ := JSONPath(pods, "items")
+	list, _ := items.([]interface{})
+	for _, pod := range list {
+		podName, _ := JSONPath(pod, "metadata.name")
+
+		restarts := map[interface{}]int{}
+		for _, statuses := range []string{"status.initContainerStatuses", "status.containerStatuses"} {
+			node, _ := JSONPath(pod, statuses)
+			list, _ := node.([]interface{})
+			for _, s := range list {
+				name, _ := JSONPath(s, "name")
+				count, _ := JSONPath(s, "restartCount")
+				n, _ := count.(float64)
+				restarts[name] = int(n)
+			}
+		}
+
+		for _, kind := range []string{"spec.initContainers", "spec.containers"} {
+			node, _ := JSONPath(pod, kind)
+			list, _ := node.([]interface{})
+			for _, c := range list {
+				name, _ := JSONPath(c, "name")
+				containers = append(containers, podContainer{
+					pod:       fmt.Sprint(podName),
+					container: fmt.Sprint(name),
+					restarts:  restarts[name],
+				})
+			}
+		}
+	}
+	return containers
+}
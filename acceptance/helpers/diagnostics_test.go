@@ -0,0 +1,83 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	"github.com/aquarist-labs/s3gw/acceptance/helpers/fakebin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const podListJSON = `{
+  "items": [{
+    "metadata": {"name": "s3gw-7c9b4-xyz12"},
+    "spec": {
+      "initContainers": [{"name": "init"}],
+      "containers": [{"name": "s3gw"}]
+    },
+    "status": {
+      "initContainerStatuses": [{"name": "init", "restartCount": 0}],
+      "containerStatuses": [{"name": "s3gw", "restartCount": 3}]
+    }
+  }]
+}`
+
+var _ = Describe("Diagnostics", func() {
+	var fake *fakebin.Harness
+
+	BeforeEach(func() {
+		fake = fakebin.New(GinkgoT(), "kubectl")
+		fake.On("kubectl", `^get`, fakebin.Response{Stdout: "kind: List\n"})
+		fake.On("kubectl", `^get (bucketclaims|bucketaccesses|buckets)`, fakebin.Response{
+			Stderr:   `error: the server doesn't have a resource type "buckets"`,
+			ExitCode: 1,
+		})
+		fake.On("kubectl", `^get pods -n ns -ojson$`, fakebin.Response{Stdout: podListJSON})
+		fake.On("kubectl", `^logs`, fakebin.Response{Stdout: "current log\n"})
+		fake.On("kubectl", `^logs .* --previous$`, fakebin.Response{Stdout: "previous log\n"})
+	})
+
+	It("dumps the namespace resources and the container logs", func(ctx SpecContext) {
+		dir := GinkgoT().TempDir()
+
+		err := CollectDiagnostics(ctx, "ns", dir)
+		Expect(err).To(MatchError(ContainSubstring("3 diagnostics could not be collected")))
+
+		for _, file := range []string{"pods.yaml", "deployments.yaml", "pvcs.yaml", "events.txt"} {
+			Expect(os.ReadFile(filepath.Join(dir, file))).To(BeEquivalentTo("kind: List\n"))
+		}
+		Expect(os.ReadFile(filepath.Join(dir, "buckets.yaml"))).To(ContainSubstring("doesn't have a resource type"))
+
+		Expect(os.ReadFile(filepath.Join(dir, "logs", "s3gw-7c9b4-xyz12_s3gw.log"))).To(BeEquivalentTo("current log\n"))
+		Expect(os.ReadFile(filepath.Join(dir, "logs", "s3gw-7c9b4-xyz12_s3gw.previous.log"))).To(BeEquivalentTo("previous log\n"))
+		Expect(os.ReadFile(filepath.Join(dir, "logs", "s3gw-7c9b4-xyz12_init.log"))).To(BeEquivalentTo("current log\n"))
+		Expect(filepath.Join(dir, "logs", "s3gw-7c9b4-xyz12_init.previous.log")).ToNot(BeAnExistingFile())
+
+		Expect(fake.Invocations("kubectl")).To(ContainElements(
+			HaveField("Args", []string{"get", "events", "--sort-by=.lastTimestamp", "-n", "ns"}),
+			HaveField("Args", []string{"get", "buckets", "-oyaml"}),
+			HaveField("Args", []string{"logs", "-n", "ns", "s3gw-7c9b4-xyz12", "-c", "s3gw", "--previous"}),
+		))
+	})
+
+	It("does nothing when the spec passes", func(ctx SpecContext) {
+		GinkgoT().Setenv(ArtifactsDirEnv, GinkgoT().TempDir())
+
+		CollectDiagnosticsOnFailure(ctx, "ns")
+		Expect(fake.Invocations("kubectl")).To(BeEmpty())
+		Expect(CurrentSpecReport().ReportEntries).To(BeEmpty())
+	})
+})
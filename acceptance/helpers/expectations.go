@@ -0,0 +1,141 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers
+
+import (
+	"strings"
+
+	"github.com/onsi/gomega/types"
+)
+
+// ChartExpectations are the properties of the deployments of the chart that
+// may change between chart versions. Names may contain the {release} and
+// {namespace} placeholders.
+type ChartExpectations struct {
+	Gateway WorkloadExpectations
+	UI      WorkloadExpectations
+	// COSI is the objectstorage-provisioner deployment and its driver,
+	// COSISidecar the sidecar container of the deployment.
+	COSI        WorkloadExpectations
+	COSISidecar WorkloadExpectations
+}
+
+// WorkloadExpectations are the properties of a deployment and its main
+// container.
+type WorkloadExpectations struct {
+	Strategy string
+	Args     []ExpectedArg
+	Ports    []ExpectedPort
+	Volumes  []ExpectedVolume
+}
+
+// ExpectedArg is a container argument, followed by Value unless empty.
+type ExpectedArg struct {
+	Flag  string
+	Value string
+}
+
+// ExpectedPort is a container port, see HavePort.
+type ExpectedPort struct {
+	Name     string
+	Port     int
+	Protocol string
+}
+
+// ExpectedVolume is a volume of the deployment, mounted at MountPath by the
+// container unless empty. When Path is set, the volume has the JSON path
+// Path with the value Value, e.g. `secret.secretName`.
+type ExpectedVolume struct {
+	Name      string
+	MountPath string
+	Path      string
+	Value     string
+}
+
+// CurrentChartExpectations are the expectations of the chart versions under
+// test, the properties the specs used to hard-code. They are not keyed by
+// chart version as long as no tested chart release is known to change them.
+var CurrentChartExpectations = ChartExpectations{
+	Gateway: WorkloadExpectations{
+		Strategy: "Recreate",
+		Args: []ExpectedArg{
+			{"--rgw-backend-store", "sfs"},
+			{"--debug-rgw", "1"},
+			{"--rgw_frontends", "beast port=7480 ssl_port=7481 ssl_certificate=/s3gw-cluster-ip-tls/tls.crt ssl_private_key=/s3gw-cluster-ip-tls/tls.key"},
+		},
+		Ports: []ExpectedPort{
+			{"s3", 7480, "TCP"},
+			{"s3-tls", 7481, "TCP"},
+		},
+		Volumes: []ExpectedVolume{
+			{"s3gw-lh-store", "/data", "persistentVolumeClaim.claimName", "{release}-pvc"},
+			{"s3gw-cluster-ip-tls", "/s3gw-cluster-ip-tls", "secret.secretName", "{release}-{namespace}-cluster-ip-tls"},
+		},
+	},
+	UI: WorkloadExpectations{
+		Strategy: "RollingUpdate",
+		Ports:    []ExpectedPort{{"", 8080, "TCP"}},
+	},
+	COSI: WorkloadExpectations{
+		Strategy: "Recreate",
+		Volumes:  []ExpectedVolume{{Name: "socket", MountPath: "/var/lib/cosi"}},
+	},
+	COSISidecar: WorkloadExpectations{
+		Args:    []ExpectedArg{{Flag: "--v=5"}},
+		Volumes: []ExpectedVolume{{Name: "socket", MountPath: "/var/lib/cosi"}},
+	},
+}
+
+// Deployment returns the matchers of the deployment: its strategy and
+// volumes.
+func (w WorkloadExpectations) Deployment(releaseName, namespace string) []types.GomegaMatcher {
+	var matchers []types.GomegaMatcher
+	if w.Strategy != "" {
+		matchers = append(matchers, HaveStrategy(w.Strategy))
+	}
+	expand := expander(releaseName, namespace)
+	for _, v := range w.Volumes {
+		var source []types.GomegaMatcher
+		if v.Path != "" {
+			source = append(source, HaveJSONPath(v.Path, matcherOrEqual(expand(v.Value))))
+		}
+		matchers = append(matchers, HaveVolume(expand(v.Name), source...))
+	}
+	return matchers
+}
+
+// Container returns the matchers of the container: its arguments, ports
+// and volume mounts.
+func (w WorkloadExpectations) Container(releaseName, namespace string) []types.GomegaMatcher {
+	var matchers []types.GomegaMatcher
+	expand := expander(releaseName, namespace)
+	for _, a := range w.Args {
+		if a.Value == "" {
+			matchers = append(matchers, HaveArgs(expand(a.Flag)))
+			continue
+		}
+		matchers = append(matchers, HaveArgs(expand(a.Flag), expand(a.Value)))
+	}
+	for _, p := range w.Ports {
+		matchers = append(matchers, HavePort(p.Name, p.Port, p.Protocol))
+	}
+	for _, v := range w.Volumes {
+		if v.MountPath != "" {
+			matchers = append(matchers, HaveVolumeMount(v.MountPath, expand(v.Name)))
+		}
+	}
+	return matchers
+}
+
+func expander(releaseName, namespace string) func(string) string {
+	return strings.NewReplacer("{release}", releaseName, "{namespace}", namespace).Replace
+}
@@ -0,0 +1,59 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers_test
+
+import (
+	"encoding/json"
+
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Chart expectations", func() {
+	expectations := ChartExpectations{
+		Gateway: WorkloadExpectations{
+			Strategy: "Recreate",
+			Args:     []ExpectedArg{{"--rgw_frontends", "beast port=7480"}, {Flag: "--verbose"}},
+			Ports:    []ExpectedPort{{"s3", 7480, "TCP"}},
+			Volumes: []ExpectedVolume{
+				{"data", "/data", "persistentVolumeClaim.claimName", "{release}-pvc"},
+				{Name: "tls", Path: "secret.secretName", Value: "{release}-{namespace}-tls"},
+			},
+		},
+	}
+
+	It("matches the deployments", func() {
+		var d map[string]interface{}
+		Expect(json.Unmarshal([]byte(`{"spec": {
+			"strategy": {"type": "Recreate"},
+			"template": {"spec": {
+				"containers": [{
+					"name": "s3gw",
+					"args": ["--rgw_frontends", "beast port=7480", "--verbose"],
+					"ports": [{"name": "s3", "containerPort": 7480, "protocol": "TCP"}],
+					"volumeMounts": [{"name": "data", "mountPath": "/data"}]
+				}],
+				"volumes": [
+					{"name": "data", "persistentVolumeClaim": {"claimName": "s3gw-pvc"}},
+					{"name": "tls", "secret": {"secretName": "s3gw-ns-tls"}}
+				]
+			}}
+		}}`), &d)).To(Succeed())
+
+		Expect(expectations.Gateway.Container("s3gw", "ns")).To(HaveLen(4))
+		Expect(d).To(And(expectations.Gateway.Deployment("s3gw", "ns")...))
+		Expect(d).To(HaveContainer("s3gw", expectations.Gateway.Container("s3gw", "ns")...))
+
+		Expect(d).ToNot(And(expectations.Gateway.Deployment("other", "ns")...))
+	})
+})
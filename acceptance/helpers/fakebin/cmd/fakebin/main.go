@@ -0,0 +1,73 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// fakebin is installed under the name of the executable it fakes, e.g.
+// kubectl or helm, and answers with the responses programmed by the
+// fakebin.Harness of the running test.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aquarist-labs/s3gw/acceptance/helpers/fakebin"
+)
+
+func main() {
+	command := strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+	args := os.Args[1:]
+
+	if err := logInvocation(command, args); err != nil {
+		fmt.Fprintf(os.Stderr, "fakebin: logging invocation: %v\n", err)
+		os.Exit(125)
+	}
+
+	script, err := fakebin.ReadScript(os.Getenv(fakebin.ScriptEnv))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fakebin: reading script: %v\n", err)
+		os.Exit(125)
+	}
+
+	res, ok := script.Match(command, args)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "fakebin: no response programmed for %s %s\n", command, strings.Join(args, " "))
+		os.Exit(127)
+	}
+
+	fmt.Fprint(os.Stdout, res.Stdout)
+	fmt.Fprint(os.Stderr, res.Stderr)
+	os.Exit(res.ExitCode)
+}
+
+func logInvocation(command string, args []string) error {
+	path := os.Getenv(fakebin.LogEnv)
+	if path == "" {
+		return nil
+	}
+
+	dir, _ := os.Getwd()
+	line, err := json.Marshal(fakebin.Invocation{Command: command, Args: args, Dir: dir})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
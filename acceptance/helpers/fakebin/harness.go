@@ -0,0 +1,180 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fakebin provides scripted fake kubectl and helm executables, so
+// that the helpers and the suites' parsing logic can be tested without a
+// cluster.
+package fakebin
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const fakebinPkg = "github.com/aquarist-labs/s3gw/acceptance/helpers/fakebin/cmd/fakebin"
+
+// TB is the subset of testing.TB and GinkgoT() used by the Harness.
+type TB interface {
+	Helper()
+	Fatalf(format string, args ...interface{})
+	TempDir() string
+	Setenv(key, value string)
+}
+
+var (
+	buildOnce sync.Once
+	buildPath string
+	buildErr  error
+)
+
+// build compiles the fake executable once per test process.
+func build() (string, error) {
+	buildOnce.Do(func() {
+		dir, err := os.MkdirTemp("", "fakebin")
+		if err != nil {
+			buildErr = err
+			return
+		}
+		buildPath = filepath.Join(dir, "fakebin"+exeSuffix())
+		out, err := exec.Command("go", "build", "-o", buildPath, fakebinPkg).CombinedOutput()
+		if err != nil {
+			buildErr = errors.Wrapf(err, "building fakebin: %s", out)
+		}
+	})
+	return buildPath, buildErr
+}
+
+// Cleanup removes the fake executable built by the test process. Test
+// suites using the Harness call it once done, e.g. from an AfterSuite node.
+func Cleanup() error {
+	if buildPath == "" {
+		return nil
+	}
+	return os.RemoveAll(filepath.Dir(buildPath))
+}
+
+func exeSuffix() string {
+	if runtime.GOOS == "windows" {
+		return ".exe"
+	}
+	return ""
+}
+
+// Harness installs fake executables on PATH for the duration of a test.
+type Harness struct {
+	t          TB
+	dir        string
+	scriptPath string
+	logPath    string
+
+	mu     sync.Mutex
+	script Script
+}
+
+// New builds the fake executables named after commands, e.g. "kubectl" and
+// "helm", and puts them first on PATH until the end of the test.
+// Invocations not matching any rule fail with exit code 127.
+func New(t TB, commands ...string) *Harness {
+	t.Helper()
+
+	bin, err := build()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	h := &Harness{t: t, dir: t.TempDir()}
+	h.scriptPath = filepath.Join(h.dir, "script.json")
+	h.logPath = filepath.Join(h.dir, "invocations.log")
+
+	binDir := filepath.Join(h.dir, "bin")
+	if err := os.Mkdir(binDir, 0o755); err != nil {
+		t.Fatalf("creating fakebin dir: %v", err)
+	}
+	for _, command := range commands {
+		if err := copyFile(bin, filepath.Join(binDir, command+exeSuffix())); err != nil {
+			t.Fatalf("installing fake %s: %v", command, err)
+		}
+	}
+
+	if err := h.script.write(h.scriptPath); err != nil {
+		t.Fatalf("writing fakebin script: %v", err)
+	}
+
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv(ScriptEnv, h.scriptPath)
+	t.Setenv(LogEnv, h.logPath)
+
+	return h
+}
+
+// On programs command to answer with res when its space-joined arguments
+// match the regular expression pattern. Later rules take precedence.
+func (h *Harness) On(command, pattern string, res Response) *Harness {
+	h.t.Helper()
+
+	if _, err := regexp.Compile(pattern); err != nil {
+		h.t.Fatalf("invalid pattern %q: %v", pattern, err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.script.Rules = append(h.script.Rules, Rule{Command: command, Pattern: pattern, Response: res})
+	if err := h.script.write(h.scriptPath); err != nil {
+		h.t.Fatalf("writing fakebin script: %v", err)
+	}
+	return h
+}
+
+// Invocations returns the invocations of command so far, or of every fake
+// executable if command is empty.
+func (h *Harness) Invocations(command string) []Invocation {
+	h.t.Helper()
+
+	f, err := os.Open(h.logPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		h.t.Fatalf("reading fakebin log: %v", err)
+	}
+	defer f.Close()
+
+	var invocations []Invocation
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var i Invocation
+		if err := json.Unmarshal(scanner.Bytes(), &i); err != nil {
+			h.t.Fatalf("parsing fakebin log: %v", err)
+		}
+		if command == "" || i.Command == command {
+			invocations = append(invocations, i)
+		}
+	}
+	return invocations
+}
+
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0o755)
+}
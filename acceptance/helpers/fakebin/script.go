@@ -0,0 +1,88 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakebin
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	// ScriptEnv points the fake executables to the script of responses.
+	ScriptEnv = "FAKEBIN_SCRIPT"
+	// LogEnv points the fake executables to the invocations log.
+	LogEnv = "FAKEBIN_LOG"
+)
+
+// Response is what a fake executable prints and returns when invoked with
+// arguments matching a rule.
+type Response struct {
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exitCode"`
+}
+
+// Rule programs the Response of Command when the space-joined arguments
+// match Pattern.
+type Rule struct {
+	Command  string   `json:"command"`
+	Pattern  string   `json:"pattern"`
+	Response Response `json:"response"`
+}
+
+// Invocation is a single execution of a fake executable.
+type Invocation struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	Dir     string   `json:"dir"`
+}
+
+// Script is the set of rules the fake executables answer with.
+type Script struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Match returns the response of the most recently added rule matching the
+// invocation.
+func (s *Script) Match(command string, args []string) (Response, bool) {
+	joined := strings.Join(args, " ")
+	for i := len(s.Rules) - 1; i >= 0; i-- {
+		r := s.Rules[i]
+		if r.Command != command {
+			continue
+		}
+		if ok, err := regexp.MatchString(r.Pattern, joined); err == nil && ok {
+			return r.Response, true
+		}
+	}
+	return Response{}, false
+}
+
+// ReadScript reads the script at path.
+func ReadScript(path string) (*Script, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Script{}
+	return s, json.Unmarshal(data, s)
+}
+
+func (s *Script) write(path string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
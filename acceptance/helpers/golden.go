@@ -0,0 +1,350 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega/types"
+	"github.com/pkg/errors"
+)
+
+// GoldenDir is the directory golden snapshots are stored in, relative to the
+// suite directory. Snapshots are grouped by chart version.
+const GoldenDir = "golden"
+
+var updateGolden bool
+
+// RegisterGoldenFlags registers the -update-golden flag on fs. The suites
+// comparing golden snapshots register it on flag.CommandLine, so that it is
+// passed to the test binary after `--` on the ginkgo command line.
+func RegisterGoldenFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&updateGolden, "update-golden", false, "rewrite the golden snapshots instead of comparing against them")
+}
+
+// UpdatingGolden reports whether the suite runs with -update-golden.
+func UpdatingGolden() bool {
+	return updateGolden
+}
+
+// SetUpdatingGolden sets -update-golden, e.g. from the tests of a suite.
+func SetUpdatingGolden(update bool) {
+	updateGolden = update
+}
+
+// volatileFields are removed from snapshots at any depth, as they change
+// on every installation.
+var volatileFields = map[string]bool{
+	"uid":               true,
+	"resourceVersion":   true,
+	"generation":        true,
+	"creationTimestamp": true,
+	"deletionTimestamp": true,
+	"managedFields":     true,
+	"selfLink":          true,
+}
+
+// volatileAnnotations are removed from the metadata annotations of snapshots.
+var volatileAnnotations = []string{
+	"kubectl.kubernetes.io/last-applied-configuration",
+	"kubectl.kubernetes.io/restartedAt",
+}
+
+// NormalizeManifest returns a copy of the Kubernetes object obj without its
+// status and the fields set by the API server, see volatileFields.
+func NormalizeManifest(obj interface{}) (interface{}, error) {
+	node, err := ToJSONObject(obj)
+	if err != nil {
+		return nil, err
+	}
+	// work on a copy, ToJSONObject returns maps as they are
+	data, err := json.Marshal(node)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+
+	if m, ok := out.(map[string]interface{}); ok {
+		delete(m, "status")
+	}
+	return stripVolatile(out), nil
+}
+
+func stripVolatile(node interface{}) interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for k, v := range n {
+			if volatileFields[k] {
+				delete(n, k)
+				continue
+			}
+			if k == "metadata" {
+				stripVolatileAnnotations(v)
+			}
+			n[k] = stripVolatile(v)
+		}
+	case []interface{}:
+		for i, v := range n {
+			n[i] = stripVolatile(v)
+		}
+	}
+	return node
+}
+
+func stripVolatileAnnotations(metadata interface{}) {
+	m, _ := metadata.(map[string]interface{})
+	annotations, ok := m["annotations"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, a := range volatileAnnotations {
+		delete(annotations, a)
+	}
+	if len(annotations) == 0 {
+		delete(m, "annotations")
+	}
+}
+
+// Golden compares normalized Kubernetes objects with the snapshots stored
+// for a chart version.
+type Golden struct {
+	// Dir holds one JSON snapshot per object.
+	Dir string
+
+	replacements []goldenReplacement
+}
+
+type goldenReplacement struct {
+	re          *regexp.Regexp
+	placeholder string
+}
+
+// NewGolden returns the golden snapshots of the chart version.
+func NewGolden(version string) *Golden {
+	return &Golden{Dir: filepath.Join(GoldenDir, version)}
+}
+
+// Replace replaces value with placeholder in every string of the snapshots,
+// for values depending on the environment, e.g. the system domain.
+func (g *Golden) Replace(value, placeholder string) *Golden {
+	if value == "" {
+		return g
+	}
+	g.replacements = append(g.replacements, goldenReplacement{
+		re:          regexp.MustCompile(regexp.QuoteMeta(value)),
+		placeholder: placeholder,
+	})
+	return g
+}
+
+// StripNameSuffix removes the random suffix UniqueName appends to base.
+func (g *Golden) StripNameSuffix(base string) *Golden {
+	g.replacements = append(g.replacements, goldenReplacement{
+		re:          regexp.MustCompile(regexp.QuoteMeta(base) + nameSuffixPattern),
+		placeholder: base,
+	})
+	return g
+}
+
+// Available returns an error when there are no snapshots for the chart
+// version, unless they are being created with -update-golden. Specs labeled
+// Golden are left out with `--label-filter '!Golden'`.
+func (g *Golden) Available() error {
+	if UpdatingGolden() {
+		return nil
+	}
+	if _, err := os.Stat(g.Dir); os.IsNotExist(err) {
+		return errors.Errorf("no golden snapshots in %s, run the suite with -update-golden to create them", g.Dir)
+	}
+	return nil
+}
+
+// Path returns the snapshot file of the object name.
+func (g *Golden) Path(name string) string {
+	return filepath.Join(g.Dir, name+".json")
+}
+
+// Normalize returns obj as stored in its snapshot: see NormalizeManifest,
+// with the replacements applied to every string value.
+func (g *Golden) Normalize(obj interface{}) (interface{}, error) {
+	node, err := NormalizeManifest(obj)
+	if err != nil {
+		return nil, err
+	}
+	return g.replace(node), nil
+}
+
+func (g *Golden) replace(node interface{}) interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for k, v := range n {
+			n[k] = g.replace(v)
+		}
+	case []interface{}:
+		for i, v := range n {
+			n[i] = g.replace(v)
+		}
+	case string:
+		for _, r := range g.replacements {
+			n = r.re.ReplaceAllLiteralString(n, r.placeholder)
+		}
+		return n
+	}
+	return node
+}
+
+// MatchGolden succeeds if the normalized object matches the snapshot name of
+// g. With -update-golden the snapshot is rewritten instead and the matcher
+// always succeeds.
+func MatchGolden(g *Golden, name string) types.GomegaMatcher {
+	return &matchGoldenMatcher{golden: g, name: name}
+}
+
+type matchGoldenMatcher struct {
+	golden *Golden
+	name   string
+
+	diff []string
+}
+
+func (m *matchGoldenMatcher) Match(actual interface{}) (bool, error) {
+	m.diff = nil
+
+	live, err := m.golden.Normalize(actual)
+	if err != nil {
+		return false, err
+	}
+	path := m.golden.Path(m.name)
+
+	if UpdatingGolden() {
+		if err := writeGolden(path, live); err != nil {
+			return false, err
+		}
+		fmt.Fprintf(GinkgoWriter, "updated golden snapshot %s\n", path)
+		return true, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, errors.Errorf("golden snapshot %s does not exist, run the suite with -update-golden to create it", path)
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "reading golden snapshot")
+	}
+	var want interface{}
+	if err := json.Unmarshal(data, &want); err != nil {
+		return false, errors.Wrapf(err, "parsing golden snapshot %s", path)
+	}
+
+	m.diff = jsonDiff(nil, want, live, nil)
+	return len(m.diff) == 0, nil
+}
+
+func (m *matchGoldenMatcher) FailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected object to match golden snapshot %s (- golden, + live):\n%s\n"+
+		"Run the suite with -update-golden if the change is intentional.",
+		m.golden.Path(m.name), strings.Join(m.diff, "\n"))
+}
+
+func (m *matchGoldenMatcher) NegatedFailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected object not to match golden snapshot %s", m.golden.Path(m.name))
+}
+
+func writeGolden(path string, obj interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return errors.Wrap(err, "creating golden dir")
+	}
+	data, err := json.MarshalIndent(obj, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// jsonDiff appends to diff a line for every node that differs between want
+// and got, identified by its JSON path.
+func jsonDiff(path []pathElem, want, got interface{}, diff []string) []string {
+	switch w := want.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(w)+len(g))
+		for k := range w {
+			keys = append(keys, k)
+		}
+		for k := range g {
+			if _, ok := w[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			p := append(path[:len(path):len(path)], pathElem{key: k})
+			wv, inWant := w[k]
+			gv, inGot := g[k]
+			switch {
+			case !inGot:
+				diff = append(diff, fmt.Sprintf("- %s: %s", formatPath(p), compactJSON(wv)))
+			case !inWant:
+				diff = append(diff, fmt.Sprintf("+ %s: %s", formatPath(p), compactJSON(gv)))
+			default:
+				diff = jsonDiff(p, wv, gv, diff)
+			}
+		}
+		return diff
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(w) || i < len(g); i++ {
+			p := append(path[:len(path):len(path)], pathElem{index: i, isIndex: true})
+			switch {
+			case i >= len(g):
+				diff = append(diff, fmt.Sprintf("- %s: %s", formatPath(p), compactJSON(w[i])))
+			case i >= len(w):
+				diff = append(diff, fmt.Sprintf("+ %s: %s", formatPath(p), compactJSON(g[i])))
+			default:
+				diff = jsonDiff(p, w[i], g[i], diff)
+			}
+		}
+		return diff
+	}
+
+	if compactJSON(want) != compactJSON(got) {
+		p := formatPath(path)
+		diff = append(diff, fmt.Sprintf("- %s: %s", p, compactJSON(want)), fmt.Sprintf("+ %s: %s", p, compactJSON(got)))
+	}
+	return diff
+}
+
+func compactJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
@@ -0,0 +1,172 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const liveDeploymentJSON = `{
+  "metadata": {
+    "name": "s3gw-def-1k3x9q",
+    "namespace": "s3gw-def-12ab7c",
+    "uid": "0c6c7a8e-5d0c-4a59-9a4b-0c4a39a5d3f1",
+    "resourceVersion": "1234",
+    "generation": 1,
+    "creationTimestamp": "2023-06-01T10:00:00Z",
+    "managedFields": [{"manager": "helm"}],
+    "annotations": {
+      "deployment.kubernetes.io/revision": "1",
+      "kubectl.kubernetes.io/last-applied-configuration": "{}"
+    }
+  },
+  "spec": {
+    "template": {
+      "metadata": {"creationTimestamp": null},
+      "spec": {
+        "containers": [
+          {"name": "s3gw-def-1k3x9q", "image": "quay.io/s3gw/s3gw:v0.17.0", "args": ["--rgw-dns-name", "s3gw-def-1k3x9q-s3gw-def-12ab7c.local.example"]}
+        ]
+      }
+    }
+  },
+  "status": {"readyReplicas": 1}
+}`
+
+var _ = Describe("Golden", func() {
+	var golden *Golden
+
+	BeforeEach(func() {
+		golden = NewGolden("0.17.0").
+			Replace("local.example", "S3GW_SYSTEM_DOMAIN").
+			Replace(":v0.17.0", ":IMAGE_TAG").
+			StripNameSuffix("s3gw-def")
+		golden.Dir = GinkgoT().TempDir()
+	})
+
+	It("stores snapshots per chart version", func() {
+		Expect(NewGolden("0.17.0").Path("s3gw")).To(Equal("golden/0.17.0/s3gw.json"))
+	})
+
+	It("normalizes live objects", func() {
+		obj, err := golden.Normalize(liveDeploymentJSON)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(obj).ToNot(HaveJSONPath("status"))
+		for _, field := range []string{"uid", "resourceVersion", "generation", "creationTimestamp", "managedFields"} {
+			Expect(obj).ToNot(HaveJSONPath("metadata." + field))
+		}
+		Expect(obj).ToNot(HaveJSONPath("spec.template.metadata.creationTimestamp"))
+		Expect(obj).ToNot(HaveAnnotation("kubectl.kubernetes.io/last-applied-configuration"))
+		Expect(obj).To(HaveAnnotation("deployment.kubernetes.io/revision", "1"))
+
+		Expect(obj).To(HaveJSONPath("metadata.name", Equal("s3gw-def")))
+		Expect(obj).To(HaveJSONPath("metadata.namespace", Equal("s3gw-def")))
+		Expect(obj).To(HaveContainer("s3gw-def",
+			HaveImage("quay.io/s3gw/s3gw:IMAGE_TAG"),
+			HaveArgs("--rgw-dns-name", "s3gw-def-s3gw-def.S3GW_SYSTEM_DOMAIN"),
+		))
+	})
+
+	It("does not modify the live object", func() {
+		obj, err := ToJSONObject(liveDeploymentJSON)
+		Expect(err).ToNot(HaveOccurred())
+		live := obj.(map[string]interface{})
+
+		_, err = golden.Normalize(live)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(live).To(HaveKey("status"))
+		Expect(live).To(HaveJSONPath("metadata.name", Equal("s3gw-def-1k3x9q")))
+	})
+
+	It("requires the snapshots of the chart version", func() {
+		golden.Dir = filepath.Join(golden.Dir, "0.18.0")
+		Expect(golden.Available()).To(MatchError(ContainSubstring("no golden snapshots in " + golden.Dir)))
+
+		SetUpdatingGolden(true)
+		DeferCleanup(SetUpdatingGolden, false)
+		Expect(golden.Available()).To(Succeed())
+	})
+
+	It("registers -update-golden on the flag set of the suite", func() {
+		fs := flag.NewFlagSet("suite", flag.ContinueOnError)
+		RegisterGoldenFlags(fs)
+		DeferCleanup(SetUpdatingGolden, false)
+
+		Expect(fs.Parse([]string{"-update-golden"})).To(Succeed())
+		Expect(UpdatingGolden()).To(BeTrue())
+	})
+
+	When("updating the snapshots", func() {
+		BeforeEach(func() {
+			SetUpdatingGolden(true)
+			DeferCleanup(SetUpdatingGolden, false)
+		})
+
+		It("writes the normalized object", func() {
+			Expect(liveDeploymentJSON).To(MatchGolden(golden, "s3gw"))
+
+			data, err := os.ReadFile(golden.Path("s3gw"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(HaveJSONPath("metadata.name", Equal("s3gw-def")))
+			Expect(string(data)).ToNot(HaveJSONPath("status"))
+		})
+	})
+
+	When("comparing against the snapshots", func() {
+		BeforeEach(func() {
+			SetUpdatingGolden(true)
+			Expect(liveDeploymentJSON).To(MatchGolden(golden, "s3gw"))
+			SetUpdatingGolden(false)
+		})
+
+		It("ignores volatile fields and random names", func() {
+			other := strings.NewReplacer(
+				"123456", "987",
+				`"resourceVersion": "1234"`, `"resourceVersion": "5678"`,
+				`"readyReplicas": 1`, `"readyReplicas": 0`,
+			).Replace(liveDeploymentJSON)
+			Expect(other).To(MatchGolden(golden, "s3gw"))
+		})
+
+		It("prints a structured diff on mismatch", func() {
+			changed := strings.NewReplacer(
+				`"deployment.kubernetes.io/revision": "1"`, `"deployment.kubernetes.io/revision": "2"`,
+				`"--rgw-dns-name", `, ``,
+			).Replace(liveDeploymentJSON)
+
+			matcher := MatchGolden(golden, "s3gw")
+			success, err := matcher.Match(changed)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(success).To(BeFalse())
+
+			msg := matcher.FailureMessage(changed)
+			Expect(msg).To(ContainSubstring(`- metadata.annotations["deployment.kubernetes.io/revision"]: "1"`))
+			Expect(msg).To(ContainSubstring(`+ metadata.annotations["deployment.kubernetes.io/revision"]: "2"`))
+			Expect(msg).To(ContainSubstring(`+ spec.template.spec.containers[0].args[0]: "s3gw-def-s3gw-def.S3GW_SYSTEM_DOMAIN"`))
+			Expect(msg).To(ContainSubstring(`- spec.template.spec.containers[0].args[1]: "s3gw-def-s3gw-def.S3GW_SYSTEM_DOMAIN"`))
+			Expect(msg).To(ContainSubstring("-update-golden"))
+		})
+
+		It("fails on missing snapshots", func() {
+			_, err := MatchGolden(golden, "s3gw-ui").Match(liveDeploymentJSON)
+			Expect(err).To(MatchError(ContainSubstring("does not exist, run the suite with -update-golden")))
+		})
+	})
+})
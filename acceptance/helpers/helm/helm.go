@@ -0,0 +1,434 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package helm installs and upgrades the s3gw chart with the Helm SDK.
+// Its operations are audited, recorded and replayed like the kubectl and
+// helm commands of the suites, see helpers.RunFunc.
+package helm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aquarist-labs/s3gw/acceptance/helpers"
+	. "github.com/onsi/ginkgo/v2"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// Command is the command name of the operations in audit logs and cassettes.
+const Command = "helm-sdk"
+
+// DefaultTimeout bounds the operations waiting for the release resources,
+// like the helm CLI.
+var DefaultTimeout = 5 * time.Minute
+
+// Client runs helm operations in a namespace.
+type Client struct {
+	Namespace string
+	// Dir is the directory relative chart paths and values files are
+	// resolved against, like the working directory of the helm CLI.
+	Dir string
+
+	cfg      *action.Configuration
+	settings *cli.EnvSettings
+}
+
+// New returns a client for namespace on the cluster target of ctx, see
+// helpers.WithClusterTarget. Releases are stored as secrets, unless
+// HELM_DRIVER selects another driver.
+func New(ctx context.Context, namespace string) (*Client, error) {
+	target := helpers.ClusterTargetFrom(ctx)
+	settings := cli.New()
+	settings.KubeConfig = target.Kubeconfig
+	settings.KubeContext = target.Context
+	settings.SetNamespace(namespace)
+
+	cfg := &action.Configuration{}
+	if err := cfg.Init(settings.RESTClientGetter(), namespace, os.Getenv("HELM_DRIVER"), debugLog); err != nil {
+		return nil, errors.Wrap(err, "initializing helm")
+	}
+	return &Client{Namespace: namespace, cfg: cfg, settings: settings}, nil
+}
+
+// NewMemory returns a client storing releases in memory, whose resources
+// are not applied to any cluster. Clients sharing store see the same
+// releases; store is created if nil.
+func NewMemory(namespace string, store *driver.Memory) *Client {
+	if store == nil {
+		store = driver.NewMemory()
+	}
+	store.SetNamespace(namespace)
+
+	settings := cli.New()
+	settings.SetNamespace(namespace)
+	return &Client{
+		Namespace: namespace,
+		cfg: &action.Configuration{
+			Releases:     storage.Init(store),
+			KubeClient:   &kubefake.PrintingKubeClient{Out: io.Discard},
+			Capabilities: chartutil.DefaultCapabilities,
+			Log:          debugLog,
+		},
+		settings: settings,
+	}
+}
+
+// SetKubeVersion sets the Kubernetes version of the cluster simulated by a
+// memory client, v1.20.0 by default like `helm template`.
+func (c *Client) SetKubeVersion(version string) error {
+	kubeVersion, err := chartutil.ParseKubeVersion(version)
+	if err != nil {
+		return errors.Wrapf(err, "parsing Kubernetes version %q", version)
+	}
+	caps := chartutil.DefaultCapabilities.Copy()
+	if c.cfg.Capabilities != nil {
+		caps = c.cfg.Capabilities.Copy()
+	}
+	caps.KubeVersion = *kubeVersion
+	c.cfg.Capabilities = caps
+	return nil
+}
+
+func debugLog(format string, v ...interface{}) {
+	fmt.Fprintf(GinkgoWriter, "helm: "+format+"\n", v...)
+}
+
+// Release describes a release revision.
+type Release struct {
+	Name         string    `json:"name"`
+	Namespace    string    `json:"namespace"`
+	Revision     int       `json:"revision"`
+	Status       string    `json:"status"`
+	Chart        string    `json:"chart"`
+	ChartVersion string    `json:"chartVersion"`
+	AppVersion   string    `json:"appVersion"`
+	Updated      time.Time `json:"updated"`
+	Description  string    `json:"description"`
+}
+
+func newRelease(rel *release.Release) Release {
+	r := Release{Name: rel.Name, Namespace: rel.Namespace, Revision: rel.Version}
+	if rel.Info != nil {
+		r.Status = rel.Info.Status.String()
+		r.Updated = rel.Info.LastDeployed.Time
+		r.Description = rel.Info.Description
+	}
+	if rel.Chart != nil && rel.Chart.Metadata != nil {
+		r.Chart = rel.Chart.Metadata.Name
+		r.ChartVersion = rel.Chart.Metadata.Version
+		r.AppVersion = rel.Chart.Metadata.AppVersion
+	}
+	return r
+}
+
+type options struct {
+	wait            bool
+	timeout         time.Duration
+	version         string
+	createNamespace bool
+}
+
+// Option configures an operation.
+type Option func(*options)
+
+// WithWait waits for the release resources to be ready, or deleted when
+// uninstalling, like --wait.
+func WithWait() Option {
+	return func(o *options) {
+		o.wait = true
+	}
+}
+
+// WithTimeout bounds the wait for the release resources, DefaultTimeout by
+// default.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithVersion selects the chart version, when installing from a repository.
+func WithVersion(version string) Option {
+	return func(o *options) {
+		o.version = version
+	}
+}
+
+// WithCreateNamespace creates the namespace of the release when installing,
+// like --create-namespace.
+func WithCreateNamespace() Option {
+	return func(o *options) {
+		o.createNamespace = true
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{timeout: DefaultTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// timeoutWithin returns the timeout of o, bounded by the deadline of ctx,
+// for the actions that take no context.
+func (o options) timeoutWithin(ctx context.Context) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := time.Until(deadline); left < o.timeout {
+			return left
+		}
+	}
+	return o.timeout
+}
+
+// args returns the helm CLI flags equivalent to o, identifying the
+// operation in the audit log and cassettes.
+func (o options) args() []string {
+	var args []string
+	if o.version != "" {
+		args = append(args, "--version", o.version)
+	}
+	if o.createNamespace {
+		args = append(args, "--create-namespace")
+	}
+	if o.wait {
+		args = append(args, "--wait", "--timeout", o.timeout.String())
+	}
+	return args
+}
+
+// Install installs chart as the release name.
+func (c *Client) Install(ctx context.Context, name, chart string, values Values, opts ...Option) (*Release, error) {
+	o := newOptions(opts)
+	vals, valsArg, err := c.values(values)
+	if err != nil {
+		return nil, err
+	}
+
+	args := append([]string{"install", "-n", c.Namespace, name, chart}, o.args()...)
+	return c.runRelease(ctx, append(args, "--values", valsArg), func(ctx context.Context) (*release.Release, error) {
+		install := action.NewInstall(c.cfg)
+		install.Namespace = c.Namespace
+		install.ReleaseName = name
+		install.CreateNamespace = o.createNamespace
+		install.Wait = o.wait
+		install.Timeout = o.timeout
+		install.Version = o.version
+
+		chrt, err := c.loadChart(&install.ChartPathOptions, chart)
+		if err != nil {
+			return nil, err
+		}
+		return install.RunWithContext(ctx, chrt, vals)
+	})
+}
+
+// Upgrade upgrades the release name to chart. The values of the previous
+// revision are not reused.
+func (c *Client) Upgrade(ctx context.Context, name, chart string, values Values, opts ...Option) (*Release, error) {
+	o := newOptions(opts)
+	vals, valsArg, err := c.values(values)
+	if err != nil {
+		return nil, err
+	}
+
+	args := append([]string{"upgrade", "-n", c.Namespace, name, chart}, o.args()...)
+	return c.runRelease(ctx, append(args, "--values", valsArg), func(ctx context.Context) (*release.Release, error) {
+		upgrade := action.NewUpgrade(c.cfg)
+		upgrade.Namespace = c.Namespace
+		upgrade.Wait = o.wait
+		upgrade.Timeout = o.timeout
+		upgrade.Version = o.version
+
+		chrt, err := c.loadChart(&upgrade.ChartPathOptions, chart)
+		if err != nil {
+			return nil, err
+		}
+		return upgrade.RunWithContext(ctx, name, chrt, vals)
+	})
+}
+
+// Rollback rolls the release name back to revision, or to the previous
+// revision if revision is 0.
+func (c *Client) Rollback(ctx context.Context, name string, revision int, opts ...Option) error {
+	o := newOptions(opts)
+	args := append([]string{"rollback", "-n", c.Namespace, name, strconv.Itoa(revision)}, o.args()...)
+	_, err := helpers.RunFunc(ctx, Command, args, func(ctx context.Context) (string, error) {
+		// the rollback action takes no context
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		rollback := action.NewRollback(c.cfg)
+		rollback.Version = revision
+		rollback.Wait = o.wait
+		rollback.Timeout = o.timeoutWithin(ctx)
+		return "", rollback.Run(name)
+	})
+	return err
+}
+
+// Uninstall uninstalls the release name.
+func (c *Client) Uninstall(ctx context.Context, name string, opts ...Option) error {
+	o := newOptions(opts)
+	args := append([]string{"uninstall", "-n", c.Namespace, name}, o.args()...)
+	_, err := helpers.RunFunc(ctx, Command, args, func(ctx context.Context) (string, error) {
+		// the uninstall action takes no context
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		uninstall := action.NewUninstall(c.cfg)
+		uninstall.Wait = o.wait
+		uninstall.Timeout = o.timeoutWithin(ctx)
+		res, err := uninstall.Run(name)
+		if res != nil {
+			return res.Info, err
+		}
+		return "", err
+	})
+	return err
+}
+
+// History returns the revisions of the release name, oldest first.
+func (c *Client) History(ctx context.Context, name string) ([]Release, error) {
+	res, err := helpers.RunFunc(ctx, Command, []string{"history", "-n", c.Namespace, name}, func(ctx context.Context) (string, error) {
+		history := action.NewHistory(c.cfg)
+		history.Max = 256
+		rels, err := history.Run(name)
+		if err != nil {
+			return "", err
+		}
+
+		revisions := make([]Release, 0, len(rels))
+		for _, rel := range rels {
+			revisions = append(revisions, newRelease(rel))
+		}
+		out, err := json.Marshal(revisions)
+		return string(out), err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var revisions []Release
+	if err := json.Unmarshal([]byte(res.Stdout), &revisions); err != nil {
+		return nil, errors.Wrap(err, "parsing release history")
+	}
+	return revisions, nil
+}
+
+// GetValues returns the values set on the release name, merged with the
+// chart defaults if all is true.
+func (c *Client) GetValues(ctx context.Context, name string, all bool) (map[string]interface{}, error) {
+	args := []string{"get", "values", "-n", c.Namespace, name}
+	if all {
+		args = append(args, "--all")
+	}
+	res, err := helpers.RunFunc(ctx, Command, args, func(ctx context.Context) (string, error) {
+		get := action.NewGetValues(c.cfg)
+		get.AllValues = all
+		vals, err := get.Run(name)
+		if err != nil {
+			return "", err
+		}
+		out, err := json.Marshal(vals)
+		return string(out), err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	vals := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(res.Stdout), &vals); err != nil {
+		return nil, errors.Wrap(err, "parsing release values")
+	}
+	return vals, nil
+}
+
+// values returns the values passed to the chart, and their JSON encoding,
+// which is deterministic.
+func (c *Client) values(values Values) (map[string]interface{}, string, error) {
+	files := make([]string, 0, len(values.Files))
+	for _, f := range values.Files {
+		files = append(files, c.path(f))
+	}
+	values.Files = files
+
+	vals, err := values.Map()
+	if err != nil {
+		return nil, "", err
+	}
+	out, err := json.Marshal(vals)
+	if err != nil {
+		return nil, "", err
+	}
+	return vals, string(out), nil
+}
+
+// path resolves relative local paths against c.Dir.
+func (c *Client) path(p string) string {
+	if c.Dir == "" || filepath.IsAbs(p) || strings.Contains(p, "://") {
+		return p
+	}
+	if _, err := os.Stat(filepath.Join(c.Dir, p)); err != nil {
+		// e.g. a repo/chart reference
+		return p
+	}
+	return filepath.Join(c.Dir, p)
+}
+
+func (c *Client) loadChart(pathOptions *action.ChartPathOptions, ref string) (*chart.Chart, error) {
+	path, err := pathOptions.LocateChart(c.path(ref), c.settings)
+	if err != nil {
+		return nil, err
+	}
+	return loader.Load(path)
+}
+
+// runRelease runs fn as the operation args, returning the release it
+// creates.
+func (c *Client) runRelease(ctx context.Context, args []string, fn func(ctx context.Context) (*release.Release, error)) (*Release, error) {
+	res, err := helpers.RunFunc(ctx, Command, args, func(ctx context.Context) (string, error) {
+		rel, err := fn(ctx)
+		if rel == nil {
+			return "", err
+		}
+		out, merr := json.Marshal(newRelease(rel))
+		if merr != nil && err == nil {
+			err = merr
+		}
+		return string(out), err
+	})
+	if res.Stdout == "" {
+		return nil, err
+	}
+
+	rel := &Release{}
+	if uerr := json.Unmarshal([]byte(res.Stdout), rel); uerr != nil && err == nil {
+		err = errors.Wrap(uerr, "parsing release")
+	}
+	return rel, err
+}
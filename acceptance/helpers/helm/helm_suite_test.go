@@ -9,13 +9,16 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package helpers
+package helm_test
 
 import (
-	"strconv"
-	"time"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
 )
 
-func NanoSecName(base string) string {
-	return base + strconv.Itoa(int(time.Now().Nanosecond()))
+func TestHelm(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Helm Suite")
 }
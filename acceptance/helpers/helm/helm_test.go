@@ -0,0 +1,281 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helm_test
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/aquarist-labs/s3gw/acceptance/helpers"
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers/helm"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+)
+
+var _ = Describe("Values", func() {
+	It("sets the typed values", func() {
+		vals, err := Values{
+			PublicDomain: "local.example",
+			ImageTag:     "v0.17.0",
+			UI:           UIValues{PublicDomain: "local.example"},
+			Cosi:         CosiValues{Enabled: Bool(true), Driver: ImageValues{ImageTag: "v0.17.0"}},
+			StorageClass: StorageClassValues{Name: "local-path"},
+		}.Map()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(vals).To(Equal(map[string]interface{}{
+			"publicDomain": "local.example",
+			"imageTag":     "v0.17.0",
+			"ui":           map[string]interface{}{"publicDomain": "local.example"},
+			"cosi": map[string]interface{}{
+				"enabled": true,
+				"driver":  map[string]interface{}{"imageTag": "v0.17.0"},
+			},
+			"storageClass": map[string]interface{}{"name": "local-path"},
+		}))
+	})
+
+	It("applies the files first and the flags last", func() {
+		values := Values{UI: UIValues{PublicDomain: "local.example"}}
+		Expect(values.ParseArgs([]string{
+			"--set", "ui.replicas=1",
+			"-f", "testdata/extra-values.yaml",
+			"--set-string=ui.replicas=2",
+			"--set-json", `ui.tolerations=[{"key":"a"}]`,
+			"",
+		})).To(Succeed())
+
+		vals, err := values.Map()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vals).To(Equal(map[string]interface{}{
+			"imageTag": "from-file",
+			"ui": map[string]interface{}{
+				"publicDomain": "local.example",
+				"imageTag":     "from-file",
+				"replicas":     "2",
+				"tolerations":  []interface{}{map[string]interface{}{"key": "a"}},
+			},
+		}))
+	})
+
+	It("splits the extra arguments like a shell", func() {
+		values := Values{}
+		Expect(values.ParseExtraArgs(`--set 'ui.title=My s3gw' --set-json "tags=[\"a b\"]" -f a.yaml,b.yaml`)).To(Succeed())
+		Expect(values.Set).To(Equal([]string{"ui.title=My s3gw"}))
+		Expect(values.SetJSON).To(Equal([]string{`tags=["a b"]`}))
+		Expect(values.Files).To(Equal([]string{"a.yaml", "b.yaml"}))
+
+		Expect(values.ParseExtraArgs(`--set "a=b`)).To(MatchError(ContainSubstring("unterminated double quote")))
+	})
+
+	It("rejects unsupported arguments", func() {
+		values := Values{}
+		Expect(values.ParseArgs([]string{"--namespace", "other"})).To(MatchError(
+			`unsupported helm argument "--namespace", only -f/--values, --set, --set-string and --set-json are accepted`))
+		Expect(values.ParseArgs([]string{"--timeout=10m"})).To(MatchError(ContainSubstring(`unsupported helm argument "--timeout=10m"`)))
+		Expect(values.ParseArgs([]string{"--set"})).To(MatchError(`helm argument "--set" needs a value`))
+	})
+
+	It("rejects arguments overriding the values set by the suite", func() {
+		values := Values{ImageTag: "v0.17.0", UI: UIValues{PublicDomain: "local.example"}, Set: []string{"ui.enabled=false"}}
+		Expect(values.ParseArgs([]string{"--set", "logLevel=10,imageTag=v0.18.0"})).To(MatchError(
+			`helm argument "--set logLevel=10,imageTag=v0.18.0" overrides imageTag, already set by the suite`))
+		Expect(values.ParseArgs([]string{"--set-json", `ui={"publicDomain":"other"}`})).To(MatchError(
+			ContainSubstring("overrides ui.publicDomain")))
+		Expect(values.ParseArgs([]string{"--set-string", "ui.enabled=true"})).To(MatchError(
+			ContainSubstring("overrides ui.enabled")))
+		Expect(values.ParseArgs([]string{"--set", "ui.imageTag=v0.18.0"})).To(Succeed())
+
+		Expect(values.ParseArgs([]string{"-f", "testdata/extra-values.yaml"})).To(Succeed())
+		_, err := values.Map()
+		Expect(err).To(MatchError("values file testdata/extra-values.yaml overrides imageTag, already set by the suite"))
+	})
+
+	It("keeps the booleans set to false by the suite", func() {
+		values := Values{Cosi: CosiValues{Enabled: Bool(false)}}
+		vals, err := values.Map()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vals).To(Equal(map[string]interface{}{"cosi": map[string]interface{}{"enabled": false}}))
+
+		Expect(values.ParseArgs([]string{"--set", "cosi.enabled=true"})).To(MatchError(
+			`helm argument "--set cosi.enabled=true" overrides cosi.enabled, already set by the suite`))
+		Expect((&Values{}).ParseArgs([]string{"--set", "cosi.enabled=true"})).To(Succeed())
+	})
+})
+
+var _ = Describe("Client", func() {
+	const chart = "testdata/s3gw"
+	var client *Client
+
+	BeforeEach(func() {
+		client = NewMemory("s3gw-def", nil)
+	})
+
+	It("manages the release lifecycle", func(ctx SpecContext) {
+		rel, err := client.Install(ctx, "s3gw", chart, Values{PublicDomain: "local.example"}, WithWait())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*rel).To(MatchFields(IgnoreExtras, Fields{
+			"Name":         Equal("s3gw"),
+			"Namespace":    Equal("s3gw-def"),
+			"Revision":     Equal(1),
+			"Status":       Equal("deployed"),
+			"Chart":        Equal("s3gw"),
+			"ChartVersion": Equal("0.17.0"),
+		}))
+
+		vals, err := client.GetValues(ctx, "s3gw", false)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vals).To(Equal(map[string]interface{}{"publicDomain": "local.example"}))
+
+		vals, err = client.GetValues(ctx, "s3gw", true)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vals).To(HaveKeyWithValue("imageTag", "latest"))
+
+		rel, err = client.Upgrade(ctx, "s3gw", chart, Values{ImageTag: "v0.18.0"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rel.Revision).To(Equal(2))
+
+		Expect(client.Rollback(ctx, "s3gw", 1)).To(Succeed())
+
+		history, err := client.History(ctx, "s3gw")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(history).To(HaveExactElements(
+			HaveField("Status", "superseded"),
+			HaveField("Status", "superseded"),
+			And(HaveField("Status", "deployed"), HaveField("Description", "Rollback to 1")),
+		))
+
+		Expect(client.Uninstall(ctx, "s3gw")).To(Succeed())
+		_, err = client.History(ctx, "s3gw")
+		Expect(err).To(MatchError(ContainSubstring("release: not found")))
+	})
+
+	It("does not roll back or uninstall once the context is done", func(ctx SpecContext) {
+		_, err := client.Install(ctx, "s3gw", chart, Values{})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = client.Upgrade(ctx, "s3gw", chart, Values{ImageTag: "v0.18.0"})
+		Expect(err).ToNot(HaveOccurred())
+
+		done, cancel := context.WithCancel(ctx)
+		cancel()
+		Expect(client.Rollback(done, "s3gw", 1)).To(MatchError(context.Canceled))
+		Expect(client.Uninstall(done, "s3gw")).To(MatchError(context.Canceled))
+
+		history, err := client.History(ctx, "s3gw")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(history).To(HaveLen(2))
+		Expect(history[1].Status).To(Equal("deployed"))
+	})
+
+	It("resolves relative paths against its directory", func(ctx SpecContext) {
+		client.Dir = "testdata"
+
+		values := Values{Files: []string{"extra-values.yaml"}}
+		rel, err := client.Install(ctx, "s3gw", "s3gw", values)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rel.Revision).To(Equal(1))
+
+		vals, err := client.GetValues(ctx, "s3gw", false)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vals).To(HaveKeyWithValue("imageTag", "from-file"))
+	})
+
+	It("fails to install a release twice", func(ctx SpecContext) {
+		_, err := client.Install(ctx, "s3gw", chart, Values{})
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = client.Install(ctx, "s3gw", chart, Values{})
+		Expect(err).To(MatchError(ContainSubstring("cannot re-use a name that is still in use")))
+	})
+
+	It("renders the chart without a cluster", func(ctx SpecContext) {
+		objs, err := client.Render(ctx, "s3gw", chart, Values{Cosi: CosiValues{Enabled: Bool(true)}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(objs).To(HaveLen(3))
+
+		meta := func(obj interface{}) map[string]interface{} {
+			return obj.(map[string]interface{})["metadata"].(map[string]interface{})
+		}
+		for _, obj := range objs {
+			Expect(meta(obj)).To(And(
+				HaveKeyWithValue("labels", HaveKeyWithValue("app.kubernetes.io/managed-by", "Helm")),
+				HaveKeyWithValue("annotations", And(
+					HaveKeyWithValue("meta.helm.sh/release-name", "s3gw"),
+					HaveKeyWithValue("meta.helm.sh/release-namespace", "s3gw-def"),
+				)),
+			))
+		}
+		Expect(objs).To(ContainElement(And(
+			HaveKeyWithValue("kind", "Service"),
+			HaveKeyWithValue("metadata", HaveKeyWithValue("namespace", "s3gw-def")),
+		)))
+		Expect(objs).To(ContainElement(And(
+			HaveKeyWithValue("kind", "BucketClass"),
+			HaveKeyWithValue("metadata", Not(HaveKey("namespace"))),
+		)))
+
+		// nothing is installed
+		_, err = client.History(ctx, "s3gw")
+		Expect(err).To(MatchError(ContainSubstring("release: not found")))
+	})
+
+	It("renders the chart with the capabilities of the cluster", func(ctx SpecContext) {
+		deployment := func() interface{} {
+			objs, err := client.Render(ctx, "s3gw", chart, Values{})
+			Expect(err).ToNot(HaveOccurred())
+			d, err := helpers.FindObject(objs, "Deployment", "s3gw-def", "s3gw")
+			Expect(err).ToNot(HaveOccurred())
+			return d
+		}
+
+		old := deployment()
+		Expect(old).ToNot(HaveKeyWithValue("spec", HaveKeyWithValue("template",
+			HaveKeyWithValue("spec", HaveKey("securityContext")))))
+
+		Expect(client.SetKubeVersion("v1.27.3")).To(Succeed())
+		current := deployment()
+		Expect(current).To(HaveKeyWithValue("spec", HaveKeyWithValue("template",
+			HaveKeyWithValue("spec", HaveKey("securityContext")))))
+
+		// the same chart rolls out a new revision on a newer cluster
+		changed, err := helpers.PodTemplateChanged(old, current)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changed).To(BeTrue())
+
+		Expect(client.SetKubeVersion("latest")).To(MatchError(ContainSubstring(`parsing Kubernetes version "latest"`)))
+	})
+
+	It("records the operations in the cassette", func(ctx SpecContext) {
+		path := filepath.Join(GinkgoT().TempDir(), "spec.json")
+
+		cassette, err := helpers.NewCassette(path, helpers.CassetteRecord)
+		Expect(err).ToNot(HaveOccurred())
+		helpers.InsertCassette(cassette)
+		_, err = client.Install(ctx, "s3gw", chart, Values{ImageTag: "v0.17.0"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(helpers.EjectCassette()).To(Succeed())
+		Expect(cassette.Interactions).To(HaveExactElements(And(
+			HaveField("Command", Command),
+			HaveField("Args", []string{"install", "-n", "s3gw-def", "s3gw", chart, "--values", `{"imageTag":"v0.17.0"}`}),
+		)))
+
+		// the release is not installed again, the recorded one is returned
+		cassette, err = helpers.NewCassette(path, helpers.CassetteReplay)
+		Expect(err).ToNot(HaveOccurred())
+		helpers.InsertCassette(cassette)
+		rel, err := client.Install(ctx, "s3gw", chart, Values{ImageTag: "v0.17.0"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rel.Revision).To(Equal(1))
+		Expect(helpers.EjectCassette()).To(Succeed())
+	})
+})
@@ -0,0 +1,251 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helm
+
+import (
+	"os"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	"github.com/pkg/errors"
+)
+
+// MatrixModeEnv selects the combinations tested by a Matrix, see
+// MatrixModeFromEnv.
+const MatrixModeEnv = "S3GW_MATRIX"
+
+// MatrixMode selects the combinations of a Matrix.
+type MatrixMode string
+
+const (
+	// MatrixPairwise tests every pair of levels of two dimensions at least
+	// once, with far fewer combinations than MatrixFull.
+	MatrixPairwise MatrixMode = "pairwise"
+	// MatrixFull tests the cartesian product of the dimensions.
+	MatrixFull MatrixMode = "full"
+)
+
+// MatrixModeFromEnv returns the mode selected by MatrixModeEnv, pairwise by
+// default.
+func MatrixModeFromEnv() (MatrixMode, error) {
+	switch mode := MatrixMode(os.Getenv(MatrixModeEnv)); mode {
+	case "":
+		return MatrixPairwise, nil
+	case MatrixPairwise, MatrixFull:
+		return mode, nil
+	default:
+		return "", errors.Errorf("invalid %s %q, expected %q or %q", MatrixModeEnv, mode, MatrixPairwise, MatrixFull)
+	}
+}
+
+// Resource is an object created by a release. Its Name may refer to the
+// release and namespace names as {release} and {namespace}.
+type Resource struct {
+	Kind string
+	Name string
+}
+
+// Expand returns r with the release and namespace names substituted.
+func (r Resource) Expand(releaseName, namespace string) Resource {
+	name := strings.NewReplacer("{release}", releaseName, "{namespace}", namespace).Replace(r.Name)
+	return Resource{Kind: r.Kind, Name: name}
+}
+
+func (r Resource) String() string {
+	return r.Kind + "/" + r.Name
+}
+
+// Dimension is a chart setting varied by a Matrix.
+type Dimension struct {
+	Name   string
+	Levels []Level
+}
+
+// Level is one setting of a Dimension.
+type Level struct {
+	Name string
+	// Set holds the values of the level, as passed to helm with --set.
+	Set []string
+	// Present and Absent are the resources the chart must and must not
+	// create with the level.
+	Present []Resource
+	Absent  []Resource
+}
+
+// Matrix generates the chart configurations of a table of specs from a
+// declarative list of dimensions.
+type Matrix struct {
+	Dimensions []Dimension
+	// Present holds the resources created by every configuration.
+	Present []Resource
+}
+
+// Combination is a configuration of a Matrix: one level per dimension.
+type Combination struct {
+	matrix *Matrix
+	levels []int
+}
+
+// Name identifies the combination, e.g. `cosi=on ui=off`.
+func (c Combination) Name() string {
+	parts := make([]string, len(c.levels))
+	for i, l := range c.levels {
+		d := c.matrix.Dimensions[i]
+		parts[i] = d.Name + "=" + d.Levels[l].Name
+	}
+	return strings.Join(parts, " ")
+}
+
+// Level returns the name of the level of dimension, empty if the matrix has
+// no such dimension.
+func (c Combination) Level(dimension string) string {
+	for i, d := range c.matrix.Dimensions {
+		if d.Name == dimension {
+			return d.Levels[c.levels[i]].Name
+		}
+	}
+	return ""
+}
+
+// Apply adds the values of the combination to v. They are applied as --set
+// flags, after the typed values.
+func (c Combination) Apply(v *Values) {
+	for _, l := range c.eachLevel() {
+		v.Set = append(v.Set, l.Set...)
+	}
+}
+
+// Present returns the resources the release must have.
+func (c Combination) Present(releaseName, namespace string) []Resource {
+	resources := expand(c.matrix.Present, releaseName, namespace)
+	for _, l := range c.eachLevel() {
+		resources = append(resources, expand(l.Present, releaseName, namespace)...)
+	}
+	return resources
+}
+
+// Absent returns the resources the release must not have.
+func (c Combination) Absent(releaseName, namespace string) []Resource {
+	var resources []Resource
+	for _, l := range c.eachLevel() {
+		resources = append(resources, expand(l.Absent, releaseName, namespace)...)
+	}
+	return resources
+}
+
+func (c Combination) eachLevel() []Level {
+	levels := make([]Level, len(c.levels))
+	for i, l := range c.levels {
+		levels[i] = c.matrix.Dimensions[i].Levels[l]
+	}
+	return levels
+}
+
+func expand(resources []Resource, releaseName, namespace string) []Resource {
+	out := make([]Resource, len(resources))
+	for i, r := range resources {
+		out[i] = r.Expand(releaseName, namespace)
+	}
+	return out
+}
+
+// Combinations returns the combinations selected by mode.
+func (m *Matrix) Combinations(mode MatrixMode) []Combination {
+	if mode == MatrixFull {
+		return m.Full()
+	}
+	return m.Pairwise()
+}
+
+// Full returns the cartesian product of the dimensions, the last dimension
+// varying fastest.
+func (m *Matrix) Full() []Combination {
+	combinations := []Combination{{matrix: m}}
+	for _, d := range m.Dimensions {
+		var next []Combination
+		for _, c := range combinations {
+			for l := range d.Levels {
+				levels := append(append([]int(nil), c.levels...), l)
+				next = append(next, Combination{matrix: m, levels: levels})
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
+
+// Pairwise returns combinations covering every pair of levels of two
+// dimensions. They are picked greedily from the full product, the one
+// covering the most uncovered pairs first, so the result is deterministic.
+func (m *Matrix) Pairwise() []Combination {
+	type pair struct{ d1, l1, d2, l2 int }
+	pairs := func(c Combination) []pair {
+		var out []pair
+		for i := range c.levels {
+			for j := i + 1; j < len(c.levels); j++ {
+				out = append(out, pair{i, c.levels[i], j, c.levels[j]})
+			}
+		}
+		return out
+	}
+
+	candidates := m.Full()
+	uncovered := map[pair]bool{}
+	for _, c := range candidates {
+		for _, p := range pairs(c) {
+			uncovered[p] = true
+		}
+	}
+	if len(uncovered) == 0 {
+		// fewer than two dimensions: every combination is needed
+		return candidates
+	}
+
+	var out []Combination
+	for len(uncovered) > 0 {
+		best, bestCount := 0, -1
+		for i, c := range candidates {
+			count := 0
+			for _, p := range pairs(c) {
+				if uncovered[p] {
+					count++
+				}
+			}
+			if count > bestCount {
+				best, bestCount = i, count
+			}
+		}
+		for _, p := range pairs(candidates[best]) {
+			delete(uncovered, p)
+		}
+		out = append(out, candidates[best])
+		candidates = append(candidates[:best:best], candidates[best+1:]...)
+	}
+	return out
+}
+
+// Entries returns a table entry per combination selected by mode, named
+// after the combination. The parameters of an entry are the combination
+// followed by the ones returned by params, e.g. the names of its release and
+// namespace. params is called while the spec tree is built, so it may call
+// helpers.UniqueName.
+func (m *Matrix) Entries(mode MatrixMode, params func(c Combination) []interface{}) []TableEntry {
+	var entries []TableEntry
+	for _, c := range m.Combinations(mode) {
+		args := []interface{}{c}
+		if params != nil {
+			args = append(args, params(c)...)
+		}
+		entries = append(entries, Entry(c.Name(), args...))
+	}
+	return entries
+}
@@ -0,0 +1,119 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helm_test
+
+import (
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers/helm"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Matrix", func() {
+	onOff := func(name, key string, resource Resource) Dimension {
+		return Dimension{Name: name, Levels: []Level{
+			{Name: "on", Set: []string{key + "=true"}, Present: []Resource{resource}},
+			{Name: "off", Set: []string{key + "=false"}, Absent: []Resource{resource}},
+		}}
+	}
+
+	matrix := &Matrix{
+		Dimensions: []Dimension{
+			onOff("cosi", "cosi.enabled", Resource{"Deployment", "{release}-objectstorage-provisioner"}),
+			onOff("ui", "ui.enabled", Resource{"Deployment", "{release}-ui"}),
+			{Name: "log", Levels: []Level{
+				{Name: "1", Set: []string{"logLevel=1"}},
+				{Name: "10", Set: []string{"logLevel=10"}},
+				{Name: "20", Set: []string{"logLevel=20"}},
+			}},
+			{Name: "storage", Levels: []Level{
+				{Name: "default"},
+				{Name: "local-path", Set: []string{"storageClass.name=local-path"}},
+			}},
+		},
+		Present: []Resource{{"Secret", "{release}-{namespace}-creds"}},
+	}
+
+	names := func(combinations []Combination) []string {
+		var out []string
+		for _, c := range combinations {
+			out = append(out, c.Name())
+		}
+		return out
+	}
+
+	It("generates the full product", func() {
+		full := matrix.Full()
+		Expect(full).To(HaveLen(2 * 2 * 3 * 2))
+		Expect(full[0].Name()).To(Equal("cosi=on ui=on log=1 storage=default"))
+		Expect(full[1].Name()).To(Equal("cosi=on ui=on log=1 storage=local-path"))
+		Expect(names(full)).To(HaveLen(len(full)))
+		Expect(matrix.Combinations(MatrixFull)).To(HaveLen(len(full)))
+	})
+
+	It("covers every pair of levels pairwise", func() {
+		pairwise := matrix.Pairwise()
+		Expect(len(pairwise)).To(BeNumerically("<", len(matrix.Full())))
+		Expect(len(pairwise)).To(BeNumerically(">=", 3*2))
+		Expect(names(pairwise)).To(Equal(names(matrix.Pairwise())))
+
+		for i, d1 := range matrix.Dimensions {
+			for _, d2 := range matrix.Dimensions[i+1:] {
+				for _, l1 := range d1.Levels {
+					for _, l2 := range d2.Levels {
+						Expect(pairwise).To(ContainElement(WithTransform(func(c Combination) bool {
+							return c.Level(d1.Name) == l1.Name && c.Level(d2.Name) == l2.Name
+						}, BeTrue())), "%s=%s %s=%s", d1.Name, l1.Name, d2.Name, l2.Name)
+					}
+				}
+			}
+		}
+	})
+
+	It("returns every level of a single dimension", func() {
+		single := &Matrix{Dimensions: matrix.Dimensions[2:3]}
+		Expect(names(single.Pairwise())).To(Equal([]string{"log=1", "log=10", "log=20"}))
+	})
+
+	It("applies the values and expands the resources", func() {
+		c := matrix.Full()[len(matrix.Full())-1]
+		Expect(c.Name()).To(Equal("cosi=off ui=off log=20 storage=local-path"))
+
+		values := Values{Set: []string{"publicDomain=local"}}
+		c.Apply(&values)
+		Expect(values.Set).To(Equal([]string{
+			"publicDomain=local", "cosi.enabled=false", "ui.enabled=false", "logLevel=20", "storageClass.name=local-path",
+		}))
+
+		Expect(c.Present("s3gw", "s3gw-mx")).To(Equal([]Resource{{"Secret", "s3gw-s3gw-mx-creds"}}))
+		Expect(c.Absent("s3gw", "s3gw-mx")).To(Equal([]Resource{
+			{"Deployment", "s3gw-objectstorage-provisioner"},
+			{"Deployment", "s3gw-ui"},
+		}))
+	})
+
+	It("selects the mode from the environment", func() {
+		GinkgoT().Setenv(MatrixModeEnv, "")
+		Expect(MatrixModeFromEnv()).To(Equal(MatrixPairwise))
+		GinkgoT().Setenv(MatrixModeEnv, "full")
+		Expect(MatrixModeFromEnv()).To(Equal(MatrixFull))
+		GinkgoT().Setenv(MatrixModeEnv, "some")
+		_, err := MatrixModeFromEnv()
+		Expect(err).To(MatchError(`invalid S3GW_MATRIX "some", expected "pairwise" or "full"`))
+	})
+
+	It("generates a table entry per combination", func() {
+		entries := matrix.Entries(MatrixPairwise, func(c Combination) []interface{} {
+			return []interface{}{"s3gw-mx", "s3gw"}
+		})
+		Expect(entries).To(HaveLen(len(matrix.Pairwise())))
+	})
+})
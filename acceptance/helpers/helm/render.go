@@ -0,0 +1,192 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helm
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/aquarist-labs/s3gw/acceptance/helpers"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/yaml"
+)
+
+// clusterScopedKinds are not put in the release namespace by Render.
+var clusterScopedKinds = map[string]bool{
+	"APIService":                     true,
+	"BucketAccessClass":              true,
+	"BucketClass":                    true,
+	"ClusterRole":                    true,
+	"ClusterRoleBinding":             true,
+	"CustomResourceDefinition":       true,
+	"IngressClass":                   true,
+	"MutatingWebhookConfiguration":   true,
+	"Namespace":                      true,
+	"PersistentVolume":               true,
+	"PriorityClass":                  true,
+	"StorageClass":                   true,
+	"ValidatingWebhookConfiguration": true,
+}
+
+// Render renders chart as Install would install it as the release name,
+// without applying it, like `helm template`. The templates see the
+// capabilities of the cluster of the client, e.g. its Kubernetes version,
+// or those set on a memory client, see SetKubeVersion. Like with
+// `helm template`, lookup finds no objects. The objects of the manifest are
+// returned as helm applies them: in the client namespace unless cluster
+// scoped, and labeled and annotated as managed by the release. Hooks are
+// left out. Like the other operations, renderings are recorded and replayed.
+func (c *Client) Render(ctx context.Context, name, chart string, values Values, opts ...Option) ([]interface{}, error) {
+	o := newOptions(opts)
+	vals, valsArg, err := c.values(values)
+	if err != nil {
+		return nil, err
+	}
+
+	args := append([]string{"template", "-n", c.Namespace, name, chart}, o.args()...)
+	res, err := helpers.RunFunc(ctx, Command, append(args, "--values", valsArg), func(ctx context.Context) (string, error) {
+		objs, err := c.render(ctx, name, chart, vals, o)
+		if err != nil {
+			return "", err
+		}
+		out, err := json.Marshal(objs)
+		return string(out), err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var objs []interface{}
+	if err := json.Unmarshal([]byte(res.Stdout), &objs); err != nil {
+		return nil, errors.Wrap(err, "parsing rendered objects")
+	}
+	return objs, nil
+}
+
+func (c *Client) render(ctx context.Context, name, chart string, vals map[string]interface{}, o options) ([]interface{}, error) {
+	caps, err := c.capabilities()
+	if err != nil {
+		return nil, err
+	}
+
+	// a client only install replaces the kube client and the storage of
+	// its configuration
+	install := action.NewInstall(&action.Configuration{Log: debugLog})
+	install.DryRun = true
+	install.ClientOnly = true
+	install.Replace = true
+	install.IncludeCRDs = true
+	install.Namespace = c.Namespace
+	install.ReleaseName = name
+	install.Version = o.version
+	install.KubeVersion = &caps.KubeVersion
+	install.APIVersions = caps.APIVersions
+
+	chrt, err := c.loadChart(&install.ChartPathOptions, chart)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := install.RunWithContext(ctx, chrt, vals)
+	if err != nil {
+		return nil, errors.Wrap(err, "rendering chart")
+	}
+
+	manifests := releaseutil.SplitManifests(rel.Manifest)
+	keys := make([]string, 0, len(manifests))
+	for k := range manifests {
+		keys = append(keys, k)
+	}
+	sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+
+	var objs []interface{}
+	for _, k := range keys {
+		if strings.TrimSpace(manifests[k]) == "" {
+			continue
+		}
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal([]byte(manifests[k]), &obj); err != nil {
+			return nil, errors.Wrapf(err, "parsing rendered manifest %s", k)
+		}
+		if obj == nil {
+			continue
+		}
+		c.setReleaseMetadata(name, obj)
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+// capabilities returns the capabilities of the cluster of the client, like
+// helm does when installing, or the simulated ones of a memory client.
+func (c *Client) capabilities() (*chartutil.Capabilities, error) {
+	if c.cfg.Capabilities != nil {
+		return c.cfg.Capabilities, nil
+	}
+
+	dc, err := c.cfg.RESTClientGetter.ToDiscoveryClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "getting the discovery client")
+	}
+	dc.Invalidate()
+	kubeVersion, err := dc.ServerVersion()
+	if err != nil {
+		return nil, errors.Wrap(err, "getting the Kubernetes version")
+	}
+	// an orphaned API service fails the discovery of its group only
+	apiVersions, err := action.GetVersionSet(dc)
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, errors.Wrap(err, "getting the API versions")
+	}
+
+	c.cfg.Capabilities = &chartutil.Capabilities{
+		APIVersions: apiVersions,
+		KubeVersion: chartutil.KubeVersion{
+			Version: kubeVersion.GitVersion,
+			Major:   kubeVersion.Major,
+			Minor:   kubeVersion.Minor,
+		},
+		HelmVersion: chartutil.DefaultCapabilities.HelmVersion,
+	}
+	return c.cfg.Capabilities, nil
+}
+
+// setReleaseMetadata does what helm does to the objects it applies.
+func (c *Client) setReleaseMetadata(name string, obj map[string]interface{}) {
+	metadata, ok := obj["metadata"].(map[string]interface{})
+	if !ok {
+		metadata = map[string]interface{}{}
+		obj["metadata"] = metadata
+	}
+	if kind, _ := obj["kind"].(string); !clusterScopedKinds[kind] {
+		if ns, _ := metadata["namespace"].(string); ns == "" {
+			metadata["namespace"] = c.Namespace
+		}
+	}
+
+	set := func(field, key, value string) {
+		m, ok := metadata[field].(map[string]interface{})
+		if !ok {
+			m = map[string]interface{}{}
+			metadata[field] = m
+		}
+		m[key] = value
+	}
+	set("labels", "app.kubernetes.io/managed-by", "Helm")
+	set("annotations", "meta.helm.sh/release-name", name)
+	set("annotations", "meta.helm.sh/release-namespace", c.Namespace)
+}
@@ -0,0 +1,305 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helm
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/aquarist-labs/s3gw/acceptance/helpers"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/strvals"
+)
+
+// Values are the s3gw chart values set by the suites. Empty fields are left
+// to the chart defaults.
+type Values struct {
+	PublicDomain string
+	ImageTag     string
+	UI           UIValues
+	Cosi         CosiValues
+	StorageClass StorageClassValues
+
+	// Files, Set, SetString and SetJSON hold additional values as passed to
+	// helm with --values, --set, --set-string and --set-json. Files are
+	// applied first, the flags last. None of them may set the typed values.
+	Files     []string
+	Set       []string
+	SetString []string
+	SetJSON   []string
+}
+
+type UIValues struct {
+	PublicDomain string
+	ImageTag     string
+}
+
+type CosiValues struct {
+	// Enabled is left to the chart default if nil. Set to false, it still
+	// keeps the extra arguments from enabling COSI, see ParseArgs.
+	Enabled *bool
+	Driver  ImageValues
+	Sidecar ImageValues
+}
+
+// Bool returns a pointer to b, for the optional boolean values.
+func Bool(b bool) *bool {
+	return &b
+}
+
+type ImageValues struct {
+	ImageTag string
+}
+
+type StorageClassValues struct {
+	Name string
+}
+
+// ParseExtraArgs adds the values set by s, helm arguments split like a
+// shell does, e.g. CHARTS_EXTRA_ARGS, to v. See ParseArgs.
+func (v *Values) ParseExtraArgs(s string) error {
+	args, err := helpers.SplitShellWords(s)
+	if err != nil {
+		return err
+	}
+	return v.ParseArgs(args)
+}
+
+// ParseArgs adds the values set by helm arguments to v. Only the --values,
+// --set, --set-string and --set-json flags are supported: the other flags,
+// e.g. --timeout, --atomic or --version, are rejected as the suites set the
+// options of the helm operations themselves. The flags must not
+// set the keys already set by v, i.e. by the suite: those would be silently
+// overridden.
+func (v *Values) ParseArgs(args []string) error {
+	set, err := v.flagKeys()
+	if err != nil {
+		return err
+	}
+	for _, k := range leafKeys(v.typed(), "") {
+		set[k] = true
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "" {
+			continue
+		}
+
+		flag, value, hasValue := strings.Cut(arg, "=")
+		var (
+			dest  *[]string
+			parse func(string, map[string]interface{}) error
+		)
+		switch flag {
+		case "-f", "--values":
+			dest = &v.Files
+		case "--set":
+			dest, parse = &v.Set, strvals.ParseInto
+		case "--set-string":
+			dest, parse = &v.SetString, strvals.ParseIntoString
+		case "--set-json":
+			dest, parse = &v.SetJSON, strvals.ParseJSON
+		default:
+			return errors.Errorf("unsupported helm argument %q, only -f/--values, --set, --set-string and --set-json are accepted", arg)
+		}
+
+		if !hasValue {
+			if i+1 >= len(args) {
+				return errors.Errorf("helm argument %q needs a value", arg)
+			}
+			i++
+			value = args[i]
+		}
+
+		if parse == nil {
+			// like helm, --values takes a comma separated list
+			for _, f := range strings.Split(value, ",") {
+				if f != "" {
+					*dest = append(*dest, f)
+				}
+			}
+			continue
+		}
+
+		vals := map[string]interface{}{}
+		if err := parse(value, vals); err != nil {
+			return errors.Wrapf(err, "parsing %s %s", flag, value)
+		}
+		if k := overlappingKey(leafKeys(vals, ""), set); k != "" {
+			return errors.Errorf("helm argument %q overrides %s, already set by the suite", flag+" "+value, k)
+		}
+		*dest = append(*dest, value)
+	}
+	return nil
+}
+
+// Map returns the values as passed to the chart. The values files must not
+// set the typed values.
+func (v Values) Map() (map[string]interface{}, error) {
+	typed := v.typed()
+	typedKeys := map[string]bool{}
+	for _, k := range leafKeys(typed, "") {
+		typedKeys[k] = true
+	}
+
+	vals := map[string]interface{}{}
+	for _, f := range v.Files {
+		files := values.Options{ValueFiles: []string{f}}
+		fileVals, err := files.MergeValues(getter.All(cli.New()))
+		if err != nil {
+			return nil, err
+		}
+		if k := overlappingKey(leafKeys(fileVals, ""), typedKeys); k != "" {
+			return nil, errors.Errorf("values file %s overrides %s, already set by the suite", f, k)
+		}
+		vals = mergeMaps(vals, fileVals)
+	}
+	vals = mergeMaps(vals, typed)
+
+	for _, s := range v.Set {
+		if err := strvals.ParseInto(s, vals); err != nil {
+			return nil, errors.Wrapf(err, "parsing --set %s", s)
+		}
+	}
+	for _, s := range v.SetString {
+		if err := strvals.ParseIntoString(s, vals); err != nil {
+			return nil, errors.Wrapf(err, "parsing --set-string %s", s)
+		}
+	}
+	for _, s := range v.SetJSON {
+		if err := strvals.ParseJSON(s, vals); err != nil {
+			return nil, errors.Wrapf(err, "parsing --set-json %s", s)
+		}
+	}
+	return vals, nil
+}
+
+// typed returns the typed values, without the empty strings and nil
+// booleans. Booleans set to false are kept.
+func (v Values) typed() map[string]interface{} {
+	typed := map[string]interface{}{}
+	set := func(path string, value interface{}) {
+		switch v := value.(type) {
+		case string:
+			if v == "" {
+				return
+			}
+		case *bool:
+			if v == nil {
+				return
+			}
+			value = *v
+		}
+		node := typed
+		keys := strings.Split(path, ".")
+		for _, key := range keys[:len(keys)-1] {
+			child, ok := node[key].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				node[key] = child
+			}
+			node = child
+		}
+		node[keys[len(keys)-1]] = value
+	}
+	set("publicDomain", v.PublicDomain)
+	set("imageTag", v.ImageTag)
+	set("ui.publicDomain", v.UI.PublicDomain)
+	set("ui.imageTag", v.UI.ImageTag)
+	set("cosi.driver.imageTag", v.Cosi.Driver.ImageTag)
+	set("cosi.sidecar.imageTag", v.Cosi.Sidecar.ImageTag)
+	set("cosi.enabled", v.Cosi.Enabled)
+	set("storageClass.name", v.StorageClass.Name)
+	return typed
+}
+
+// flagKeys returns the keys set by the --set flags of v.
+func (v Values) flagKeys() (map[string]bool, error) {
+	keys := map[string]bool{}
+	for _, flag := range []struct {
+		values []string
+		parse  func(string, map[string]interface{}) error
+	}{
+		{v.Set, strvals.ParseInto},
+		{v.SetString, strvals.ParseIntoString},
+		{v.SetJSON, strvals.ParseJSON},
+	} {
+		for _, s := range flag.values {
+			vals := map[string]interface{}{}
+			if err := flag.parse(s, vals); err != nil {
+				return nil, errors.Wrapf(err, "parsing %s", s)
+			}
+			for _, k := range leafKeys(vals, "") {
+				keys[k] = true
+			}
+		}
+	}
+	return keys, nil
+}
+
+// leafKeys returns the dotted paths of the leaves of vals, sorted.
+func leafKeys(vals map[string]interface{}, prefix string) []string {
+	var keys []string
+	for k, v := range vals {
+		path := prefix + k
+		if m, ok := v.(map[string]interface{}); ok && len(m) > 0 {
+			keys = append(keys, leafKeys(m, path+".")...)
+			continue
+		}
+		keys = append(keys, path)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// overlappingKey returns the first of keys equal to, within or containing
+// one of set, e.g. ui, ui.imageTag and ui.imageTag.x overlap.
+func overlappingKey(keys []string, set map[string]bool) string {
+	sorted := make([]string, 0, len(set))
+	for s := range set {
+		sorted = append(sorted, s)
+	}
+	sort.Strings(sorted)
+
+	for _, k := range keys {
+		for _, s := range sorted {
+			if k == s || strings.HasPrefix(k, s+".") || strings.HasPrefix(s, k+".") {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// mergeMaps merges b into a, like helm merges the values of its flags.
+func mergeMaps(a, b map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(a))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		if v, ok := v.(map[string]interface{}); ok {
+			if bv, ok := out[k]; ok {
+				if bv, ok := bv.(map[string]interface{}); ok {
+					out[k] = mergeMaps(bv, v)
+					continue
+				}
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,201 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// pathElem is either a map key or a list index.
+type pathElem struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+func (e pathElem) String() string {
+	if e.isIndex {
+		return fmt.Sprintf("[%d]", e.index)
+	}
+	if strings.ContainsAny(e.key, ".[]") {
+		return fmt.Sprintf(`["%s"]`, e.key)
+	}
+	return "." + e.key
+}
+
+func formatPath(elems []pathElem) string {
+	var b strings.Builder
+	for _, e := range elems {
+		b.WriteString(e.String())
+	}
+	return strings.TrimPrefix(b.String(), ".")
+}
+
+// parseJSONPath parses paths like `spec.template.spec.containers[0].image`.
+// Keys containing dots are quoted within brackets, e.g.
+// `metadata.annotations["deployment.kubernetes.io/revision"]`.
+func parseJSONPath(path string) ([]pathElem, error) {
+	var elems []pathElem
+	i := 0
+	for i < len(path) {
+		switch c := path[i]; {
+		case c == '.':
+			if i == 0 || i == len(path)-1 {
+				return nil, errors.Errorf("invalid JSON path %q: unexpected '.' at %d", path, i)
+			}
+			i++
+		case c == '[' && i+1 < len(path) && (path[i+1] == '"' || path[i+1] == '\''):
+			quote := path[i+1]
+			end := strings.Index(path[i+2:], string(quote)+"]")
+			if end < 0 {
+				return nil, errors.Errorf("invalid JSON path %q: unclosed quoted key at %d", path, i)
+			}
+			elems = append(elems, pathElem{key: path[i+2 : i+2+end]})
+			i += 2 + end + 2
+		case c == '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, errors.Errorf("invalid JSON path %q: unclosed '[' at %d", path, i)
+			}
+			index, err := strconv.Atoi(path[i+1 : i+end])
+			if err != nil || index < 0 {
+				return nil, errors.Errorf("invalid JSON path %q: bad index %s", path, path[i:i+end+1])
+			}
+			elems = append(elems, pathElem{index: index, isIndex: true})
+			i += end + 1
+		default:
+			end := strings.IndexAny(path[i:], ".[")
+			if end < 0 {
+				end = len(path) - i
+			}
+			elems = append(elems, pathElem{key: path[i : i+end]})
+			i += end
+		}
+	}
+	return elems, nil
+}
+
+// JSONPathError describes why a JSON path could not be resolved.
+type JSONPathError struct {
+	Path string
+	// At is the longest prefix of Path that could be resolved.
+	At string
+	// Subtree is the value found at At.
+	Subtree interface{}
+	Reason  string
+}
+
+func (e *JSONPathError) Error() string {
+	at := e.At
+	if at == "" {
+		at = "<root>"
+	}
+	return fmt.Sprintf("JSON path %q: %s at %s", e.Path, e.Reason, at)
+}
+
+// ToJSONObject converts obj to its generic JSON representation, made of
+// map[string]interface{}, []interface{} and scalars.
+// Strings and byte slices are parsed as JSON documents.
+func ToJSONObject(obj interface{}) (interface{}, error) {
+	var data []byte
+	switch o := obj.(type) {
+	case map[string]interface{}, []interface{}:
+		return o, nil
+	case string:
+		data = []byte(o)
+	case []byte:
+		data = o
+	case json.RawMessage:
+		data = o
+	default:
+		var err error
+		if data, err = json.Marshal(o); err != nil {
+			return nil, errors.Wrap(err, "converting to JSON")
+		}
+	}
+
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, errors.Wrap(err, "parsing JSON")
+	}
+	return out, nil
+}
+
+// JSONPath returns the value at path within obj, see parseJSONPath for the
+// syntax. A missing node is reported as a *JSONPathError.
+func JSONPath(obj interface{}, path string) (interface{}, error) {
+	elems, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	node, err := ToJSONObject(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, e := range elems {
+		fail := func(reason string, args ...interface{}) error {
+			return &JSONPathError{
+				Path:    path,
+				At:      formatPath(elems[:i]),
+				Subtree: node,
+				Reason:  fmt.Sprintf(reason, args...),
+			}
+		}
+
+		if e.isIndex {
+			list, ok := node.([]interface{})
+			if !ok {
+				return nil, fail("expected a list for index [%d], found %s", e.index, jsonKind(node))
+			}
+			if e.index >= len(list) {
+				return nil, fail("index [%d] out of range (length %d)", e.index, len(list))
+			}
+			node = list[e.index]
+			continue
+		}
+
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, fail("expected an object for key %q, found %s", e.key, jsonKind(node))
+		}
+		next, ok := m[e.key]
+		if !ok {
+			return nil, fail("key %q not found", e.key)
+		}
+		node = next
+	}
+	return node, nil
+}
+
+func jsonKind(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "a list"
+	case string:
+		return "a string"
+	case float64:
+		return "a number"
+	case bool:
+		return "a boolean"
+	}
+	return fmt.Sprintf("%T", v)
+}
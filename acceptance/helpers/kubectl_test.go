@@ -0,0 +1,86 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers_test
+
+import (
+	"encoding/json"
+
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	"github.com/aquarist-labs/s3gw/acceptance/helpers/fakebin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+var _ = Describe("Kubectl", func() {
+	var fake *fakebin.Harness
+
+	BeforeEach(func() {
+		fake = fakebin.New(GinkgoT(), "kubectl", "helm")
+	})
+
+	It("parses the JSON output despite warnings on stderr", func(ctx SpecContext) {
+		fake.On("kubectl", `^get deployments -n ns s3gw -ojson$`, fakebin.Response{
+			Stdout: `{"metadata": {"name": "s3gw"}}`,
+			Stderr: "Warning: v1 Deployment is deprecated\n",
+		})
+
+		res, err := KubectlResult(ctx, "get", "deployments", "-n", "ns", "s3gw", "-ojson")
+		Expect(err).ToNot(HaveOccurred())
+
+		var dJson map[string]interface{}
+		Expect(json.Unmarshal([]byte(res.Stdout), &dJson)).To(Succeed())
+		Expect(dJson["metadata"]).To(HaveKeyWithValue("name", "s3gw"))
+		Expect(res.Stderr).To(ContainSubstring("deprecated"))
+
+		Expect(fake.Invocations("kubectl")).To(ConsistOf(
+			HaveField("Args", []string{"get", "deployments", "-n", "ns", "s3gw", "-ojson"}),
+		))
+	})
+
+	It("reports the exit code and stderr of a failing command", func(ctx SpecContext) {
+		fake.On("kubectl", `^get`, fakebin.Response{
+			Stderr:   `Error from server (NotFound): deployments.apps "s3gw" not found`,
+			ExitCode: 1,
+		})
+
+		_, err := KubectlContext(ctx, "get", "deployments", "s3gw")
+
+		var cerr *CommandError
+		Expect(errors.As(err, &cerr)).To(BeTrue())
+		Expect(cerr.ExitCode).To(Equal(1))
+		Expect(err).To(MatchError(ContainSubstring("NotFound")))
+	})
+
+	It("fails invocations with no programmed response", func(ctx SpecContext) {
+		res, err := RunResult(ctx, "", false, "helm", "list")
+		Expect(err).To(HaveOccurred())
+		Expect(res.ExitCode).To(Equal(127))
+		Expect(fake.Invocations("helm")).To(HaveLen(1))
+	})
+
+	It("gives precedence to the latest rule", func(ctx SpecContext) {
+		fake.On("helm", `.*`, fakebin.Response{Stdout: "first"})
+		fake.On("helm", `^version`, fakebin.Response{Stdout: "second"})
+
+		out, err := RunContext(ctx, "", false, "helm", "version")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out).To(Equal("second"))
+	})
+
+	It("fails when kubectl is not in PATH", func(ctx SpecContext) {
+		GinkgoT().Setenv("PATH", GinkgoT().TempDir())
+
+		_, err := KubectlContext(ctx, "version")
+		Expect(err).To(MatchError(ContainSubstring("kubectl not in path")))
+	})
+})
@@ -16,7 +16,9 @@ import (
 	"strings"
 
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/format"
 	"github.com/onsi/gomega/types"
+	"github.com/pkg/errors"
 )
 
 const (
@@ -58,3 +60,61 @@ func tableRow(args ...string) string {
 
 	return b.String()
 }
+
+// HaveJSONPath succeeds if the JSON document, or the object decoded from it,
+// has a node at path and, when given, the node satisfies matcher.
+// Paths look like `spec.template.spec.containers[0].image`, keys containing
+// dots are quoted within brackets: `metadata.labels["app.kubernetes.io/name"]`.
+// Missing nodes never panic: the failure message reports the path, the
+// deepest node found and its subtree.
+func HaveJSONPath(path string, matcher ...types.GomegaMatcher) types.GomegaMatcher {
+	m := &haveJSONPathMatcher{path: path}
+	if len(matcher) > 0 {
+		m.matcher = And(matcher...)
+	}
+	return m
+}
+
+type haveJSONPathMatcher struct {
+	path    string
+	matcher types.GomegaMatcher
+
+	// set by Match, for the failure messages
+	value   interface{}
+	pathErr *JSONPathError
+}
+
+func (m *haveJSONPathMatcher) Match(actual interface{}) (bool, error) {
+	m.value, m.pathErr = nil, nil
+
+	value, err := JSONPath(actual, m.path)
+	if err != nil {
+		if !errors.As(err, &m.pathErr) {
+			return false, err
+		}
+		return false, nil
+	}
+	m.value = value
+
+	if m.matcher == nil {
+		return true, nil
+	}
+	return m.matcher.Match(value)
+}
+
+func (m *haveJSONPathMatcher) FailureMessage(actual interface{}) string {
+	if m.pathErr != nil {
+		return fmt.Sprintf("Expected JSON path %q to exist, but %s in\n%s",
+			m.path, strings.TrimPrefix(m.pathErr.Error(), fmt.Sprintf("JSON path %q: ", m.path)),
+			format.Object(m.pathErr.Subtree, 1))
+	}
+	return fmt.Sprintf("At JSON path %q:\n%s", m.path, m.matcher.FailureMessage(m.value))
+}
+
+func (m *haveJSONPathMatcher) NegatedFailureMessage(actual interface{}) string {
+	if m.matcher == nil {
+		return fmt.Sprintf("Expected JSON path %q not to exist, but found\n%s",
+			m.path, format.Object(m.value, 1))
+	}
+	return fmt.Sprintf("At JSON path %q:\n%s", m.path, m.matcher.NegatedFailureMessage(m.value))
+}
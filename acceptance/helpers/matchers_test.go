@@ -0,0 +1,131 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers_test
+
+import (
+	"encoding/json"
+
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/types"
+	"github.com/pkg/errors"
+)
+
+const deploymentJSON = `{
+  "metadata": {
+    "name": "s3gw",
+    "annotations": {"deployment.kubernetes.io/revision": "1"}
+  },
+  "spec": {
+    "replicas": 1,
+    "template": {
+      "spec": {
+        "containers": [
+          {"name": "s3gw", "image": "quay.io/s3gw/s3gw:v0.17.0", "args": ["--rgw-backend-store", "sfs"]}
+        ]
+      }
+    }
+  }
+}`
+
+var _ = Describe("HaveJSONPath", func() {
+	var deployment map[string]interface{}
+
+	BeforeEach(func() {
+		Expect(json.Unmarshal([]byte(deploymentJSON), &deployment)).To(Succeed())
+	})
+
+	It("matches nested nodes", func() {
+		Expect(deployment).To(HaveJSONPath("spec.template.spec.containers[0].image", Equal("quay.io/s3gw/s3gw:v0.17.0")))
+		Expect(deployment).To(HaveJSONPath("spec.template.spec.containers[0].args[1]", Equal("sfs")))
+		Expect(deployment).To(HaveJSONPath("spec.replicas", BeEquivalentTo(1)))
+		Expect(deployment).To(HaveJSONPath(`metadata.annotations["deployment.kubernetes.io/revision"]`, Equal("1")))
+		Expect(deployment).To(HaveJSONPath("metadata.name"))
+	})
+
+	It("accepts raw JSON", func() {
+		Expect(deploymentJSON).To(HaveJSONPath("metadata.name", Equal("s3gw")))
+		Expect([]byte(deploymentJSON)).To(HaveJSONPath("metadata.name", Equal("s3gw")))
+	})
+
+	It("fails without panicking on missing nodes", func() {
+		for _, path := range []string{
+			"spec.template.spec.containers[1].image",
+			"spec.strategy.type",
+			"spec.replicas.value",
+			"metadata.name[0]",
+		} {
+			matcher := HaveJSONPath(path, Equal("x"))
+			success, err := matcher.Match(deployment)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(success).To(BeFalse())
+			Expect(matcher.FailureMessage(deployment)).To(ContainSubstring(path))
+		}
+		Expect(deployment).ToNot(HaveJSONPath("spec.strategy"))
+	})
+
+	DescribeTable("reports the deepest node found and its subtree",
+		func(path, reason, at string, subtree types.GomegaMatcher, shown string) {
+			_, err := JSONPath(deployment, path)
+			var pathErr *JSONPathError
+			Expect(errors.As(err, &pathErr)).To(BeTrue())
+			Expect(pathErr.Reason).To(Equal(reason))
+			Expect(pathErr.At).To(Equal(at))
+			Expect(pathErr.Subtree).To(subtree)
+
+			matcher := HaveJSONPath(path)
+			_, _ = matcher.Match(deployment)
+			Expect(matcher.FailureMessage(deployment)).To(And(
+				ContainSubstring(reason),
+				ContainSubstring("at "+at),
+				ContainSubstring(shown),
+			))
+		},
+		Entry("missing key", "spec.strategy.type", `key "strategy" not found`, "spec",
+			HaveKey("template"), "replicas"),
+		Entry("wrong kind", "spec.replicas.value", `expected an object for key "value", found a number`, "spec.replicas",
+			BeEquivalentTo(1), "<float64>: 1"),
+		Entry("index out of range", "spec.template.spec.containers[3].image", "index [3] out of range (length 1)", "spec.template.spec.containers",
+			HaveLen(1), "quay.io/s3gw/s3gw:v0.17.0"),
+	)
+
+	It("reports the path along with the inner matcher failure", func() {
+		matcher := HaveJSONPath("metadata.name", Equal("s3gw-ui"))
+		success, err := matcher.Match(deployment)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(success).To(BeFalse())
+		Expect(matcher.FailureMessage(deployment)).To(And(
+			ContainSubstring(`At JSON path "metadata.name"`),
+			ContainSubstring("s3gw-ui"),
+		))
+	})
+
+	It("errors on invalid paths and documents", func() {
+		_, err := HaveJSONPath("spec[x]").Match(deployment)
+		Expect(err).To(HaveOccurred())
+		_, err = HaveJSONPath("spec").Match("{not json")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("JSONPath", func() {
+	It("returns the node at path", func() {
+		v, err := JSONPath(deploymentJSON, `metadata.annotations['deployment.kubernetes.io/revision']`)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(v).To(Equal("1"))
+
+		v, err = JSONPath(deploymentJSON, "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(v).To(HaveKey("spec"))
+	})
+})
@@ -0,0 +1,146 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	"github.com/onsi/ginkgo/v2/types"
+	"github.com/pkg/errors"
+)
+
+const (
+	// MaxNameLength is the length limit of DNS-1123 labels, which bounds
+	// namespace, service and label values.
+	MaxNameLength = 63
+	// MaxReleaseNameLength is the length limit helm puts on release names.
+	MaxReleaseNameLength = 53
+
+	nameRandomChars = 5
+	nameAlphabet    = "abcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+var (
+	dns1123Label     = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+	// nameSuffixPattern matches the suffix UniqueName appends to a base.
+	nameSuffixPattern = `-[0-9]+[a-z0-9]{` + strconv.Itoa(nameRandomChars) + `}\b`
+)
+
+var (
+	issuedMu    sync.Mutex
+	issuedNames = map[string]bool{}
+)
+
+// IsDNS1123Label reports whether name is a valid DNS-1123 label, as required
+// for namespaces, services and most other resource names.
+func IsDNS1123Label(name string) bool {
+	return len(name) <= MaxNameLength && dns1123Label.MatchString(name)
+}
+
+// UniqueName returns base followed by a suffix made of the ginkgo parallel
+// process index and random characters: names never collide between the
+// processes of a run, and are unlikely to collide between runs sharing a
+// cluster. base is lower cased and truncated as needed, so that the name is
+// a valid DNS-1123 label. UniqueName must be called when the ginkgo tree is
+// built for the names to be replayed by the cassettes, see NewCassette: the
+// names issued within specs are not journaled.
+func UniqueName(base string) string {
+	issuedMu.Lock()
+	defer issuedMu.Unlock()
+
+	for {
+		suffix := strconv.Itoa(GinkgoParallelProcess()) + randomNameChars()
+		prefix := invalidNameChars.ReplaceAllString(strings.ToLower(base), "-")
+		if max := MaxNameLength - len(suffix) - 1; len(prefix) > max {
+			prefix = prefix[:max]
+		}
+		prefix = strings.Trim(prefix, "-")
+
+		name := suffix
+		if prefix != "" {
+			name = prefix + "-" + suffix
+		}
+		if issuedNames[name] {
+			continue
+		}
+		issuedNames[name] = true
+
+		// the names issued by the specs depend on the specs run
+		if CurrentSpecReport().LeafNodeType == types.NodeTypeInvalid {
+			journalName(name)
+		}
+		return name
+	}
+}
+
+func randomNameChars() string {
+	var b strings.Builder
+	max := big.NewInt(int64(len(nameAlphabet)))
+	for i := 0; i < nameRandomChars; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(errors.Wrap(err, "reading random name characters"))
+		}
+		b.WriteByte(nameAlphabet[n.Int64()])
+	}
+	return b.String()
+}
+
+// ChartNames returns the names the s3gw chart derives from the release name
+// and the namespace, mapped to their length limit.
+func ChartNames(releaseName, namespace string) map[string]int {
+	names := map[string]int{
+		releaseName:                   MaxReleaseNameLength,
+		namespace:                     MaxNameLength,
+		releaseName + "-" + namespace: MaxNameLength,
+	}
+	for _, suffix := range []string{"-ui", "-pvc", "-objectstorage-provisioner", "-cosi-driver"} {
+		names[releaseName+suffix] = MaxNameLength
+	}
+	for _, suffix := range []string{"-creds", "-config", "-cluster-ip-tls",
+		"-objectstorage-provisioner", "-objectstorage-provisioner-sa"} {
+		names[releaseName+"-"+namespace+suffix] = MaxNameLength
+	}
+	return names
+}
+
+// CheckChartNames returns an error listing the names derived by the chart,
+// see ChartNames, that are not valid DNS-1123 labels or exceed their limit.
+// It is meant to be checked before installing, as helm or the cluster would
+// fail later with a less obvious error.
+func CheckChartNames(releaseName, namespace string) error {
+	var invalid []string
+	for name, limit := range ChartNames(releaseName, namespace) {
+		switch {
+		case len(name) > limit:
+			invalid = append(invalid, fmt.Sprintf("%s: %d characters, the limit is %d", name, len(name), limit))
+		case !dns1123Label.MatchString(name):
+			invalid = append(invalid, name+": not a valid DNS-1123 label")
+		}
+	}
+	if len(invalid) > 0 {
+		sort.Strings(invalid)
+		return errors.Errorf("release %s in namespace %s derives invalid names:\n%s",
+			releaseName, namespace, strings.Join(invalid, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers_test
+
+import (
+	"strconv"
+	"strings"
+
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("UniqueName", func() {
+	It("appends the parallel process and random characters", func() {
+		name := UniqueName("s3gw-def")
+		Expect(name).To(MatchRegexp(`^s3gw-def-` + strconv.Itoa(GinkgoParallelProcess()) + `[a-z0-9]{5}$`))
+		Expect(IsDNS1123Label(name)).To(BeTrue())
+	})
+
+	It("never returns the same name twice", func() {
+		names := map[string]bool{}
+		for i := 0; i < 1000; i++ {
+			name := UniqueName("s3gw")
+			Expect(names).ToNot(HaveKey(name))
+			names[name] = true
+		}
+	})
+
+	DescribeTable("returns valid DNS-1123 labels",
+		func(base, prefix string) {
+			name := UniqueName(base)
+			Expect(IsDNS1123Label(name)).To(BeTrue(), name)
+			Expect(name).To(HavePrefix(prefix))
+		},
+		Entry("upper case", "BucketClass", "bucketclass-"),
+		Entry("invalid characters", "s3gw_cosi.wf", "s3gw-cosi-wf-"),
+		Entry("leading dash", "-s3gw", "s3gw-"),
+		Entry("long base", strings.Repeat("s3gw-", 20), "s3gw-s3gw-"),
+		Entry("empty base", "", strconv.Itoa(GinkgoParallelProcess())),
+	)
+})
+
+var _ = Describe("CheckChartNames", func() {
+	It("accepts the names of the suites", func() {
+		Expect(CheckChartNames(UniqueName("s3gw"), UniqueName("s3gw-cosi"))).To(Succeed())
+	})
+
+	It("lists the derived names exceeding their limit", func() {
+		err := CheckChartNames("s3gw-cosi-1abcde", "s3gw-acceptance-cosi-1abcde")
+		Expect(err).To(MatchError(ContainSubstring(
+			"s3gw-cosi-1abcde-s3gw-acceptance-cosi-1abcde-objectstorage-provisioner-sa: 73 characters, the limit is 63")))
+		Expect(err).ToNot(MatchError(ContainSubstring("-creds:")))
+	})
+
+	It("rejects invalid names", func() {
+		Expect(CheckChartNames("S3GW", "s3gw")).To(MatchError(ContainSubstring("S3GW: not a valid DNS-1123 label")))
+	})
+})
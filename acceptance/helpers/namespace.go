@@ -0,0 +1,143 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+const (
+	// NamespaceRunLabel holds the RunID of the suite run that created a
+	// namespace.
+	NamespaceRunLabel = "s3gw.io/acceptance-run"
+	// NamespaceSpecLabel holds the spec that created a namespace, truncated
+	// to fit a label value. The full spec text is in the annotation with the
+	// same key.
+	NamespaceSpecLabel = "s3gw.io/acceptance-spec"
+
+	// RunIDEnv overrides the RunID, e.g. to label the namespaces with the id
+	// of the CI job.
+	RunIDEnv = "S3GW_RUN_ID"
+)
+
+// NamespaceDeleteTimeout bounds the wait for a test namespace to be deleted,
+// finalizers included.
+var NamespaceDeleteTimeout = 5 * time.Minute
+
+var invalidLabelChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// labelValue turns s into a valid label value.
+func labelValue(s string) string {
+	v := invalidLabelChars.ReplaceAllString(s, "-")
+	if len(v) > 63 {
+		v = v[:63]
+	}
+	return strings.Trim(v, "-_.")
+}
+
+// RunID identifies the current suite run. It is the same on every parallel
+// process: unless set with RunIDEnv, it is derived from the random seed.
+func RunID() string {
+	if id := os.Getenv(RunIDEnv); id != "" {
+		return labelValue(id)
+	}
+	return fmt.Sprintf("seed-%d", GinkgoRandomSeed())
+}
+
+// TestNamespace creates the namespace name, labeled with the RunID and the
+// current spec, and deletes it when the spec ends, waiting for its finalizers.
+// It must be called from a setup node, e.g. a BeforeEach, before installing
+// anything in the namespace: the deletion then runs after every AfterEach,
+// even if the setup fails midway.
+func TestNamespace(ctx context.Context, name string) {
+	spec := CurrentSpecReport().FullText()
+
+	// registered first, so that a partially created namespace is removed too
+	DeferCleanup(func(ctx SpecContext) {
+		out, err := KubectlContext(ctx, "delete", "namespace", name, "--ignore-not-found", "--wait=false")
+		Expect(err).ToNot(HaveOccurred(), out)
+		WaitForDeleted(ctx, "", "namespace", name, WithWaitTimeout(NamespaceDeleteTimeout))
+	})
+
+	out, err := KubectlContext(ctx, "create", "namespace", name)
+	Expect(err).ToNot(HaveOccurred(), out)
+
+	out, err = KubectlContext(ctx, "label", "namespace", name, "--overwrite",
+		NamespaceRunLabel+"="+RunID(),
+		NamespaceSpecLabel+"="+labelValue(spec))
+	Expect(err).ToNot(HaveOccurred(), out)
+
+	out, err = KubectlContext(ctx, "annotate", "namespace", name, "--overwrite",
+		NamespaceSpecLabel+"="+spec)
+	Expect(err).ToNot(HaveOccurred(), out)
+}
+
+// LeakedNamespaces returns the namespaces labeled with the RunID that still
+// exist on the cluster target of ctx, each followed by the spec that
+// created it.
+func LeakedNamespaces(ctx context.Context) ([]string, error) {
+	res, err := KubectlResult(ctx, "get", "namespaces", "-l", NamespaceRunLabel+"="+RunID(), "-ojson")
+	if err != nil {
+		return nil, err
+	}
+	obj, err := ToJSONObject(res.Stdout)
+	if err != nil {
+		return nil, errors.Wrap(err, "listing namespaces")
+	}
+
+	var leaked []string
+	items, _ := JSONPath(obj, "items")
+	list, _ := items.([]interface{})
+	for _, ns := range list {
+		name, _ := JSONPath(ns, "metadata.name")
+		spec, _ := JSONPath(ns, quotedKeyPath("metadata.annotations", NamespaceSpecLabel))
+		leaked = append(leaked, fmt.Sprintf("%v (%v)", name, spec))
+	}
+	return leaked, nil
+}
+
+// ReportLeakedNamespaces fails the suite if namespaces created by
+// TestNamespace survived on any cluster target, listing them in the report.
+// It must run once all specs are done, e.g. in the second function of a
+// SynchronizedAfterSuite. It does nothing when replaying cassettes or in
+// render-only mode.
+func ReportLeakedNamespaces(ctx context.Context) {
+	if mode, _ := CassetteModeFromEnv(); mode == CassetteReplay || RenderOnly() {
+		return
+	}
+
+	var leaked []string
+	for _, target := range SuiteClusterTargets() {
+		namespaces, err := LeakedNamespaces(WithClusterTarget(ctx, target))
+		if err != nil {
+			fmt.Fprintf(GinkgoWriter, "listing leaked namespaces on cluster %s: %v\n", target.Name, err)
+			continue
+		}
+		for _, ns := range namespaces {
+			leaked = append(leaked, target.Name+": "+ns)
+		}
+	}
+
+	if len(leaked) > 0 {
+		AddReportEntry("leaked namespaces", strings.Join(leaked, "\n"))
+		Fail(fmt.Sprintf("%d namespaces of run %s were not deleted:\n%s", len(leaked), RunID(), strings.Join(leaked, "\n")))
+	}
+}
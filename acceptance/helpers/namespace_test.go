@@ -0,0 +1,81 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers_test
+
+import (
+	"strings"
+
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	"github.com/aquarist-labs/s3gw/acceptance/helpers/fakebin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TestNamespace", func() {
+	var fake *fakebin.Harness
+
+	BeforeEach(func() {
+		fake = fakebin.New(GinkgoT(), "kubectl")
+		fake.On("kubectl", `.*`, fakebin.Response{})
+		GinkgoT().Setenv(RunIDEnv, "run/42")
+	})
+
+	It("derives the run id from the environment or the random seed", func() {
+		Expect(RunID()).To(Equal("run-42"))
+
+		GinkgoT().Setenv(RunIDEnv, "")
+		Expect(RunID()).To(HavePrefix("seed-"))
+	})
+
+	When("the spec ends", func() {
+		BeforeEach(func() {
+			// registered before the spec calls TestNamespace, so it runs after
+			// the namespace cleanup
+			DeferCleanup(func() {
+				var commands []string
+				for _, i := range fake.Invocations("kubectl") {
+					commands = append(commands, strings.Join(i.Args[:2], " "))
+				}
+				Expect(commands).To(Equal([]string{
+					"create namespace",
+					"label namespace",
+					"annotate namespace",
+					"delete namespace",
+					"get namespace",
+				}))
+			})
+		})
+
+		It("creates a labeled namespace and deletes it", func(ctx SpecContext) {
+			TestNamespace(ctx, "s3gw-def123")
+
+			invocations := fake.Invocations("kubectl")
+			Expect(invocations).To(HaveLen(3))
+			Expect(invocations[0].Args).To(Equal([]string{"create", "namespace", "s3gw-def123"}))
+			Expect(invocations[1].Args).To(ContainElements(
+				"s3gw.io/acceptance-run=run-42",
+				"s3gw.io/acceptance-spec=TestNamespace-when-the-spec-ends-creates-a-labeled-namespace-an",
+			))
+			Expect(invocations[2].Args).To(ContainElement(
+				"s3gw.io/acceptance-spec=TestNamespace when the spec ends creates a labeled namespace and deletes it",
+			))
+		})
+	})
+
+	It("lists the namespaces of the run that still exist", func(ctx SpecContext) {
+		fake.On("kubectl", `^get namespaces -l s3gw.io/acceptance-run=run-42 -ojson$`, fakebin.Response{Stdout: `{"items": [
+			{"metadata": {"name": "s3gw-def123", "annotations": {"s3gw.io/acceptance-spec": "charts installations"}}}
+		]}`})
+
+		Expect(LeakedNamespaces(ctx)).To(ConsistOf("s3gw-def123 (charts installations)"))
+	})
+})
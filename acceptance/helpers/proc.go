@@ -13,9 +13,14 @@ package helpers
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"strings"
+	"sync"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	"github.com/pkg/errors"
@@ -26,6 +31,64 @@ var (
 	LChartsInstall = Label("ChartsInstall")
 )
 
+var (
+	// CommandTimeout bounds every command whose context carries no deadline.
+	// Zero disables the default timeout.
+	CommandTimeout = 10 * time.Minute
+
+	// commandWaitDelay is how long to wait for the output pipes to be closed
+	// after the process group has been killed.
+	commandWaitDelay = 5 * time.Second
+)
+
+var (
+	// ErrCommandTimeout is the reason of a CommandError for a command that
+	// exceeded its deadline.
+	ErrCommandTimeout = errors.New("command timed out")
+	// ErrCommandCanceled is the reason of a CommandError for a command whose
+	// context was canceled.
+	ErrCommandCanceled = errors.New("command canceled")
+	// ErrCommandExit is the reason of a CommandError for a command that
+	// terminated with a non-zero exit code.
+	ErrCommandExit = errors.New("command exited with non-zero status")
+)
+
+// CommandError is returned by the RunContext family when a command doesn't
+// complete successfully.
+type CommandError struct {
+	Command  string
+	Args     []string
+	ExitCode int
+	Stderr   string
+	// Reason is one of ErrCommandTimeout, ErrCommandCanceled or ErrCommandExit.
+	Reason error
+	// Err is the underlying error returned by exec.
+	Err error
+}
+
+func (e *CommandError) Error() string {
+	cmdline := commandLine(e.Command, e.Args)
+	msg := fmt.Sprintf("%s: %v: %v", cmdline, e.Reason, e.Err)
+	if e.Reason == ErrCommandExit {
+		msg = fmt.Sprintf("%s: exit code %d", cmdline, e.ExitCode)
+	}
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		msg += ": " + stderr
+	}
+	return msg
+}
+
+// Unwrap allows errors.Is to match both the reason and the underlying error.
+func (e *CommandError) Unwrap() []error {
+	return []error{e.Reason, e.Err}
+}
+
+// Timeout reports whether the command exceeded its deadline.
+func (e *CommandError) Timeout() bool { return e.Reason == ErrCommandTimeout }
+
+// Canceled reports whether the command's context was canceled.
+func (e *CommandError) Canceled() bool { return e.Reason == ErrCommandCanceled }
+
 func Get(dir, command string, arg ...string) (*exec.Cmd, error) {
 	var err error
 
@@ -47,35 +110,262 @@ func RunW(cmd string, args ...string) (string, error) {
 }
 
 func Run(dir string, toStdout bool, command string, args ...string) (string, error) {
-	cmd := exec.Command(command, args...)
+	return RunContext(context.Background(), dir, toStdout, command, args...)
+}
+
+// RunWContext runs the command in the current working dir, see RunContext.
+func RunWContext(ctx context.Context, cmd string, args ...string) (string, error) {
+	return RunContext(ctx, "", false, cmd, args...)
+}
+
+// CommandResult describes a completed command.
+type CommandResult struct {
+	Command string
+	Args    []string
+	Dir     string
+	// Stdout and Stderr hold the respective streams only, Combined holds both
+	// in the order they were written.
+	Stdout   string
+	Stderr   string
+	Combined string
+	// ExitCode is -1 if the command could not be started or was killed.
+	ExitCode int
+	Duration time.Duration
+}
+
+// RunContext runs the command in dir until it completes or ctx is done.
+// It returns stdout and stderr merged together, see RunResult.
+func RunContext(ctx context.Context, dir string, toStdout bool, command string, args ...string) (string, error) {
+	res, err := RunResult(ctx, dir, toStdout, command, args...)
+	return res.Combined, err
+}
+
+// RunResult runs the command in dir until it completes or ctx is done.
+// If ctx has no deadline, CommandTimeout is applied.
+// On cancellation or timeout the whole process group of the command is killed,
+// so that children spawned by e.g. helm or kubectl plugins don't outlive it.
+// The returned result is never nil. A non-nil error is a *CommandError unless
+// the command could not be started.
+// If the context carries a RetryPolicy, or DefaultRetryPolicy is set, failures
+// classified as retryable are retried with exponential backoff. The suites
+// default to IdempotentRetryPolicy, never retrying creations or deletions.
+// kubectl and helm commands are run against the cluster target of the context,
+// or the default one, see WithClusterTarget. The target flags are not part of
+// the recorded and replayed arguments.
+func RunResult(ctx context.Context, dir string, toStdout bool, command string, args ...string) (*CommandResult, error) {
+	if _, ok := ctx.Deadline(); !ok && CommandTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, CommandTimeout)
+		defer cancel()
+	}
+
+	targetArgs := clusterTargetArgs(ctx, command)
+
+	policy := retryPolicyFrom(ctx)
+	start := time.Now()
+	var backoff time.Duration
+	if policy != nil {
+		backoff = policy.InitialBackoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		attemptStart := time.Now()
+		res, err := runOnce(ctx, dir, toStdout, command, targetArgs, args...)
+		auditCommand(attemptStart, res, err)
+		if !policy.shouldRetry(attempt, time.Since(start), backoff, res, err) {
+			return res, err
+		}
+
+		fmt.Fprintf(GinkgoWriter, "retrying %s in %s after transient failure (attempt %d/%d): %v\n",
+			commandLine(command, res.Args), backoff, attempt, policy.MaxAttempts, err)
+
+		// replayed failures don't need to wait for the cluster to recover
+		wait := backoff
+		if c := currentCassette(); c != nil && c.Mode == CassetteReplay {
+			wait = 0
+		}
+		select {
+		case <-ctx.Done():
+			return res, err
+		case <-time.After(wait):
+		}
+		backoff = policy.nextBackoff(backoff)
+	}
+}
+
+// RunFunc runs fn in place of the command `command args...`, for operations
+// done in process, e.g. through an SDK, that must be audited and recorded like
+// the commands run by RunResult. fn returns the output of the operation; in
+// replay mode the recorded output and error are returned instead, so args
+// must identify the operation and its inputs.
+func RunFunc(ctx context.Context, command string, args []string, fn func(ctx context.Context) (string, error)) (*CommandResult, error) {
+	start := time.Now()
+	cassette := currentCassette()
+
+	var res *CommandResult
+	var err error
+	if cassette != nil && cassette.Mode == CassetteReplay {
+		res, err = cassette.replay(command, args, "")
+	} else {
+		var out string
+		out, err = fn(ctx)
+		res = &CommandResult{
+			Command:  command,
+			Args:     args,
+			Stdout:   out,
+			Combined: out,
+			Duration: time.Since(start),
+		}
+		if err != nil {
+			res.ExitCode = 1
+			res.Stderr = err.Error()
+			res.Combined += err.Error()
+		}
+		if cassette != nil && cassette.Mode == CassetteRecord {
+			cassette.record(res, err)
+		}
+	}
+
+	auditCommand(start, res, err)
+	return res, err
+}
+
+// runOnce executes the command with the cluster target flags targetArgs
+// prepended to args, or replays it from the active cassette. The target flags
+// are left out of the cassettes, as kubeconfig paths depend on the checkout
+// and the machine.
+func runOnce(ctx context.Context, dir string, toStdout bool, command string, targetArgs []string, args ...string) (*CommandResult, error) {
+	fullArgs := append(append([]string{}, targetArgs...), args...)
+
+	cassette := currentCassette()
+	if cassette != nil && cassette.Mode == CassetteReplay {
+		res, err := cassette.replay(command, args, dir)
+		res.Args = fullArgs
+		return res, err
+	}
+
+	cmd := exec.CommandContext(ctx, command, fullArgs...)
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error { return killProcessGroup(cmd) }
+	cmd.WaitDelay = commandWaitDelay
 
-	var b bytes.Buffer
+	var stdout, stderr bytes.Buffer
+	combined := &lockedBuffer{}
 	if toStdout {
-		cmd.Stdout = io.MultiWriter(os.Stdout, &b)
-		cmd.Stderr = io.MultiWriter(os.Stderr, &b)
+		cmd.Stdout = io.MultiWriter(os.Stdout, &stdout, combined)
+		cmd.Stderr = io.MultiWriter(os.Stderr, &stderr, combined)
 	} else {
-		cmd.Stdout = &b
-		cmd.Stderr = &b
+		cmd.Stdout = io.MultiWriter(&stdout, combined)
+		cmd.Stderr = io.MultiWriter(&stderr, combined)
 	}
 
 	cmd.Dir = dir
 
+	start := time.Now()
 	err := cmd.Run()
-	return b.String(), err
+
+	res := &CommandResult{
+		Command:  command,
+		Args:     fullArgs,
+		Dir:      dir,
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		Combined: combined.String(),
+		ExitCode: -1,
+		Duration: time.Since(start),
+	}
+	if cmd.ProcessState != nil {
+		res.ExitCode = cmd.ProcessState.ExitCode()
+	}
+
+	err = commandError(ctx, res, err)
+	if cassette != nil && cassette.Mode == CassetteRecord {
+		recorded := *res
+		recorded.Args = args
+		cassette.record(&recorded, err)
+	}
+	return res, err
+}
+
+// lockedBuffer is a bytes.Buffer safe for the concurrent writes of the
+// stdout and stderr copying goroutines.
+type lockedBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (l *lockedBuffer) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.b.Write(p)
+}
+
+func (l *lockedBuffer) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.b.String()
+}
+
+// commandError classifies the error returned by exec.Cmd.Run.
+func commandError(ctx context.Context, res *CommandResult, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	cerr := &CommandError{
+		Command:  res.Command,
+		Args:     res.Args,
+		ExitCode: res.ExitCode,
+		Stderr:   res.Stderr,
+		Err:      err,
+	}
+
+	var exitErr *exec.ExitError
+	isExitErr := errors.As(err, &exitErr)
+
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		cerr.Reason = ErrCommandTimeout
+	case context.Canceled:
+		cerr.Reason = ErrCommandCanceled
+	default:
+		if !isExitErr {
+			// the command could not be started
+			return err
+		}
+		cerr.Reason = ErrCommandExit
+	}
+	return cerr
 }
 
 // Kubectl invokes the `kubectl` command in PATH, running the specified command.
 // It returns the command output and/or error.
 func Kubectl(command ...string) (string, error) {
-	_, err := exec.LookPath("kubectl")
-	if err != nil {
-		return "", errors.Wrap(err, "kubectl not in path")
+	return KubectlContext(context.Background(), command...)
+}
+
+// KubectlContext is like Kubectl but the command is bound to ctx, see RunContext.
+func KubectlContext(ctx context.Context, command ...string) (string, error) {
+	res, err := KubectlResult(ctx, command...)
+	return res.Combined, err
+}
+
+// KubectlResult is like KubectlContext but returns the structured result of
+// the command, whose Stdout can be parsed when requesting `-ojson` output.
+func KubectlResult(ctx context.Context, command ...string) (*CommandResult, error) {
+	res := &CommandResult{Command: "kubectl", Args: command, ExitCode: -1}
+
+	// kubectl is not needed when replaying a cassette
+	if c := currentCassette(); c == nil || c.Mode != CassetteReplay {
+		if _, err := exec.LookPath("kubectl"); err != nil {
+			return res, errors.Wrap(err, "kubectl not in path")
+		}
 	}
 
 	currentdir, err := os.Getwd()
 	if err != nil {
-		return "", err
+		return res, err
 	}
 
-	return Run(currentdir, false, "kubectl", command...)
+	return RunResult(ctx, currentdir, false, "kubectl", command...)
 }
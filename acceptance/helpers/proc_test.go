@@ -0,0 +1,97 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+var _ = Describe("RunResult", func() {
+	It("keeps stdout and stderr apart", func(ctx SpecContext) {
+		res, err := RunResult(ctx, "", false, "sh", "-c", "echo warning >&2; echo '{}'")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Stdout).To(Equal("{}\n"))
+		Expect(res.Stderr).To(Equal("warning\n"))
+		Expect(res.Combined).To(ContainSubstring("warning"))
+		Expect(res.Combined).To(ContainSubstring("{}"))
+		Expect(res.ExitCode).To(Equal(0))
+		Expect(res.Args).To(Equal([]string{"-c", "echo warning >&2; echo '{}'"}))
+		Expect(res.Duration).To(BeNumerically(">", 0))
+	})
+
+	It("returns the result along with the error of a failing command", func(ctx SpecContext) {
+		res, err := RunResult(ctx, "", false, "sh", "-c", "echo boom >&2; exit 2")
+		Expect(err).To(MatchError(ContainSubstring("boom")))
+		Expect(res.ExitCode).To(Equal(2))
+		Expect(res.Stdout).To(BeEmpty())
+	})
+})
+
+var _ = Describe("RunContext", func() {
+	It("returns the output of a successful command", func(ctx SpecContext) {
+		out, err := RunContext(ctx, "", false, "sh", "-c", "echo hello")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out).To(Equal("hello\n"))
+	})
+
+	It("reports the exit code of a failing command", func(ctx SpecContext) {
+		_, err := RunContext(ctx, "", false, "sh", "-c", "exit 3")
+
+		var cerr *CommandError
+		Expect(errors.As(err, &cerr)).To(BeTrue())
+		Expect(cerr.ExitCode).To(Equal(3))
+		Expect(errors.Is(err, ErrCommandExit)).To(BeTrue())
+		Expect(cerr.Timeout()).To(BeFalse())
+	})
+
+	It("kills the whole process group on timeout", func(ctx SpecContext) {
+		tctx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		// the background sleep keeps stdout open: only killing the group
+		// lets Run return before the wait delay
+		_, err := RunContext(tctx, "", false, "sh", "-c", "sleep 30 & sleep 30")
+		Expect(time.Since(start)).To(BeNumerically("<", 3*time.Second))
+
+		var cerr *CommandError
+		Expect(errors.As(err, &cerr)).To(BeTrue())
+		Expect(cerr.Timeout()).To(BeTrue())
+		Expect(errors.Is(err, ErrCommandTimeout)).To(BeTrue())
+	})
+
+	It("distinguishes cancellation from timeout", func(ctx SpecContext) {
+		cctx, cancel := context.WithCancel(ctx)
+		time.AfterFunc(100*time.Millisecond, cancel)
+
+		_, err := RunContext(cctx, "", false, "sleep", "30")
+
+		var cerr *CommandError
+		Expect(errors.As(err, &cerr)).To(BeTrue())
+		Expect(cerr.Canceled()).To(BeTrue())
+		Expect(cerr.Timeout()).To(BeFalse())
+	})
+
+	It("returns the exec error when the command cannot be started", func(ctx SpecContext) {
+		_, err := RunContext(ctx, "", false, "/nonexistent/command")
+		Expect(err).To(HaveOccurred())
+
+		var cerr *CommandError
+		Expect(errors.As(err, &cerr)).To(BeFalse())
+	})
+})
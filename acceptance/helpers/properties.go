@@ -0,0 +1,228 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SuitePropertiesFile is the location of the properties file written by
+// `dump_suite_properties`, relative to a suite directory.
+const SuitePropertiesFile = "../suiteProperties.json"
+
+// Keys written by `dump_suite_properties` in scripts/helpers.sh.
+const (
+	PropChartsVerPrev       = "CHARTS_VER_PREV"
+	PropChartsPrevExtraArgs = "CHARTS_PREV_EXTRA_ARGS"
+	PropChartsVer           = "CHARTS_VER"
+	PropChartsExtraArgs     = "CHARTS_EXTRA_ARGS"
+	PropImageTagPrev        = "IMAGE_TAG_PREV"
+	PropImageTag            = "IMAGE_TAG"
+	PropS3GWClusterIP       = "S3GW_CLUSTER_IP"
+	PropS3GWSystemDomain    = "S3GW_SYSTEM_DOMAIN"
+	PropRelease             = "RELEASE"
+	PropNamespace           = "NAMESPACE"
+	PropClusterKubeconfig   = "CLUSTER_KUBECONFIG"
+	PropClusterContext      = "CLUSTER_CONTEXT"
+	PropClusterTargets      = "CLUSTER_TARGETS"
+	PropUpgradeChain        = "UPGRADE_CHAIN"
+)
+
+// requiredSuiteProperties are needed by every suite.
+var requiredSuiteProperties = []string{
+	PropChartsVer,
+	PropImageTag,
+	PropS3GWSystemDomain,
+}
+
+var versionRegex = regexp.MustCompile(`^v?[0-9]+\.[0-9]+\.[0-9]+([-+][0-9A-Za-z.-]+)?$`)
+
+// SuiteProperties holds the non-static properties used by the acceptance suites.
+type SuiteProperties struct {
+	ChartsVerPrev       string `json:"CHARTS_VER_PREV"`
+	ChartsPrevExtraArgs string `json:"CHARTS_PREV_EXTRA_ARGS"`
+	ChartsVer           string `json:"CHARTS_VER"`
+	ChartsExtraArgs     string `json:"CHARTS_EXTRA_ARGS"`
+	ImageTagPrev        string `json:"IMAGE_TAG_PREV"`
+	ImageTag            string `json:"IMAGE_TAG"`
+	S3GWClusterIP       string `json:"S3GW_CLUSTER_IP"`
+	S3GWSystemDomain    string `json:"S3GW_SYSTEM_DOMAIN"`
+	Release             string `json:"RELEASE"`
+	Namespace           string `json:"NAMESPACE"`
+	// ClusterKubeconfig and ClusterContext select the cluster the suites run
+	// against, relative kubeconfig paths are resolved against the repository root.
+	ClusterKubeconfig string `json:"CLUSTER_KUBECONFIG"`
+	ClusterContext    string `json:"CLUSTER_CONTEXT"`
+	// ClusterTargetsSpec selects several clusters, see ParseClusterTargets.
+	ClusterTargetsSpec string `json:"CLUSTER_TARGETS"`
+	// UpgradeChainSpec lists the versions of an upgrade chain, see
+	// ParseUpgradeChain.
+	UpgradeChainSpec string `json:"UPGRADE_CHAIN"`
+
+	// path is the file the properties were loaded from.
+	path string
+}
+
+// SuitePropertiesError lists every missing or invalid key found while loading
+// the suite properties.
+type SuitePropertiesError struct {
+	Path    string
+	Missing []string
+	Invalid map[string]string
+}
+
+func (e *SuitePropertiesError) Error() string {
+	var parts []string
+	if len(e.Missing) > 0 {
+		parts = append(parts, "missing: "+strings.Join(e.Missing, ", "))
+	}
+	if len(e.Invalid) > 0 {
+		keys := make([]string, 0, len(e.Invalid))
+		for k := range e.Invalid {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		invalid := make([]string, 0, len(keys))
+		for _, k := range keys {
+			invalid = append(invalid, fmt.Sprintf("%s (%s)", k, e.Invalid[k]))
+		}
+		parts = append(parts, "invalid: "+strings.Join(invalid, ", "))
+	}
+	return fmt.Sprintf("suite properties %s: %s", e.Path, strings.Join(parts, "; "))
+}
+
+// fields maps every property key to the struct field holding its value,
+// in the order they are written by `dump_suite_properties`.
+func (p *SuiteProperties) fields() []struct {
+	key   string
+	value *string
+} {
+	return []struct {
+		key   string
+		value *string
+	}{
+		{PropChartsVerPrev, &p.ChartsVerPrev},
+		{PropChartsPrevExtraArgs, &p.ChartsPrevExtraArgs},
+		{PropChartsVer, &p.ChartsVer},
+		{PropChartsExtraArgs, &p.ChartsExtraArgs},
+		{PropImageTagPrev, &p.ImageTagPrev},
+		{PropImageTag, &p.ImageTag},
+		{PropS3GWClusterIP, &p.S3GWClusterIP},
+		{PropS3GWSystemDomain, &p.S3GWSystemDomain},
+		{PropRelease, &p.Release},
+		{PropNamespace, &p.Namespace},
+		{PropClusterKubeconfig, &p.ClusterKubeconfig},
+		{PropClusterContext, &p.ClusterContext},
+		{PropClusterTargets, &p.ClusterTargetsSpec},
+		{PropUpgradeChain, &p.UpgradeChainSpec},
+	}
+}
+
+// Get returns the value of the property with the given key.
+func (p *SuiteProperties) Get(key string) (string, bool) {
+	for _, f := range p.fields() {
+		if f.key == key {
+			return *f.value, true
+		}
+	}
+	return "", false
+}
+
+// LoadSuiteProperties reads the properties file at path, applies environment
+// variable overrides, and validates the result.
+// Keys in required are checked in addition to the ones every suite needs.
+// A missing file is not an error as long as the environment provides all the
+// required keys.
+func LoadSuiteProperties(path string, required ...string) (*SuiteProperties, error) {
+	props := &SuiteProperties{path: path}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "reading suite properties %s", path)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, props); err != nil {
+			return nil, errors.Wrapf(err, "parsing suite properties %s", path)
+		}
+	}
+
+	props.applyEnv()
+
+	if err := props.validate(path, append(requiredSuiteProperties, required...)); err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+// applyEnv overrides every property for which a non-empty environment
+// variable with the same name is set.
+func (p *SuiteProperties) applyEnv() {
+	for _, f := range p.fields() {
+		if v, ok := os.LookupEnv(f.key); ok && v != "" {
+			*f.value = v
+		}
+	}
+}
+
+func (p *SuiteProperties) validate(path string, required []string) error {
+	perr := &SuitePropertiesError{Path: path, Invalid: map[string]string{}}
+
+	seen := map[string]bool{}
+	for _, key := range required {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		v, ok := p.Get(key)
+		if !ok {
+			perr.Invalid[key] = "unknown key"
+			continue
+		}
+		if strings.TrimSpace(v) == "" {
+			perr.Missing = append(perr.Missing, key)
+		}
+	}
+
+	for _, key := range []string{PropChartsVer, PropChartsVerPrev} {
+		if v, _ := p.Get(key); v != "" && !versionRegex.MatchString(v) {
+			perr.Invalid[key] = fmt.Sprintf("%q is not a semantic version", v)
+		}
+	}
+	for _, key := range []string{PropChartsExtraArgs, PropChartsPrevExtraArgs} {
+		v, _ := p.Get(key)
+		if _, err := SplitShellWords(v); err != nil {
+			perr.Invalid[key] = err.Error()
+		}
+	}
+	if p.S3GWClusterIP != "" && net.ParseIP(p.S3GWClusterIP) == nil {
+		perr.Invalid[PropS3GWClusterIP] = fmt.Sprintf("%q is not an IP address", p.S3GWClusterIP)
+	}
+	if _, err := p.ClusterTargets(); err != nil {
+		perr.Invalid[PropClusterTargets] = err.Error()
+	}
+	if _, err := ParseUpgradeChain(p.UpgradeChainSpec); err != nil {
+		perr.Invalid[PropUpgradeChain] = err.Error()
+	}
+
+	if len(perr.Missing) > 0 || len(perr.Invalid) > 0 {
+		return perr
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LoadSuiteProperties", func() {
+	var path string
+
+	writeProperties := func(content string) {
+		Expect(os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "suiteProperties.json")
+		for _, key := range []string{PropChartsVer, PropImageTag, PropS3GWSystemDomain,
+			PropChartsVerPrev, PropChartsExtraArgs, PropUpgradeChain} {
+			GinkgoT().Setenv(key, "")
+		}
+	})
+
+	It("loads the properties", func() {
+		writeProperties(`{
+			"CHARTS_VER": "0.17.0",
+			"IMAGE_TAG": "0.17.0",
+			"S3GW_SYSTEM_DOMAIN": "172.18.0.2.omg.howdoi.website"
+		}`)
+
+		props, err := LoadSuiteProperties(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(props.ChartsVer).To(Equal("0.17.0"))
+		Expect(props.ImageTag).To(Equal("0.17.0"))
+		Expect(props.S3GWSystemDomain).To(Equal("172.18.0.2.omg.howdoi.website"))
+	})
+
+	It("lets environment variables override the file", func() {
+		writeProperties(`{"CHARTS_VER": "0.17.0", "IMAGE_TAG": "0.17.0", "S3GW_SYSTEM_DOMAIN": "a.b"}`)
+		GinkgoT().Setenv(PropImageTag, "0.18.0")
+
+		props, err := LoadSuiteProperties(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(props.ImageTag).To(Equal("0.18.0"))
+	})
+
+	It("works from the environment alone when the file is missing", func() {
+		GinkgoT().Setenv(PropChartsVer, "0.17.0")
+		GinkgoT().Setenv(PropImageTag, "0.17.0")
+		GinkgoT().Setenv(PropS3GWSystemDomain, "a.b")
+
+		_, err := LoadSuiteProperties(path)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("reports every missing and invalid key", func() {
+		writeProperties(`{"CHARTS_VER": "latest", "CHARTS_EXTRA_ARGS": "--set 'a=b", "UPGRADE_CHAIN": "0.14.0"}`)
+
+		_, err := LoadSuiteProperties(path, PropChartsVerPrev)
+		Expect(err).To(HaveOccurred())
+
+		perr, ok := err.(*SuitePropertiesError)
+		Expect(ok).To(BeTrue())
+		Expect(perr.Missing).To(ConsistOf(PropImageTag, PropS3GWSystemDomain, PropChartsVerPrev))
+		Expect(perr.Invalid).To(HaveKey(PropChartsVer))
+		Expect(perr.Invalid).To(HaveKeyWithValue(PropChartsExtraArgs, ContainSubstring("unterminated single quote")))
+		Expect(perr.Invalid).To(HaveKeyWithValue(PropUpgradeChain, ContainSubstring("at least two versions")))
+		Expect(err.Error()).To(ContainSubstring(PropChartsVerPrev))
+	})
+
+	It("fails on malformed JSON", func() {
+		writeProperties(`{"CHARTS_VER": `)
+
+		_, err := LoadSuiteProperties(path)
+		Expect(err).To(MatchError(ContainSubstring("parsing suite properties")))
+	})
+})
@@ -0,0 +1,184 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	"github.com/pkg/errors"
+)
+
+// RenderOnlyEnv enables the render-only mode: the chart is rendered instead
+// of installed, and the specs inspect the rendered objects instead of the
+// ones of a cluster, see GetObject.
+const RenderOnlyEnv = "S3GW_RENDER_ONLY"
+
+// RenderOnly returns whether the suites run in render-only mode.
+func RenderOnly() bool {
+	on, _ := strconv.ParseBool(os.Getenv(RenderOnlyEnv))
+	return on
+}
+
+// ErrObjectNotFound is returned by GetObject when the object does not exist.
+var ErrObjectNotFound = errors.New("object not found")
+
+var (
+	renderedMu      sync.Mutex
+	renderedObjects []interface{}
+)
+
+// UseRenderedObjects makes GetObject return objs, the objects of a rendered
+// chart, until the end of the current spec. The defaults the API server
+// would set on them and the specs depend on are applied first, see
+// applyServerDefaults.
+func UseRenderedObjects(objs []interface{}) {
+	copies := make([]interface{}, 0, len(objs))
+	for _, obj := range objs {
+		// the callers keep their objects
+		data, err := json.Marshal(obj)
+		if err != nil {
+			Fail("copying rendered object: " + err.Error())
+		}
+		var c interface{}
+		if err := json.Unmarshal(data, &c); err != nil {
+			Fail("copying rendered object: " + err.Error())
+		}
+		applyServerDefaults(c)
+		copies = append(copies, c)
+	}
+
+	renderedMu.Lock()
+	renderedObjects = copies
+	renderedMu.Unlock()
+	DeferCleanup(func() {
+		renderedMu.Lock()
+		renderedObjects = nil
+		renderedMu.Unlock()
+	})
+}
+
+// GetObject returns the object kind/name of namespace: one of the rendered
+// objects in render-only mode, the one of the cluster otherwise. Missing
+// objects are reported as ErrObjectNotFound.
+func GetObject(ctx context.Context, kind, namespace, name string) (interface{}, error) {
+	if RenderOnly() {
+		return renderedObject(kind, namespace, name)
+	}
+
+	res, err := KubectlResult(ctx, "get", strings.ToLower(kind), "-n", namespace, name, "-ojson")
+	if err != nil {
+		var cerr *CommandError
+		if errors.As(err, &cerr) && strings.Contains(cerr.Stderr, "(NotFound)") {
+			return nil, errors.Wrapf(ErrObjectNotFound, "%s %s/%s", kind, namespace, name)
+		}
+		return nil, err
+	}
+	return ToJSONObject(res.Stdout)
+}
+
+func renderedObject(kind, namespace, name string) (interface{}, error) {
+	renderedMu.Lock()
+	defer renderedMu.Unlock()
+
+	obj, err := FindObject(renderedObjects, kind, namespace, name)
+	if err != nil {
+		return nil, errors.Wrapf(ErrObjectNotFound, "%s %s/%s was not rendered", kind, namespace, name)
+	}
+	return obj, nil
+}
+
+// FindObject returns the object kind/name of namespace among objs, e.g. the
+// objects of a rendered chart, or ErrObjectNotFound.
+func FindObject(objs []interface{}, kind, namespace, name string) (interface{}, error) {
+	for _, obj := range objs {
+		m, _ := obj.(map[string]interface{})
+		metadata, _ := m["metadata"].(map[string]interface{})
+		if k, _ := m["kind"].(string); !strings.EqualFold(k, kind) {
+			continue
+		}
+		if ns, _ := metadata["namespace"].(string); ns != namespace {
+			continue
+		}
+		if n, _ := metadata["name"].(string); n == name {
+			return obj, nil
+		}
+	}
+	return nil, errors.Wrapf(ErrObjectNotFound, "%s %s/%s", kind, namespace, name)
+}
+
+// applyServerDefaults sets the defaults of the API server the specs check on
+// the deployments. Only those are set, the rendered objects don't match the
+// golden snapshots.
+func applyServerDefaults(obj interface{}) {
+	m, _ := obj.(map[string]interface{})
+	if kind, _ := m["kind"].(string); kind != "Deployment" {
+		return
+	}
+	spec, ok := m["spec"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	setDefault(spec, "replicas", float64(1))
+	setDefault(spec, "strategy", map[string]interface{}{"type": "RollingUpdate"})
+
+	template, _ := spec["template"].(map[string]interface{})
+	podSpec, ok := template["spec"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	if sa, ok := podSpec["serviceAccountName"]; ok {
+		setDefault(podSpec, "serviceAccount", sa)
+	}
+	for _, list := range []string{"initContainers", "containers"} {
+		containers, _ := podSpec[list].([]interface{})
+		for _, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			image, _ := container["image"].(string)
+			setDefault(container, "imagePullPolicy", pullPolicy(image))
+
+			ports, _ := container["ports"].([]interface{})
+			for _, p := range ports {
+				if port, ok := p.(map[string]interface{}); ok {
+					setDefault(port, "protocol", "TCP")
+				}
+			}
+		}
+	}
+}
+
+func setDefault(m map[string]interface{}, key string, value interface{}) {
+	if _, ok := m[key]; !ok {
+		m[key] = value
+	}
+}
+
+// pullPolicy is the default pull policy of image.
+func pullPolicy(image string) string {
+	if strings.Contains(image, "@") {
+		return "IfNotPresent"
+	}
+	name := image[strings.LastIndex(image, "/")+1:]
+	i := strings.LastIndex(name, ":")
+	if i < 0 || name[i+1:] == "latest" {
+		return "Always"
+	}
+	return "IfNotPresent"
+}
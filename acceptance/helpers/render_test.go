@@ -0,0 +1,115 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers_test
+
+import (
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	"github.com/aquarist-labs/s3gw/acceptance/helpers/fakebin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GetObject", func() {
+	var fake *fakebin.Harness
+
+	deployment := func() map[string]interface{} {
+		return map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": "s3gw", "namespace": "s3gw-def"},
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{
+						"serviceAccountName": "s3gw-sa",
+						"containers": []interface{}{
+							map[string]interface{}{
+								"name":  "s3gw",
+								"image": "quay.io/s3gw/s3gw:v0.17.0",
+								"ports": []interface{}{map[string]interface{}{"name": "s3", "containerPort": 7480}},
+							},
+							map[string]interface{}{
+								"name":            "s3gw-ui",
+								"image":           "quay.io/s3gw/s3gw-ui:latest",
+								"imagePullPolicy": "Never",
+							},
+							map[string]interface{}{"name": "sidecar", "image": "localhost:5000/sidecar"},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		fake = fakebin.New(GinkgoT(), "kubectl")
+	})
+
+	It("gets the object from the cluster", func(ctx SpecContext) {
+		GinkgoT().Setenv(RenderOnlyEnv, "")
+		fake.On("kubectl", `get deployment`, fakebin.Response{Stdout: `{"kind":"Deployment"}`})
+
+		obj, err := GetObject(ctx, "Deployment", "s3gw-def", "s3gw")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(obj).To(HaveKeyWithValue("kind", "Deployment"))
+		Expect(fake.Invocations("kubectl")).To(HaveExactElements(
+			HaveField("Args", []string{"get", "deployment", "-n", "s3gw-def", "s3gw", "-ojson"}),
+		))
+	})
+
+	It("reports missing objects", func(ctx SpecContext) {
+		GinkgoT().Setenv(RenderOnlyEnv, "")
+		fake.On("kubectl", `get deployment`, fakebin.Response{
+			Stderr:   `Error from server (NotFound): deployments.apps "s3gw" not found`,
+			ExitCode: 1,
+		})
+
+		_, err := GetObject(ctx, "Deployment", "s3gw-def", "s3gw")
+		Expect(err).To(MatchError(ErrObjectNotFound))
+	})
+
+	When("rendering only", func() {
+		BeforeEach(func() {
+			GinkgoT().Setenv(RenderOnlyEnv, "true")
+		})
+
+		It("gets the rendered object with the server defaults", func(ctx SpecContext) {
+			rendered := deployment()
+			UseRenderedObjects([]interface{}{rendered})
+
+			obj, err := GetObject(ctx, "Deployment", "s3gw-def", "s3gw")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(obj).To(HaveJSONPath("spec.replicas", BeEquivalentTo(1)))
+			Expect(obj).To(HaveStrategy("RollingUpdate"))
+			Expect(obj).To(HaveJSONPath("spec.template.spec.serviceAccount", Equal("s3gw-sa")))
+			Expect(obj).To(HaveContainer("s3gw",
+				HaveJSONPath("imagePullPolicy", Equal("IfNotPresent")),
+				HavePort("s3", 7480, "TCP"),
+			))
+			Expect(obj).To(HaveContainer("s3gw-ui", HaveJSONPath("imagePullPolicy", Equal("Never"))))
+			Expect(obj).To(HaveContainer("sidecar", HaveJSONPath("imagePullPolicy", Equal("Always"))))
+
+			// the rendered objects are left as they are
+			Expect(rendered["spec"]).ToNot(HaveKey("replicas"))
+			Expect(fake.Invocations("")).To(BeEmpty())
+		})
+
+		It("fails on objects that were not rendered", func(ctx SpecContext) {
+			UseRenderedObjects([]interface{}{deployment()})
+
+			_, err := GetObject(ctx, "Deployment", "other", "s3gw")
+			Expect(err).To(MatchError(ErrObjectNotFound))
+			Expect(err).To(MatchError("Deployment other/s3gw was not rendered: object not found"))
+			_, err = GetObject(ctx, "Service", "s3gw-def", "s3gw")
+			Expect(err).To(MatchError(ErrObjectNotFound))
+		})
+	})
+})
@@ -0,0 +1,180 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy describes how a failed command is retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of executions, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, doubled after each
+	// retry up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Budget bounds the total time spent on a call, retries included.
+	// Zero means no bound besides the context deadline.
+	Budget time.Duration
+	// Retryable decides whether a failure is worth retrying.
+	Retryable func(res *CommandResult, err error) bool
+}
+
+// transientErrors are the messages printed by kubectl and helm when the API
+// server is temporarily unable to serve a request.
+var transientErrors = []string{
+	"connection refused",
+	"connection reset by peer",
+	"tls handshake timeout",
+	"etcdserver: leader changed",
+	"etcdserver: request timed out",
+	"http2: client connection lost",
+	"the server is currently unable to handle the request",
+	"the object has been modified; please apply your changes to the latest version",
+	"unable to connect to the server",
+}
+
+// TransientRetryPolicy retries commands that failed because of a transient
+// API server condition, see IsTransient.
+var TransientRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: time.Second,
+	MaxBackoff:     15 * time.Second,
+	Budget:         time.Minute,
+	Retryable:      IsTransient,
+}
+
+// IdempotentRetryPolicy is TransientRetryPolicy restricted to the commands
+// that can safely run again, see IsIdempotent. Creations, deletions and helm
+// releases are not retried, a first attempt may have reached the API server.
+var IdempotentRetryPolicy = RetryPolicy{
+	MaxAttempts:    TransientRetryPolicy.MaxAttempts,
+	InitialBackoff: TransientRetryPolicy.InitialBackoff,
+	MaxBackoff:     TransientRetryPolicy.MaxBackoff,
+	Budget:         TransientRetryPolicy.Budget,
+	Retryable: func(res *CommandResult, err error) bool {
+		return IsIdempotent(res) && IsTransient(res, err)
+	},
+}
+
+// DefaultRetryPolicy is used by commands whose context carries no policy.
+// Nil disables retries. Suites should not set it to a policy retrying
+// commands that are not idempotent, e.g. TransientRetryPolicy: opt in per
+// call with WithRetryPolicy instead.
+var DefaultRetryPolicy *RetryPolicy
+
+type retryPolicyKey struct{}
+
+// WithRetryPolicy returns a context whose commands are retried according to
+// policy. A nil policy disables retries, overriding DefaultRetryPolicy.
+func WithRetryPolicy(ctx context.Context, policy *RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyKey{}, policy)
+}
+
+func retryPolicyFrom(ctx context.Context) *RetryPolicy {
+	if policy, ok := ctx.Value(retryPolicyKey{}).(*RetryPolicy); ok {
+		return policy
+	}
+	return DefaultRetryPolicy
+}
+
+// IsTransient reports whether a command exited with an error caused by a
+// transient API server condition, e.g. a refused connection, an etcd leader
+// change or a write conflict.
+// Timeouts, cancellations and every other failure are not transient, as they
+// are relevant for the assertions of the specs.
+func IsTransient(res *CommandResult, err error) bool {
+	if !errors.Is(err, ErrCommandExit) || res == nil {
+		return false
+	}
+
+	stderr := strings.ToLower(res.Stderr)
+	for _, msg := range transientErrors {
+		if strings.Contains(stderr, msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// idempotentCommands are the kubectl and helm subcommands that only read, or
+// converge to the same state when run again.
+var idempotentCommands = map[string][]string{
+	"kubectl": {"get", "describe", "logs", "apply", "wait", "rollout status", "top", "version", "api-resources", "auth can-i"},
+	"helm":    {"get", "history", "list", "status", "show", "template", "version"},
+}
+
+// valueFlags are the global flags of kubectl and helm taking a separate
+// value, e.g. those added by WithClusterTarget.
+var valueFlags = map[string]bool{
+	"-n": true, "--namespace": true,
+	"--kubeconfig": true, "--context": true, "--kube-context": true,
+}
+
+// IsIdempotent reports whether the command of res is a kubectl or helm
+// command that can safely run again after a failure, see idempotentCommands.
+func IsIdempotent(res *CommandResult) bool {
+	if res == nil {
+		return false
+	}
+	commands, ok := idempotentCommands[filepath.Base(res.Command)]
+	if !ok {
+		return false
+	}
+
+	var words []string
+	for i := 0; i < len(res.Args) && len(words) < 2; i++ {
+		arg := res.Args[i]
+		if strings.HasPrefix(arg, "-") {
+			if valueFlags[arg] {
+				i++
+			}
+			continue
+		}
+		words = append(words, arg)
+	}
+	if len(words) == 0 {
+		return false
+	}
+	for _, c := range commands {
+		if c == words[0] || c == strings.Join(words, " ") {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldRetry reports whether the attempt that just failed should be retried
+// after backoff, given the time elapsed since the first attempt.
+func (p *RetryPolicy) shouldRetry(attempt int, elapsed, backoff time.Duration, res *CommandResult, err error) bool {
+	if p == nil || err == nil || attempt >= p.MaxAttempts || p.Retryable == nil {
+		return false
+	}
+	if p.Budget > 0 && elapsed+backoff > p.Budget {
+		return false
+	}
+	return p.Retryable(res, err)
+}
+
+func (p *RetryPolicy) nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return backoff
+}
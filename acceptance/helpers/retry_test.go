@@ -0,0 +1,143 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers_test
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	"github.com/aquarist-labs/s3gw/acceptance/helpers/fakebin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RetryPolicy", func() {
+	var attemptsFile string
+	policy := &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     20 * time.Millisecond,
+		Retryable:      IsTransient,
+	}
+
+	// failing returns a script failing with stderr on the first n attempts.
+	failing := func(n int, stderr string) string {
+		return `echo x >> ` + attemptsFile + `
+if [ $(wc -l < ` + attemptsFile + `) -le ` + strconv.Itoa(n) + ` ]; then
+  echo "` + stderr + `" >&2; exit 1
+fi
+echo ok`
+	}
+
+	attempts := func() int {
+		data, err := os.ReadFile(attemptsFile)
+		Expect(err).ToNot(HaveOccurred())
+		return strings.Count(string(data), "\n")
+	}
+
+	BeforeEach(func() {
+		attemptsFile = filepath.Join(GinkgoT().TempDir(), "attempts")
+	})
+
+	It("retries transient failures until the command succeeds", func(ctx SpecContext) {
+		out, err := RunContext(WithRetryPolicy(ctx, policy), "", false, "sh", "-c",
+			failing(2, "The connection to the server 127.0.0.1:6443 was refused - did you specify the right host or port? dial tcp: connection refused"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out).To(Equal("ok\n"))
+		Expect(attempts()).To(Equal(3))
+	})
+
+	It("gives up after MaxAttempts", func(ctx SpecContext) {
+		_, err := RunContext(WithRetryPolicy(ctx, policy), "", false, "sh", "-c",
+			failing(5, "etcdserver: leader changed"))
+		Expect(err).To(HaveOccurred())
+		Expect(attempts()).To(Equal(3))
+	})
+
+	It("does not retry failures relevant to the specs", func(ctx SpecContext) {
+		_, err := RunContext(WithRetryPolicy(ctx, policy), "", false, "sh", "-c",
+			failing(1, `Error from server (NotFound): deployments.apps "s3gw" not found`))
+		Expect(err).To(HaveOccurred())
+		Expect(attempts()).To(Equal(1))
+	})
+
+	It("does not retry without a policy", func(ctx SpecContext) {
+		_, err := RunContext(ctx, "", false, "sh", "-c", failing(1, "TLS handshake timeout"))
+		Expect(err).To(HaveOccurred())
+		Expect(attempts()).To(Equal(1))
+	})
+
+	It("stops retrying when the budget is exhausted", func(ctx SpecContext) {
+		budgeted := *policy
+		budgeted.InitialBackoff = 50 * time.Millisecond
+		budgeted.Budget = 10 * time.Millisecond
+
+		_, err := RunContext(WithRetryPolicy(ctx, &budgeted), "", false, "sh", "-c",
+			failing(1, "TLS handshake timeout"))
+		Expect(err).To(HaveOccurred())
+		Expect(attempts()).To(Equal(1))
+	})
+
+	DescribeTable("IsTransient",
+		func(stderr string, exit bool, expected bool) {
+			var err error = &CommandError{Reason: ErrCommandTimeout}
+			if exit {
+				err = &CommandError{Reason: ErrCommandExit, ExitCode: 1}
+			}
+			Expect(IsTransient(&CommandResult{Stderr: stderr}, err)).To(Equal(expected))
+		},
+		Entry("connection refused", "dial tcp 10.0.0.1:6443: connect: connection refused", true, true),
+		Entry("etcd leader change", "Error from server: etcdserver: leader changed", true, true),
+		Entry("TLS handshake timeout", "net/http: TLS handshake timeout", true, true),
+		Entry("conflict", `Operation cannot be fulfilled on deployments.apps "s3gw": the object has been modified; please apply your changes to the latest version and try again`, true, true),
+		Entry("not found", `Error from server (NotFound): deployments.apps "s3gw" not found`, true, false),
+		Entry("timeout", "connection refused", false, false),
+	)
+
+	DescribeTable("IsIdempotent",
+		func(command string, args []string, expected bool) {
+			Expect(IsIdempotent(&CommandResult{Command: command, Args: args})).To(Equal(expected))
+		},
+		Entry("kubectl get", "kubectl", []string{"get", "pods", "-n", "s3gw"}, true),
+		Entry("kubectl apply", "/usr/bin/kubectl", []string{"apply", "-f", "-"}, true),
+		Entry("kubectl rollout status", "kubectl", []string{"--context", "kind", "-n", "s3gw", "rollout", "status", "deployment/s3gw"}, true),
+		Entry("kubectl rollout restart", "kubectl", []string{"rollout", "restart", "deployment/s3gw"}, false),
+		Entry("kubectl create, with a kubeconfig named get", "kubectl", []string{"--kubeconfig", "get", "create", "namespace", "s3gw"}, false),
+		Entry("kubectl delete", "kubectl", []string{"delete", "namespace", "s3gw"}, false),
+		Entry("helm history", "helm", []string{"--kube-context", "kind", "history", "s3gw"}, true),
+		Entry("helm install", "helm", []string{"install", "s3gw", "charts/s3gw"}, false),
+		Entry("helm uninstall", "helm", []string{"uninstall", "s3gw"}, false),
+		Entry("other commands", "sh", []string{"get"}, false),
+	)
+
+	It("retries idempotent commands only", func(ctx SpecContext) {
+		GinkgoT().Setenv(RenderOnlyEnv, "")
+		fake := fakebin.New(GinkgoT(), "kubectl")
+		fake.On("kubectl", `.`, fakebin.Response{Stderr: "etcdserver: leader changed", ExitCode: 1})
+
+		idempotent := IdempotentRetryPolicy
+		idempotent.InitialBackoff = 10 * time.Millisecond
+		retrying := WithRetryPolicy(ctx, &idempotent)
+
+		_, err := KubectlResult(retrying, "create", "namespace", "s3gw")
+		Expect(err).To(HaveOccurred())
+		Expect(fake.Invocations("kubectl")).To(HaveLen(1))
+
+		_, err = KubectlResult(retrying, "get", "namespace", "s3gw")
+		Expect(err).To(HaveOccurred())
+		Expect(fake.Invocations("kubectl")).To(HaveLen(1 + idempotent.MaxAttempts))
+	})
+})
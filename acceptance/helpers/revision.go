@@ -0,0 +1,169 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// RevisionAnnotation holds the revision of a deployment, and of each of
+	// its ReplicaSets.
+	RevisionAnnotation = "deployment.kubernetes.io/revision"
+	// PodTemplateHashLabel labels the ReplicaSets of a deployment with the
+	// hash of their pod template.
+	PodTemplateHashLabel = "pod-template-hash"
+)
+
+// DeploymentRevision is the rollout state of a deployment: its revision and
+// the pod template hash of the ReplicaSet of that revision.
+type DeploymentRevision struct {
+	Revision     int
+	TemplateHash string
+}
+
+// GetDeploymentRevision returns the revision of the deployment name.
+func GetDeploymentRevision(ctx context.Context, namespace, name string) (*DeploymentRevision, error) {
+	d, err := GetObject(ctx, "Deployment", namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	v, err := JSONPath(d, quotedKeyPath("metadata.annotations", RevisionAnnotation))
+	if err != nil {
+		return nil, errors.Wrapf(err, "deployment %s/%s has no revision", namespace, name)
+	}
+	annotation, _ := v.(string)
+	revision, err := strconv.Atoi(annotation)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing the revision of deployment %s/%s", namespace, name)
+	}
+
+	v, err = JSONPath(d, "spec.selector.matchLabels")
+	if err != nil {
+		return nil, err
+	}
+	labels, _ := v.(map[string]interface{})
+	selector := make([]string, 0, len(labels))
+	for k, v := range labels {
+		selector = append(selector, fmt.Sprintf("%s=%v", k, v))
+	}
+	// sorted, the arguments are recorded in the cassettes
+	sort.Strings(selector)
+
+	res, err := KubectlResult(ctx, "get", "replicasets", "-n", namespace,
+		"-l", strings.Join(selector, ","), "-ojson")
+	if err != nil {
+		return nil, err
+	}
+	list, err := ToJSONObject(res.Stdout)
+	if err != nil {
+		return nil, err
+	}
+	items, _ := list.(map[string]interface{})["items"].([]interface{})
+	for _, rs := range items {
+		if !ownedBy(rs, "Deployment", name) {
+			continue
+		}
+		if v, _ := JSONPath(rs, quotedKeyPath("metadata.annotations", RevisionAnnotation)); v != annotation {
+			continue
+		}
+		hash, _ := JSONPath(rs, quotedKeyPath("metadata.labels", PodTemplateHashLabel))
+		s, _ := hash.(string)
+		return &DeploymentRevision{Revision: revision, TemplateHash: s}, nil
+	}
+	return nil, errors.Errorf("deployment %s/%s has no ReplicaSet of revision %d", namespace, name, revision)
+}
+
+func ownedBy(obj interface{}, kind, name string) bool {
+	refs, _ := JSONPath(obj, "metadata.ownerReferences")
+	list, _ := refs.([]interface{})
+	for _, ref := range list {
+		m, _ := ref.(map[string]interface{})
+		if m["kind"] == kind && m["name"] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// PodTemplateChanged tells whether the pod templates of the deployments from
+// and to differ, i.e. whether updating the deployment from one to the other
+// rolls out a new ReplicaSet. Both are compared as rendered, e.g. by
+// helm.Client.Render, before the API server sets its defaults. They must be
+// rendered with the capabilities of the cluster they are deployed to, and
+// without lookup: pod templates depending on the objects found by lookup,
+// e.g. through checksum annotations, are not supported.
+func PodTemplateChanged(from, to interface{}) (bool, error) {
+	fromTemplate, err := JSONPath(from, "spec.template")
+	if err != nil {
+		return false, errors.Wrap(err, "getting the previous pod template")
+	}
+	toTemplate, err := JSONPath(to, "spec.template")
+	if err != nil {
+		return false, errors.Wrap(err, "getting the new pod template")
+	}
+	// JSON objects, whatever their origin
+	a, err := ToJSONObject(fromTemplate)
+	if err != nil {
+		return false, err
+	}
+	b, err := ToJSONObject(toTemplate)
+	if err != nil {
+		return false, err
+	}
+	return !reflect.DeepEqual(a, b), nil
+}
+
+// ExpectedRevision is the state a deployment is expected to reach after an
+// update: the deployment controller rolls out a new ReplicaSet, with the
+// next revision, only when the pod template changes.
+type ExpectedRevision struct {
+	Before          DeploymentRevision
+	TemplateChanged bool
+}
+
+// Revision returns the revision expected after the update.
+func (e ExpectedRevision) Revision() int {
+	if e.TemplateChanged {
+		return e.Before.Revision + 1
+	}
+	return e.Before.Revision
+}
+
+func (e ExpectedRevision) String() string {
+	if e.TemplateChanged {
+		return fmt.Sprintf("revision %d, the pod template changed", e.Revision())
+	}
+	return fmt.Sprintf("revision %d, the pod template is unchanged", e.Revision())
+}
+
+// Check returns an error unless after, the state of the deployment after the
+// update, is the expected one.
+func (e ExpectedRevision) Check(after *DeploymentRevision) error {
+	if after.Revision != e.Revision() {
+		return errors.Errorf("expected %s, got revision %d", e, after.Revision)
+	}
+	if e.TemplateChanged && after.TemplateHash == e.Before.TemplateHash {
+		return errors.Errorf("expected a new ReplicaSet, pod template hash %s is unchanged", after.TemplateHash)
+	}
+	if !e.TemplateChanged && after.TemplateHash != e.Before.TemplateHash {
+		return errors.Errorf("expected pod template hash %s to be kept, got %s", e.Before.TemplateHash, after.TemplateHash)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers_test
+
+import (
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	"github.com/aquarist-labs/s3gw/acceptance/helpers/fakebin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Deployment revisions", func() {
+	It("finds the pod template hash of the current revision", func(ctx SpecContext) {
+		GinkgoT().Setenv(RenderOnlyEnv, "")
+		fake := fakebin.New(GinkgoT(), "kubectl")
+		fake.On("kubectl", `^get deployment -n s3gw s3gw `, fakebin.Response{Stdout: `{
+			"metadata": {"annotations": {"deployment.kubernetes.io/revision": "2"}},
+			"spec": {"selector": {"matchLabels": {"app.kubernetes.io/name": "s3gw", "app.kubernetes.io/component": "gateway"}}}
+		}`})
+		fake.On("kubectl", `^get replicasets -n s3gw `, fakebin.Response{Stdout: `{"items": [
+			{"metadata": {"annotations": {"deployment.kubernetes.io/revision": "2"}, "labels": {"pod-template-hash": "other"},
+				"ownerReferences": [{"kind": "Deployment", "name": "s3gw-ui"}]}},
+			{"metadata": {"annotations": {"deployment.kubernetes.io/revision": "1"}, "labels": {"pod-template-hash": "old"},
+				"ownerReferences": [{"kind": "Deployment", "name": "s3gw"}]}},
+			{"metadata": {"annotations": {"deployment.kubernetes.io/revision": "2"}, "labels": {"pod-template-hash": "new"},
+				"ownerReferences": [{"kind": "Deployment", "name": "s3gw"}]}}
+		]}`})
+
+		rev, err := GetDeploymentRevision(ctx, "s3gw", "s3gw")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*rev).To(Equal(DeploymentRevision{Revision: 2, TemplateHash: "new"}))
+		Expect(fake.Invocations("kubectl")[1].Args).To(ContainElements("-l",
+			"app.kubernetes.io/component=gateway,app.kubernetes.io/name=s3gw"))
+	})
+
+	It("compares the pod templates of rendered deployments", func() {
+		deployment := func(image string) map[string]interface{} {
+			return map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": map[string]interface{}{"helm.sh/chart": image}},
+				"spec": map[string]interface{}{"template": map[string]interface{}{
+					"spec": map[string]interface{}{"containers": []interface{}{
+						map[string]interface{}{"name": "s3gw", "image": image},
+					}},
+				}},
+			}
+		}
+
+		changed, err := PodTemplateChanged(deployment("s3gw:v0.16.0"), deployment("s3gw:v0.17.0"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changed).To(BeTrue())
+
+		changed, err = PodTemplateChanged(deployment("s3gw:v0.17.0"), deployment("s3gw:v0.17.0"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changed).To(BeFalse())
+
+		_, err = PodTemplateChanged(map[string]interface{}{}, deployment("s3gw:v0.17.0"))
+		Expect(err).To(MatchError(ContainSubstring("previous pod template")))
+	})
+
+	DescribeTable("checks the revision after the update",
+		func(changed bool, after DeploymentRevision, message string) {
+			expected := ExpectedRevision{Before: DeploymentRevision{Revision: 1, TemplateHash: "old"}, TemplateChanged: changed}
+			err := expected.Check(&after)
+			if message == "" {
+				Expect(err).ToNot(HaveOccurred())
+				return
+			}
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("rolled out", true, DeploymentRevision{Revision: 2, TemplateHash: "new"}, ""),
+		Entry("kept", false, DeploymentRevision{Revision: 1, TemplateHash: "old"}, ""),
+		Entry("not rolled out", true, DeploymentRevision{Revision: 1, TemplateHash: "old"},
+			"expected revision 2, the pod template changed, got revision 1"),
+		Entry("rolled out unexpectedly", false, DeploymentRevision{Revision: 2, TemplateHash: "new"},
+			"expected revision 1, the pod template is unchanged, got revision 2"),
+		Entry("same hash", true, DeploymentRevision{Revision: 2, TemplateHash: "old"},
+			"pod template hash old is unchanged"),
+	)
+})
@@ -0,0 +1,193 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// S3AccessKeyKey and S3SecretKeyKey hold the credentials of the default
+	// user in the creds secret of a release.
+	S3AccessKeyKey = "RGW_DEFAULT_USER_ACCESS_KEY"
+	S3SecretKeyKey = "RGW_DEFAULT_USER_SECRET_KEY"
+
+	// s3ClientPod runs the S3 commands, one at a time, in the namespace of
+	// the gateway.
+	s3ClientPod = "s3-client"
+)
+
+// S3ClientImage is the image of the pods running the S3 commands.
+var S3ClientImage = "docker.io/amazon/aws-cli:2.13.0"
+
+// Gateway is the S3 endpoint of a release, reached from within its
+// namespace: the commands run in a short-lived pod, the endpoint doesn't
+// need to be exposed.
+type Gateway struct {
+	Namespace string
+	Endpoint  string
+	// CredentialsSecret holds the credentials of the default user, see
+	// S3AccessKeyKey and S3SecretKeyKey. They are read by the pods from
+	// the secret, so they are neither recorded nor audited.
+	CredentialsSecret string
+}
+
+// GatewayOf returns the gateway of the release, using the port named s3 of
+// its service and the credentials of its creds secret.
+func GatewayOf(ctx context.Context, namespace, releaseName string) (*Gateway, error) {
+	name := releaseName + "-" + namespace
+
+	svc, err := GetObject(ctx, "Service", namespace, name)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting the gateway service")
+	}
+	ports, err := JSONPath(svc, "spec.ports")
+	if err != nil {
+		return nil, err
+	}
+	list, _ := ports.([]interface{})
+	port := ""
+	for _, p := range list {
+		pm, _ := p.(map[string]interface{})
+		if port == "" || pm["name"] == "s3" {
+			port = fmt.Sprint(pm["port"])
+		}
+	}
+	if port == "" {
+		return nil, errors.Errorf("service %s/%s has no port", namespace, name)
+	}
+
+	// only the keys of the secret, its values must not be recorded
+	secret := name + "-creds"
+	res, err := KubectlResult(ctx, "get", "secret", "-n", namespace, secret,
+		"-o", `go-template={{range $k, $v := .data}}{{$k}} {{end}}`)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting the gateway credentials")
+	}
+	keys := map[string]bool{}
+	for _, key := range strings.Fields(res.Stdout) {
+		keys[key] = true
+	}
+	for _, key := range []string{S3AccessKeyKey, S3SecretKeyKey} {
+		if !keys[key] {
+			return nil, errors.Errorf("secret %s/%s has no %s", namespace, secret, key)
+		}
+	}
+
+	return &Gateway{
+		Namespace:         namespace,
+		Endpoint:          fmt.Sprintf("http://%s.%s.svc.cluster.local:%s", name, namespace, port),
+		CredentialsSecret: secret,
+	}, nil
+}
+
+// CreateBucket creates bucket.
+func (g *Gateway) CreateBucket(ctx context.Context, bucket string) error {
+	_, err := g.run(ctx, map[string]string{"BUCKET": bucket},
+		`aws s3 mb "s3://$BUCKET"`)
+	return err
+}
+
+// PutObject writes content to the object key of bucket.
+func (g *Gateway) PutObject(ctx context.Context, bucket, key, content string) error {
+	_, err := g.run(ctx, map[string]string{"BUCKET": bucket, "KEY": key, "CONTENT": content},
+		`printf %s "$CONTENT" | aws s3 cp - "s3://$BUCKET/$KEY"`)
+	return err
+}
+
+// GetObject returns the content of the object key of bucket.
+func (g *Gateway) GetObject(ctx context.Context, bucket, key string) (string, error) {
+	res, err := g.run(ctx, map[string]string{"BUCKET": bucket, "KEY": key},
+		`aws s3 cp "s3://$BUCKET/$KEY" -`)
+	if err != nil {
+		return "", err
+	}
+	return res.Stdout, nil
+}
+
+// podDeletedMessage is printed by `kubectl run --rm` after the output of
+// the pod, on the same line if the output doesn't end with a new line.
+var podDeletedMessage = regexp.MustCompile(`pod "` + s3ClientPod + `" deleted\n?$`)
+
+// run runs script with the aws CLI configured for the gateway. The
+// arguments of the script are passed as environment variables, so they are
+// never interpreted by the shell. The output of the pod is returned as is,
+// without the message of its deletion.
+func (g *Gateway) run(ctx context.Context, env map[string]string, script string) (*CommandResult, error) {
+	overrides, err := g.credentialsOverrides()
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"run", s3ClientPod,
+		"-n", g.Namespace,
+		"--image", S3ClientImage,
+		"--restart=Never", "--rm", "-i", "--quiet",
+		"--override-type", "strategic", "--overrides", overrides,
+		"--env", "AWS_DEFAULT_REGION=us-east-1",
+		"--env", "AWS_ENDPOINT_URL=" + g.Endpoint,
+	}
+	// sorted, the arguments are recorded in the cassettes
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "--env", k+"="+env[k])
+	}
+	args = append(args, "--command", "--", "sh", "-c",
+		"aws configure set default.s3.addressing_style path && "+script)
+
+	res, err := KubectlResult(ctx, args...)
+	res.Stdout = podDeletedMessage.ReplaceAllString(res.Stdout, "")
+	res.Combined = podDeletedMessage.ReplaceAllString(res.Combined, "")
+	if err != nil {
+		return res, errors.Wrapf(err, "running %q against the gateway", script)
+	}
+	return res, nil
+}
+
+// credentialsOverrides returns the pod overrides setting the AWS
+// credentials from the secret of the gateway.
+func (g *Gateway) credentialsOverrides() (string, error) {
+	fromSecret := func(name, key string) map[string]interface{} {
+		return map[string]interface{}{
+			"name": name,
+			"valueFrom": map[string]interface{}{
+				"secretKeyRef": map[string]interface{}{"name": g.CredentialsSecret, "key": key},
+			},
+		}
+	}
+	overrides := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{
+					"name": s3ClientPod,
+					"env": []interface{}{
+						fromSecret("AWS_ACCESS_KEY_ID", S3AccessKeyKey),
+						fromSecret("AWS_SECRET_ACCESS_KEY", S3SecretKeyKey),
+					},
+				},
+			},
+		},
+	}
+	// maps are marshalled with sorted keys, the arguments are recorded
+	data, err := json.Marshal(overrides)
+	return string(data), err
+}
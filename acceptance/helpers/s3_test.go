@@ -0,0 +1,96 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers_test
+
+import (
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	"github.com/aquarist-labs/s3gw/acceptance/helpers/fakebin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Gateway", func() {
+	var fake *fakebin.Harness
+
+	BeforeEach(func() {
+		GinkgoT().Setenv(RenderOnlyEnv, "")
+		fake = fakebin.New(GinkgoT(), "kubectl")
+		fake.On("kubectl", `^get service -n s3gw-rb s3gw-s3gw-rb `, fakebin.Response{
+			Stdout: `{"spec": {"ports": [{"name": "s3-tls", "port": 443}, {"name": "s3", "port": 80}]}}`,
+		})
+		fake.On("kubectl", `^get secret -n s3gw-rb s3gw-s3gw-rb-creds `, fakebin.Response{
+			Stdout: "RGW_DEFAULT_USER_ACCESS_KEY RGW_DEFAULT_USER_SECRET_KEY ",
+		})
+	})
+
+	It("finds the endpoint and credentials of the release", func(ctx SpecContext) {
+		gw, err := GatewayOf(ctx, "s3gw-rb", "s3gw")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*gw).To(Equal(Gateway{
+			Namespace:         "s3gw-rb",
+			Endpoint:          "http://s3gw-s3gw-rb.s3gw-rb.svc.cluster.local:80",
+			CredentialsSecret: "s3gw-s3gw-rb-creds",
+		}))
+	})
+
+	It("fails when the secret has no credentials", func(ctx SpecContext) {
+		fake.On("kubectl", `^get secret `, fakebin.Response{Stdout: "RGW_DEFAULT_USER_ACCESS_KEY "})
+
+		_, err := GatewayOf(ctx, "s3gw-rb", "s3gw")
+		Expect(err).To(MatchError("secret s3gw-rb/s3gw-s3gw-rb-creds has no RGW_DEFAULT_USER_SECRET_KEY"))
+	})
+
+	It("runs the S3 commands in a pod, passing the arguments in the environment", func(ctx SpecContext) {
+		fake.On("kubectl", `^run s3-client `, fakebin.Response{Stdout: "hello; world"})
+
+		gw, err := GatewayOf(ctx, "s3gw-rb", "s3gw")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(gw.PutObject(ctx, "data", "some key", "hello; world")).To(Succeed())
+		Expect(gw.GetObject(ctx, "data", "some key")).To(Equal("hello; world"))
+
+		runs := fake.Invocations("kubectl")[2:]
+		Expect(runs).To(HaveLen(2))
+		Expect(runs[0].Args).To(ContainElements("-n", "s3gw-rb", "--rm",
+			"AWS_ENDPOINT_URL=http://s3gw-s3gw-rb.s3gw-rb.svc.cluster.local:80",
+			"BUCKET=data", "CONTENT=hello; world", "KEY=some key"))
+		Expect(runs[0].Args).To(ContainElements("--override-type", "strategic", "--overrides",
+			`{"spec":{"containers":[{"env":[`+
+				`{"name":"AWS_ACCESS_KEY_ID","valueFrom":{"secretKeyRef":{"key":"RGW_DEFAULT_USER_ACCESS_KEY","name":"s3gw-s3gw-rb-creds"}}},`+
+				`{"name":"AWS_SECRET_ACCESS_KEY","valueFrom":{"secretKeyRef":{"key":"RGW_DEFAULT_USER_SECRET_KEY","name":"s3gw-s3gw-rb-creds"}}}`+
+				`],"name":"s3-client"}]}}`))
+		Expect(runs[0].Args[len(runs[0].Args)-1]).To(HaveSuffix(`printf %s "$CONTENT" | aws s3 cp - "s3://$BUCKET/$KEY"`))
+		Expect(runs[1].Args).ToNot(ContainElement(HavePrefix("CONTENT=")))
+	})
+
+	DescribeTable("returns exactly the object body",
+		func(ctx SpecContext, stdout, body string) {
+			fake.On("kubectl", `^run s3-client `, fakebin.Response{Stdout: stdout})
+
+			gw, err := GatewayOf(ctx, "s3gw-rb", "s3gw")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(gw.GetObject(ctx, "data", "key")).To(Equal(body))
+		},
+		Entry("without a trailing new line", `hello; worldpod "s3-client" deleted`+"\n", "hello; world"),
+		Entry("with a trailing new line", "hello\nworld\n"+`pod "s3-client" deleted`+"\n", "hello\nworld\n"),
+		Entry("without the deletion message", "hello\n", "hello\n"),
+		Entry("mentioning the pod", `pod "s3-client" deleted twice`, `pod "s3-client" deleted twice`),
+	)
+
+	It("fails when the command fails", func(ctx SpecContext) {
+		fake.On("kubectl", `^run s3-client `, fakebin.Response{Stderr: "NoSuchBucket", ExitCode: 1})
+
+		gw, err := GatewayOf(ctx, "s3gw-rb", "s3gw")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = gw.GetObject(ctx, "data", "key")
+		Expect(err).To(MatchError(ContainSubstring("against the gateway")))
+	})
+})
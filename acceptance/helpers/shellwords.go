@@ -0,0 +1,94 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SplitShellWords splits s into words like a POSIX shell does, e.g. for the
+// helm arguments of CHARTS_EXTRA_ARGS. Words are separated by unquoted
+// blanks; single quotes preserve every character, double quotes all but the
+// backslash escaping $, `, ", \ and newline; an unquoted backslash preserves
+// the next character. Nothing is expanded: $, ` and globs are literal.
+func SplitShellWords(s string) ([]string, error) {
+	var (
+		words []string
+		word  strings.Builder
+		// inWord is set by quotes too, so that '' is an empty word
+		inWord bool
+	)
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+
+		case c == '\\':
+			inWord = true
+			if i+1 >= len(s) {
+				return nil, errors.Errorf("trailing backslash in %q", s)
+			}
+			i++
+			if s[i] != '\n' {
+				word.WriteByte(s[i])
+			}
+
+		case c == '\'':
+			inWord = true
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.Errorf("unterminated single quote in %q", s)
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+
+		case c == '"':
+			inWord = true
+			closed := false
+			for i++; i < len(s); i++ {
+				c := s[i]
+				if c == '"' {
+					closed = true
+					break
+				}
+				if c == '\\' && i+1 < len(s) && strings.IndexByte("$`\"\\\n", s[i+1]) >= 0 {
+					i++
+					if s[i] != '\n' {
+						word.WriteByte(s[i])
+					}
+					continue
+				}
+				word.WriteByte(c)
+			}
+			if !closed {
+				return nil, errors.Errorf("unterminated double quote in %q", s)
+			}
+
+		default:
+			inWord = true
+			word.WriteByte(c)
+		}
+	}
+
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
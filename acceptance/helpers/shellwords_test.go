@@ -0,0 +1,44 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers_test
+
+import (
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SplitShellWords", func() {
+	DescribeTable("splits like a shell",
+		func(s string, expected []string) {
+			Expect(SplitShellWords(s)).To(Equal(expected))
+		},
+		Entry("nothing", "  ", []string(nil)),
+		Entry("blanks", " --set\ta=b \n--set  c=d ", []string{"--set", "a=b", "--set", "c=d"}),
+		Entry("single quotes", `--set 'msg=hello world' '' 'a\b'`, []string{"--set", "msg=hello world", "", `a\b`}),
+		Entry("double quotes", `--set "msg=say \"hi\" \$HOME \n"`, []string{"--set", `msg=say "hi" $HOME \n`}),
+		Entry("backslashes", `a\ b c\\d e\'f`, []string{"a b", `c\d`, "e'f"}),
+		Entry("line continuations", "a\\\nb \"c\\\nd\"", []string{"ab", "cd"}),
+		Entry("adjacent quotes", `--set-json='tags=["a b",'"\"c\""']'`, []string{`--set-json=tags=["a b","c"]`}),
+		Entry("no expansion", "$HOME `id` *", []string{"$HOME", "`id`", "*"}),
+	)
+
+	DescribeTable("rejects malformed strings",
+		func(s, message string) {
+			_, err := SplitShellWords(s)
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry(nil, `--set 'a=b`, "unterminated single quote"),
+		Entry(nil, `--set "a=b\"`, "unterminated double quote"),
+		Entry(nil, `--set a=b\`, "trailing backslash"),
+	)
+})
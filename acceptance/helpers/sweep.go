@@ -0,0 +1,261 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Orphan is a resource left behind by an acceptance suite.
+type Orphan struct {
+	// Kind is "release", or the kubectl resource type of the object.
+	Kind      string
+	Namespace string
+	Name      string
+	Age       time.Duration
+	// Reason tells why the resource is considered created by the suites.
+	Reason string
+}
+
+func (o Orphan) String() string {
+	if o.Namespace == "" {
+		return o.Kind + "/" + o.Name
+	}
+	return o.Kind + "/" + o.Namespace + "/" + o.Name
+}
+
+// SweepOptions select the orphans returned by FindOrphans.
+type SweepOptions struct {
+	// MinAge spares the resources of suites that may still be running.
+	MinAge time.Duration
+	// Now is the reference time of the ages, time.Now if zero.
+	Now time.Time
+}
+
+var (
+	// suiteNameBases are the bases of the release and namespace names
+	// generated by the suites. The legacy ones were followed by the
+	// nanoseconds of the current time, which almost always have 7 to 9
+	// digits. The legacy bare s3gw base is left out, names like s3gw1 are
+	// common for real deployments.
+	suiteNameBases       = []string{"s3gw-def", "s3gw-cosi", "s3gw-wf", "s3gw-mx", "s3gw-rb", "s3gw-ch", "s3gw"}
+	legacySuiteNameBases = []string{"s3gw-def", "s3gw-acceptance-cosi", "s3gw-cosi", "s3gw-cosi-wf"}
+
+	suiteNamePattern  = regexp.MustCompile(`^(` + strings.Join(suiteNameBases, "|") + `)` + nameSuffixPattern + `$`)
+	legacyNamePattern = regexp.MustCompile(`^(` + strings.Join(legacySuiteNameBases, "|") + `)[0-9]{7,9}$`)
+
+	// suiteClassNames are the cluster scoped COSI classes created by the
+	// COSI suite.
+	suiteClassNames = map[string]bool{
+		"bucket-class-delete":     true,
+		"bucket-access-class-key": true,
+	}
+)
+
+// IsSuiteName reports whether name was generated by the suites, see
+// UniqueName.
+func IsSuiteName(name string) bool {
+	return suiteNamePattern.MatchString(name) || legacyNamePattern.MatchString(name)
+}
+
+// FindOrphans lists the helm releases, the COSI classes and the namespaces
+// created by the suites that are older than opts.MinAge, in the order they
+// must be deleted. Namespaces are matched by the labels of TestNamespace or
+// by name, releases by name or namespace, and classes by name or driver.
+// The COSI classes are skipped on clusters without COSI.
+func FindOrphans(ctx context.Context, opts SweepOptions) ([]Orphan, error) {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	var orphans []Orphan
+	add := func(o Orphan) {
+		if o.Age >= opts.MinAge {
+			orphans = append(orphans, o)
+		}
+	}
+
+	namespaces, err := listObjects(ctx, "namespaces")
+	if err != nil {
+		return nil, err
+	}
+	var orphanNamespaces []Orphan
+	suiteNamespaces := map[string]bool{}
+	for _, ns := range namespaces {
+		name := objectName(ns)
+		reason := ""
+		if run, found, _ := lookupJSONPath(ns, quotedKeyPath("metadata.labels", NamespaceRunLabel)); found {
+			reason = fmt.Sprintf("labeled %s=%v", NamespaceRunLabel, run)
+		} else if IsSuiteName(name) {
+			reason = "name"
+		} else {
+			continue
+		}
+		suiteNamespaces[name] = true
+		orphanNamespaces = append(orphanNamespaces, Orphan{
+			Kind: "namespace", Name: name, Age: objectAge(ns, now), Reason: reason,
+		})
+	}
+
+	releases, err := listReleases(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range releases {
+		reason := ""
+		switch {
+		case suiteNamespaces[r.Namespace]:
+			reason = "namespace"
+		case IsSuiteName(r.Name):
+			reason = "name"
+		default:
+			continue
+		}
+		add(Orphan{Kind: "release", Namespace: r.Namespace, Name: r.Name, Age: r.age(now), Reason: reason})
+	}
+
+	for _, kind := range []string{"bucketclasses", "bucketaccessclasses"} {
+		classes, err := listObjects(ctx, kind)
+		if isMissingResourceType(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, class := range classes {
+			name := objectName(class)
+			reason := ""
+			if suiteClassNames[name] {
+				reason = "name"
+			} else if driver, _ := JSONPath(class, "driverName"); isSuiteDriver(fmt.Sprint(driver)) {
+				reason = fmt.Sprintf("driver %v", driver)
+			} else {
+				continue
+			}
+			add(Orphan{Kind: kind, Name: name, Age: objectAge(class, now), Reason: reason})
+		}
+	}
+
+	for _, ns := range orphanNamespaces {
+		add(ns)
+	}
+	return orphans, nil
+}
+
+// DeleteOrphans deletes orphans, which are expected in the order returned by
+// FindOrphans. It carries on after failures and returns them all. Namespaces
+// are not waited for.
+func DeleteOrphans(ctx context.Context, orphans []Orphan) error {
+	var errs []string
+	for _, o := range orphans {
+		var err error
+		var out string
+		switch o.Kind {
+		case "release":
+			var res *CommandResult
+			res, err = RunResult(ctx, "", false, "helm", "uninstall", "-n", o.Namespace, o.Name)
+			out = res.Combined
+		case "namespace":
+			out, err = KubectlContext(ctx, "delete", "namespace", o.Name, "--ignore-not-found", "--wait=false")
+		default:
+			out, err = KubectlContext(ctx, "delete", o.Kind, o.Name, "--ignore-not-found")
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v: %s", o, err, strings.TrimSpace(out)))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Errorf("%d orphans could not be deleted:\n%s", len(errs), strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// isSuiteDriver reports whether driver is the COSI driver name the chart
+// derives from a release and a namespace generated by the suites.
+func isSuiteDriver(driver string) bool {
+	parts := strings.SplitN(driver, ".", 3)
+	return len(parts) == 3 && parts[2] == "objectstorage.k8s.io" &&
+		IsSuiteName(parts[0]) && IsSuiteName(parts[1])
+}
+
+func isMissingResourceType(err error) bool {
+	var cerr *CommandError
+	return errors.As(err, &cerr) && strings.Contains(cerr.Stderr, "the server doesn't have a resource type")
+}
+
+func listObjects(ctx context.Context, kind string) ([]interface{}, error) {
+	res, err := KubectlResult(ctx, "get", kind, "-ojson")
+	if err != nil {
+		return nil, err
+	}
+	obj, err := ToJSONObject(res.Stdout)
+	if err != nil {
+		return nil, errors.Wrapf(err, "listing %s", kind)
+	}
+	items, _ := JSONPath(obj, "items")
+	list, _ := items.([]interface{})
+	return list, nil
+}
+
+func objectName(obj interface{}) string {
+	name, _ := JSONPath(obj, "metadata.name")
+	return fmt.Sprint(name)
+}
+
+// objectAge returns 0 if the creation timestamp is missing, so that the
+// object is only swept when opts.MinAge is 0.
+func objectAge(obj interface{}, now time.Time) time.Duration {
+	ts, _ := JSONPath(obj, "metadata.creationTimestamp")
+	created, err := time.Parse(time.RFC3339, fmt.Sprint(ts))
+	if err != nil {
+		return 0
+	}
+	return now.Sub(created)
+}
+
+type helmRelease struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Updated   string `json:"updated"`
+}
+
+// helmTimeLayout is the format of the update time in `helm list` output.
+const helmTimeLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// age returns the time since the last release revision, or 0 if it can't
+// be parsed, like objectAge.
+func (r helmRelease) age(now time.Time) time.Duration {
+	updated, err := time.Parse(helmTimeLayout, r.Updated)
+	if err != nil {
+		return 0
+	}
+	return now.Sub(updated)
+}
+
+func listReleases(ctx context.Context) ([]helmRelease, error) {
+	res, err := RunResult(ctx, "", false, "helm", "list", "-A", "-a", "-ojson")
+	if err != nil {
+		return nil, err
+	}
+	var releases []helmRelease
+	if err := json.Unmarshal([]byte(res.Stdout), &releases); err != nil {
+		return nil, errors.Wrap(err, "listing helm releases")
+	}
+	return releases, nil
+}
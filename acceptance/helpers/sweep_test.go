@@ -0,0 +1,134 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers_test
+
+import (
+	"time"
+
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	"github.com/aquarist-labs/s3gw/acceptance/helpers/fakebin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const namespaceListJSON = `{"items": [
+  {"metadata": {"name": "kube-system", "creationTimestamp": "2023-06-01T08:00:00Z"}},
+  {"metadata": {"name": "s3gw1", "creationTimestamp": "2023-06-01T08:00:00Z"}},
+  {"metadata": {"name": "s3gw-acceptance-0", "creationTimestamp": "2023-06-01T08:00:00Z"}},
+  {"metadata": {"name": "s3gw-def-1k3x9q", "creationTimestamp": "2023-06-01T08:00:00Z",
+    "labels": {"s3gw.io/acceptance-run": "seed-42"}}},
+  {"metadata": {"name": "s3gw-acceptance-cosi123456789", "creationTimestamp": "2023-06-01T08:00:00Z"}},
+  {"metadata": {"name": "renamed", "creationTimestamp": "2023-06-01T08:00:00Z",
+    "labels": {"s3gw.io/acceptance-run": "seed-42"}}},
+  {"metadata": {"name": "s3gw-cosi-2ab7cd", "creationTimestamp": "2023-06-01T09:50:00Z"}}
+]}`
+
+const releaseListJSON = `[
+  {"name": "s3gw-0", "namespace": "s3gw-acceptance-0", "updated": "2023-06-01 08:00:00.123456 +0000 UTC"},
+  {"name": "s3gw-def-1a2b3c", "namespace": "s3gw-def-1k3x9q", "updated": "2023-06-01 08:00:00.123456 +0000 UTC"},
+  {"name": "custom", "namespace": "renamed", "updated": "2023-06-01 08:00:00.123456 +0000 UTC"},
+  {"name": "s3gw2", "namespace": "s3gw1", "updated": "2023-06-01 08:00:00.123456 +0000 UTC"}
+]`
+
+const bucketClassListJSON = `{"items": [
+  {"metadata": {"name": "bucket-class-delete", "creationTimestamp": "2023-06-01T08:00:00Z"}},
+  {"metadata": {"name": "user-class", "creationTimestamp": "2023-06-01T08:00:00Z"}, "driverName": "s3gw-0.s3gw-acceptance-0.objectstorage.k8s.io"},
+  {"metadata": {"name": "wf-class", "creationTimestamp": "2023-06-01T08:00:00Z"}, "driverName": "s3gw-wf-1abcde.s3gw-wf-1fghij.objectstorage.k8s.io"}
+]}`
+
+var _ = Describe("Sweep", func() {
+	var fake *fakebin.Harness
+	opts := SweepOptions{
+		MinAge: time.Hour,
+		Now:    time.Date(2023, 6, 1, 10, 0, 0, 0, time.UTC),
+	}
+
+	BeforeEach(func() {
+		fake = fakebin.New(GinkgoT(), "kubectl", "helm")
+		fake.On("kubectl", `^get namespaces -ojson$`, fakebin.Response{Stdout: namespaceListJSON})
+		fake.On("kubectl", `^get bucketclasses -ojson$`, fakebin.Response{Stdout: bucketClassListJSON})
+		fake.On("kubectl", `^get bucketaccessclasses -ojson$`, fakebin.Response{
+			Stderr:   `error: the server doesn't have a resource type "bucketaccessclasses"`,
+			ExitCode: 1,
+		})
+		fake.On("kubectl", `^delete`, fakebin.Response{})
+		fake.On("helm", `^list -A -a -ojson$`, fakebin.Response{Stdout: releaseListJSON})
+		fake.On("helm", `^uninstall`, fakebin.Response{})
+	})
+
+	DescribeTable("recognizes the names generated by the suites",
+		func(name string, expected bool) {
+			Expect(IsSuiteName(name)).To(Equal(expected))
+		},
+		Entry(nil, "s3gw-def-1k3x9q", true),
+		Entry(nil, "s3gw-12abcde", true),
+		Entry(nil, "s3gw-mx-2ab3cd", true),
+		Entry(nil, "s3gw-rb-1x2y3z", true),
+		Entry(nil, "s3gw-ch-4d5e6f", true),
+		Entry(nil, "s3gw-acceptance-cosi123456789", true),
+		Entry(nil, "s3gw-def1234567", true),
+		Entry(nil, "s3gw-def12", false),
+		Entry(nil, "s3gw1", false),
+		Entry(nil, "s3gw123456789", false),
+		Entry(nil, "s3gw-acceptance-0", false),
+		Entry(nil, "s3gw-0", false),
+		Entry(nil, "s3gw-other-1k3x9q", false),
+	)
+
+	It("finds the old resources of the suites, in deletion order", func(ctx SpecContext) {
+		orphans, err := FindOrphans(ctx, opts)
+		Expect(err).ToNot(HaveOccurred())
+
+		var names []string
+		for _, o := range orphans {
+			names = append(names, o.String())
+		}
+		Expect(names).To(Equal([]string{
+			"release/s3gw-def-1k3x9q/s3gw-def-1a2b3c",
+			"release/renamed/custom",
+			"bucketclasses/bucket-class-delete",
+			"bucketclasses/wf-class",
+			"namespace/s3gw-def-1k3x9q",
+			"namespace/s3gw-acceptance-cosi123456789",
+			"namespace/renamed",
+		}))
+		Expect(orphans[0].Age).To(BeNumerically("~", 2*time.Hour, time.Second))
+		Expect(orphans[4].Reason).To(Equal("labeled s3gw.io/acceptance-run=seed-42"))
+	})
+
+	It("deletes the orphans", func(ctx SpecContext) {
+		err := DeleteOrphans(ctx, []Orphan{
+			{Kind: "release", Namespace: "s3gw-def-1k3x9q", Name: "s3gw-def-1a2b3c"},
+			{Kind: "bucketclasses", Name: "bucket-class-delete"},
+			{Kind: "namespace", Name: "s3gw-def-1k3x9q"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(fake.Invocations("")).To(HaveExactElements(
+			HaveField("Args", []string{"uninstall", "-n", "s3gw-def-1k3x9q", "s3gw-def-1a2b3c"}),
+			HaveField("Args", []string{"delete", "bucketclasses", "bucket-class-delete", "--ignore-not-found"}),
+			HaveField("Args", []string{"delete", "namespace", "s3gw-def-1k3x9q", "--ignore-not-found", "--wait=false"}),
+		))
+	})
+
+	It("carries on after failures", func(ctx SpecContext) {
+		fake.On("helm", `^uninstall`, fakebin.Response{Stderr: "Error: uninstall: Release not loaded", ExitCode: 1})
+
+		err := DeleteOrphans(ctx, []Orphan{
+			{Kind: "release", Namespace: "s3gw-def-1k3x9q", Name: "s3gw-def-1a2b3c"},
+			{Kind: "namespace", Name: "s3gw-def-1k3x9q"},
+		})
+		Expect(err).To(MatchError(ContainSubstring("1 orphans could not be deleted")))
+		Expect(err).To(MatchError(ContainSubstring("release/s3gw-def-1k3x9q/s3gw-def-1a2b3c")))
+		Expect(fake.Invocations("kubectl")).To(HaveLen(1))
+	})
+})
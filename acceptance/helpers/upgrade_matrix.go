@@ -0,0 +1,291 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The statuses of an UpgradeResult.
+const (
+	UpgradePassed       = "passed"
+	UpgradeFailed       = "failed"
+	UpgradeIncompatible = "incompatible"
+)
+
+// UpgradePair is an upgrade from a version to a later one.
+type UpgradePair struct {
+	From ChainVersion
+	To   ChainVersion
+}
+
+// Name identifies the pair in the result files and badges, e.g.
+// `0.14.0_0.15.0`.
+func (p UpgradePair) Name() string {
+	return p.From.ChartsVer + "_" + p.To.ChartsVer
+}
+
+// UpgradePairs returns every forward pair of versions, listed in release
+// order: each version is paired with all the versions following it.
+func UpgradePairs(versions []ChainVersion) []UpgradePair {
+	var pairs []UpgradePair
+	for i := range versions {
+		for _, to := range versions[i+1:] {
+			pairs = append(pairs, UpgradePair{From: versions[i], To: to})
+		}
+	}
+	return pairs
+}
+
+// UpgradeResult is the outcome of the upgrade suite for a pair, one JSON
+// line of the upgrade matrix output.
+type UpgradeResult struct {
+	From     string        `json:"from"`
+	To       string        `json:"to"`
+	Status   string        `json:"status"`
+	Duration time.Duration `json:"duration,omitempty"`
+	// Report is the ginkgo JSON report of the run.
+	Report string `json:"report,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// UpgradeMatrixOptions configure RunUpgradeMatrix.
+type UpgradeMatrixOptions struct {
+	// Dir is the upgrade suite, run with ginkgo.
+	Dir string
+	// ReportDir receives the ginkgo JSON report of every pair.
+	ReportDir string
+	// GinkgoArgs are added to the ginkgo command line. A label filter among
+	// them is combined with the one excluding the chain specs.
+	GinkgoArgs []string
+	// Parallel is the number of pairs tested at once, 1 if not positive.
+	// Each run installs in namespaces of its own.
+	Parallel int
+	// Timeout bounds the run of a pair.
+	Timeout time.Duration
+	// Incompatible lists the pairs not run, by name.
+	Incompatible map[string]bool
+	// OnResult is called as each pair completes, possibly concurrently.
+	OnResult func(UpgradeResult)
+}
+
+// RunUpgradeMatrix runs the upgrade suite for every pair, overriding the
+// versions of the suite properties through the environment, and returns the
+// results in the order of pairs.
+// It refuses to run when the runs of the pairs would share a release, a
+// namespace or a cassette, see checkUpgradeMatrixIsolation.
+func RunUpgradeMatrix(ctx context.Context, opts UpgradeMatrixOptions, pairs []UpgradePair) ([]UpgradeResult, error) {
+	if err := checkUpgradeMatrixIsolation(opts.Dir); err != nil {
+		return nil, err
+	}
+	ginkgoArgs, err := upgradeGinkgoArgs(opts.GinkgoArgs)
+	if err != nil {
+		return nil, err
+	}
+	opts.GinkgoArgs = ginkgoArgs
+
+	parallel := opts.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	results := make([]UpgradeResult, len(pairs))
+	var mu sync.Mutex
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, pair := range pairs {
+		i, pair := i, pair
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			res := runUpgradePair(ctx, opts, pair)
+			results[i] = res
+			if opts.OnResult != nil {
+				mu.Lock()
+				opts.OnResult(res)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// checkUpgradeMatrixIsolation returns an error when the environment or the
+// suite properties of the suite in dir set the release or the namespace, or
+// when a cassette mode is set: every pair would install the same release in
+// the same namespace, and the cassettes are named after the specs, which are
+// the same for every pair. The properties of the file can not be cleared
+// through the environment, so the pairs can not simply be run without them.
+func checkUpgradeMatrixIsolation(dir string) error {
+	var set []string
+	for _, key := range []string{PropRelease, PropNamespace, CassetteModeEnv} {
+		if os.Getenv(key) != "" {
+			set = append(set, key+" in the environment")
+		}
+	}
+
+	path := filepath.Join(dir, SuitePropertiesFile)
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "reading suite properties %s", path)
+	}
+	if err == nil {
+		var props SuiteProperties
+		if err := json.Unmarshal(data, &props); err != nil {
+			return errors.Wrapf(err, "parsing suite properties %s", path)
+		}
+		for _, f := range props.fields() {
+			if (f.key == PropRelease || f.key == PropNamespace) && *f.value != "" {
+				set = append(set, f.key+" in "+path)
+			}
+		}
+	}
+
+	if len(set) > 0 {
+		return errors.Errorf("the upgrade matrix runs every pair in a release and namespace of its own, unset %s", strings.Join(set, ", "))
+	}
+	return nil
+}
+
+// upgradeGinkgoArgs returns args with their label filter, if any, combined
+// with the one excluding the chain specs, which run every version at once.
+// As with ginkgo the last label filter wins, the arguments following `--`
+// are passed to the suite and left alone.
+func upgradeGinkgoArgs(args []string) ([]string, error) {
+	filter := "!Chain"
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "label-filter" {
+			rest = append(rest, arg)
+			continue
+		}
+		if !hasValue {
+			if i+1 == len(args) {
+				return nil, errors.Errorf("ginkgo argument %s needs a value", arg)
+			}
+			i++
+			value = args[i]
+		}
+		filter = "!Chain"
+		if strings.TrimSpace(value) != "" {
+			filter += " && (" + value + ")"
+		}
+	}
+	return append([]string{"--label-filter", filter}, rest...), nil
+}
+
+func runUpgradePair(ctx context.Context, opts UpgradeMatrixOptions, pair UpgradePair) UpgradeResult {
+	res := UpgradeResult{From: pair.From.String(), To: pair.To.String()}
+	if opts.Incompatible[pair.Name()] {
+		res.Status = UpgradeIncompatible
+		return res
+	}
+	if ctx.Err() != nil {
+		res.Status = UpgradeFailed
+		res.Error = ctx.Err().Error()
+		return res
+	}
+
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	report, err := filepath.Abs(filepath.Join(opts.ReportDir, "u"+pair.Name()+".json"))
+	if err != nil {
+		res.Status = UpgradeFailed
+		res.Error = err.Error()
+		return res
+	}
+	res.Report = report
+
+	// env sets the properties for ginkgo alone, the runs share the process
+	// environment
+	args := []string{
+		PropChartsVerPrev + "=" + pair.From.ChartsVer,
+		PropImageTagPrev + "=" + pair.From.ImageTag,
+		PropChartsVer + "=" + pair.To.ChartsVer,
+		PropImageTag + "=" + pair.To.ImageTag,
+		"ginkgo", "--json-report", report,
+	}
+	args = append(args, opts.GinkgoArgs...)
+	args = append(args, ".")
+
+	cmd, err := RunResult(ctx, opts.Dir, false, "env", args...)
+	res.Duration = cmd.Duration.Round(time.Second)
+	if err != nil {
+		res.Status = UpgradeFailed
+		res.Error = errors.Wrapf(err, "upgrade %s", pair.Name()).Error()
+		return res
+	}
+	res.Status = UpgradePassed
+	return res
+}
+
+// UpgradeMatrixTable renders the results as the markdown table of the
+// README, the versions in rows being upgraded to the ones in columns.
+func UpgradeMatrixTable(versions []ChainVersion, results []UpgradeResult) string {
+	if len(versions) < 2 {
+		return ""
+	}
+
+	status := map[string]string{}
+	for _, r := range results {
+		status[r.From+"_"+r.To] = r.Status
+	}
+	badges := map[string]string{
+		UpgradePassed:       "![.](./assets/OK.svg)",
+		UpgradeFailed:       "![.](./assets/KO.svg)",
+		UpgradeIncompatible: "![.](./assets/not-apply.svg)",
+	}
+
+	var b strings.Builder
+	b.WriteString("| From/To |")
+	for _, to := range versions[1:] {
+		fmt.Fprintf(&b, " %s |", to)
+	}
+	b.WriteString("\n|:-------:|")
+	b.WriteString(strings.Repeat(":------:|", len(versions)-1))
+	b.WriteString("\n")
+	for i, from := range versions[:len(versions)-1] {
+		fmt.Fprintf(&b, "| %s |", from)
+		for j, to := range versions[1:] {
+			cell := ""
+			if j >= i {
+				cell = badges[status[from.String()+"_"+to.String()]]
+			}
+			fmt.Fprintf(&b, "%s|", cell)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,169 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	"github.com/aquarist-labs/s3gw/acceptance/helpers/fakebin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Upgrade matrix", func() {
+	versions := []ChainVersion{
+		{ChartsVer: "0.14.0", ImageTag: "0.14.0"},
+		{ChartsVer: "0.15.0", ImageTag: "0.15.0"},
+		{ChartsVer: "0.16.0", ImageTag: "0.16.1"},
+	}
+
+	var suite string
+
+	BeforeEach(func() {
+		for _, key := range []string{PropRelease, PropNamespace, CassetteModeEnv} {
+			GinkgoT().Setenv(key, "")
+		}
+		// the suite properties are read from the parent of the suite
+		suite = filepath.Join(GinkgoT().TempDir(), "upgrade")
+		Expect(os.Mkdir(suite, 0o755)).To(Succeed())
+	})
+
+	It("pairs every version with the later ones", func() {
+		var names []string
+		for _, p := range UpgradePairs(versions) {
+			names = append(names, p.Name())
+		}
+		Expect(names).To(Equal([]string{"0.14.0_0.15.0", "0.14.0_0.16.0", "0.15.0_0.16.0"}))
+	})
+
+	It("runs the upgrade suite for every pair and reports the results", func(ctx SpecContext) {
+		fake := fakebin.New(GinkgoT(), "ginkgo")
+		fake.On("ginkgo", `.`, fakebin.Response{Stdout: "SUCCESS!"})
+		fake.On("ginkgo", `u0\.15\.0_0\.16\.0\.json`, fakebin.Response{Stdout: "FAIL!", ExitCode: 1})
+
+		reports := GinkgoT().TempDir()
+		var streamed []UpgradeResult
+		results, err := RunUpgradeMatrix(ctx, UpgradeMatrixOptions{
+			Dir:          suite,
+			ReportDir:    reports,
+			GinkgoArgs:   []string{"-v"},
+			Parallel:     2,
+			Incompatible: map[string]bool{"0.14.0_0.16.0": true},
+			OnResult:     func(r UpgradeResult) { streamed = append(streamed, r) },
+		}, UpgradePairs(versions))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(results).To(HaveExactElements(
+			And(HaveField("From", "0.14.0"), HaveField("To", "0.15.0"), HaveField("Status", UpgradePassed),
+				HaveField("Report", filepath.Join(reports, "u0.14.0_0.15.0.json"))),
+			And(HaveField("To", "0.16.0:0.16.1"), HaveField("Status", UpgradeIncompatible)),
+			And(HaveField("From", "0.15.0"), HaveField("Status", UpgradeFailed),
+				HaveField("Error", ContainSubstring("upgrade 0.15.0_0.16.0"))),
+		))
+		Expect(streamed).To(ConsistOf(results))
+
+		runs := fake.Invocations("ginkgo")
+		Expect(runs).To(HaveLen(2))
+		for _, run := range runs {
+			Expect(run.Dir).To(Equal(suite))
+			Expect(run.Args).To(ContainElements("--label-filter", "!Chain", "-v"))
+			Expect(run.Args[len(run.Args)-1]).To(Equal("."))
+		}
+	})
+
+	DescribeTable("combines the label filter of the ginkgo arguments with the one excluding the chain specs",
+		func(ctx SpecContext, args []string, expected []string) {
+			fake := fakebin.New(GinkgoT(), "ginkgo")
+			fake.On("ginkgo", `.`, fakebin.Response{})
+
+			_, err := RunUpgradeMatrix(ctx, UpgradeMatrixOptions{
+				Dir:        suite,
+				ReportDir:  GinkgoT().TempDir(),
+				GinkgoArgs: args,
+			}, UpgradePairs(versions[:2]))
+			Expect(err).ToNot(HaveOccurred())
+
+			runs := fake.Invocations("ginkgo")
+			Expect(runs).To(HaveLen(1))
+			elements := []interface{}{"--json-report", HaveSuffix("u0.14.0_0.15.0.json")}
+			for _, arg := range append(expected, ".") {
+				elements = append(elements, arg)
+			}
+			Expect(runs[0].Args).To(HaveExactElements(elements...))
+		},
+		Entry("without a filter", []string{"-v"},
+			[]string{"--label-filter", "!Chain", "-v"}),
+		Entry("with a separate value", []string{"-v", "--label-filter", "S3 || Slow"},
+			[]string{"--label-filter", "!Chain && (S3 || Slow)", "-v"}),
+		Entry("with an inline value", []string{"-label-filter=S3"},
+			[]string{"--label-filter", "!Chain && (S3)"}),
+		Entry("keeping the last filter", []string{"--label-filter", "S3", "--label-filter=Slow"},
+			[]string{"--label-filter", "!Chain && (Slow)"}),
+		Entry("with an empty filter", []string{"--label-filter="},
+			[]string{"--label-filter", "!Chain"}),
+		Entry("leaving the suite arguments alone", []string{"--", "--label-filter", "S3"},
+			[]string{"--label-filter", "!Chain", "--", "--label-filter", "S3"}),
+	)
+
+	It("fails on a label filter without a value", func(ctx SpecContext) {
+		_, err := RunUpgradeMatrix(ctx, UpgradeMatrixOptions{
+			Dir:        suite,
+			GinkgoArgs: []string{"-v", "--label-filter"},
+		}, UpgradePairs(versions))
+		Expect(err).To(MatchError("ginkgo argument --label-filter needs a value"))
+	})
+
+	Describe("refuses to run pairs sharing a release, a namespace or a cassette", func() {
+		run := func(ctx SpecContext) error {
+			fake := fakebin.New(GinkgoT(), "ginkgo")
+			_, err := RunUpgradeMatrix(ctx, UpgradeMatrixOptions{
+				Dir:       suite,
+				ReportDir: GinkgoT().TempDir(),
+			}, UpgradePairs(versions))
+			Expect(fake.Invocations("ginkgo")).To(BeEmpty())
+			return err
+		}
+
+		DescribeTable("set in the environment",
+			func(ctx SpecContext, key string) {
+				GinkgoT().Setenv(key, "value")
+				Expect(run(ctx)).To(MatchError(ContainSubstring("unset " + key + " in the environment")))
+			},
+			Entry("the release", PropRelease),
+			Entry("the namespace", PropNamespace),
+			Entry("the cassette mode", CassetteModeEnv),
+		)
+
+		It("set in the suite properties", func(ctx SpecContext) {
+			path := filepath.Join(suite, SuitePropertiesFile)
+			Expect(os.WriteFile(path, []byte(`{"RELEASE": "s3gw", "NAMESPACE": "s3gw-ns", "CHARTS_VER": "0.14.0"}`), 0o644)).To(Succeed())
+
+			Expect(run(ctx)).To(MatchError(ContainSubstring(
+				"unset RELEASE in " + path + ", NAMESPACE in " + path)))
+		})
+	})
+
+	It("renders the results as the README table", func() {
+		table := UpgradeMatrixTable(versions, []UpgradeResult{
+			{From: "0.14.0", To: "0.15.0", Status: UpgradePassed},
+			{From: "0.14.0", To: "0.16.0:0.16.1", Status: UpgradeIncompatible},
+			{From: "0.15.0", To: "0.16.0:0.16.1", Status: UpgradeFailed},
+		})
+		Expect(table).To(Equal(`| From/To | 0.15.0 | 0.16.0:0.16.1 |
+|:-------:|:------:|:------:|
+| 0.14.0 |![.](./assets/OK.svg)|![.](./assets/not-apply.svg)|
+| 0.15.0 ||![.](./assets/KO.svg)|
+`))
+	})
+})
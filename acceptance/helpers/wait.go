@@ -0,0 +1,316 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/types"
+	"github.com/pkg/errors"
+)
+
+var (
+	// DefaultWaitTimeout bounds the WaitFor helpers, see WithWaitTimeout.
+	DefaultWaitTimeout = 5 * time.Minute
+	// DefaultWaitInterval is the polling interval of the WaitFor helpers,
+	// see WithWaitInterval.
+	DefaultWaitInterval = 2 * time.Second
+	// MaxWaitEvents is the number of recent events included in the failure
+	// message of the WaitFor helpers.
+	MaxWaitEvents = 10
+
+	// diagnosticsTimeout bounds the commands collecting the failure details.
+	diagnosticsTimeout = 30 * time.Second
+)
+
+// WaitOption configures the WaitFor helpers.
+type WaitOption func(*waitConfig)
+
+type waitConfig struct {
+	timeout  time.Duration
+	interval time.Duration
+}
+
+// WithWaitTimeout sets how long to wait before failing.
+func WithWaitTimeout(timeout time.Duration) WaitOption {
+	return func(c *waitConfig) { c.timeout = timeout }
+}
+
+// WithWaitInterval sets how often the object is polled.
+func WithWaitInterval(interval time.Duration) WaitOption {
+	return func(c *waitConfig) { c.interval = interval }
+}
+
+// WaitForRollout waits until every replica of the deployment is updated and
+// available, like `kubectl rollout status`. It fails right away if the
+// deployment exceeded its progress deadline.
+func WaitForRollout(ctx context.Context, namespace, deployment string, opts ...WaitOption) {
+	w := newWaiter(ctx, namespace, "deployment", deployment, opts)
+	w.wait(func(g Gomega) {
+		obj := w.get(g)
+		if err := rolloutProgress(obj); errors.Is(err, errProgressDeadlineExceeded) {
+			StopTrying(err.Error()).Now()
+		}
+		g.Expect(obj).To(beRolledOut())
+	}, "to be rolled out")
+}
+
+// WaitForCondition waits until the object has the condition, given as `Type`
+// or `Type=Status` like `kubectl wait --for=condition=...`. The status
+// defaults to True. An empty namespace is used for cluster scoped objects.
+func WaitForCondition(ctx context.Context, namespace, kind, name, condition string, opts ...WaitOption) {
+	conditionType, status, found := strings.Cut(condition, "=")
+	if !found {
+		status = "True"
+	}
+	if status != "" {
+		status = strings.ToUpper(status[:1]) + strings.ToLower(status[1:])
+	}
+
+	w := newWaiter(ctx, namespace, kind, name, opts)
+	w.wait(func(g Gomega) {
+		g.Expect(w.get(g)).To(&haveEntryMatcher{list: "status.conditions", fields: []entryField{
+			{"type", conditionType},
+			{"status", status},
+		}})
+	}, fmt.Sprintf("to have condition %s=%s", conditionType, status))
+}
+
+// WaitForJSONPath waits until the node at path of the object satisfies
+// matcher, see HaveJSONPath.
+func WaitForJSONPath(ctx context.Context, namespace, kind, name, path string, matcher types.GomegaMatcher, opts ...WaitOption) {
+	w := newWaiter(ctx, namespace, kind, name, opts)
+	w.wait(func(g Gomega) {
+		g.Expect(w.get(g)).To(HaveJSONPath(path, matcher))
+	}, fmt.Sprintf("to have JSON path %q", path))
+}
+
+// WaitForDeleted waits until the object doesn't exist anymore.
+func WaitForDeleted(ctx context.Context, namespace, kind, name string, opts ...WaitOption) {
+	w := newWaiter(ctx, namespace, kind, name, opts)
+	w.wait(func(g Gomega) {
+		res, err := KubectlResult(w.ctx, w.args("get", "--ignore-not-found")...)
+		w.observe(res, err)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(strings.TrimSpace(res.Stdout)).To(BeEmpty(), "object still exists")
+	}, "to be deleted")
+}
+
+var errProgressDeadlineExceeded = errors.New("deployment exceeded its progress deadline")
+
+// rolloutProgress returns an error describing why the rollout of the
+// deployment is not complete, following `kubectl rollout status`.
+func rolloutProgress(obj interface{}) error {
+	number := func(path string, def float64) float64 {
+		if v, err := JSONPath(obj, path); err == nil {
+			if n, ok := v.(float64); ok {
+				return n
+			}
+		}
+		return def
+	}
+
+	if number("status.observedGeneration", 0) < number("metadata.generation", 0) {
+		return errors.New("waiting for the deployment spec update to be observed")
+	}
+
+	conditions, _ := JSONPath(obj, "status.conditions")
+	list, _ := conditions.([]interface{})
+	for _, c := range list {
+		t, _ := JSONPath(c, "type")
+		reason, _ := JSONPath(c, "reason")
+		if t == "Progressing" && reason == "ProgressDeadlineExceeded" {
+			return errProgressDeadlineExceeded
+		}
+	}
+
+	replicas := number("spec.replicas", 1)
+	updated := number("status.updatedReplicas", 0)
+	available := number("status.availableReplicas", 0)
+	total := number("status.replicas", 0)
+	switch {
+	case updated < replicas:
+		return errors.Errorf("%v out of %v new replicas have been updated", updated, replicas)
+	case total > updated:
+		return errors.Errorf("%v old replicas are pending termination", total-updated)
+	case available < updated:
+		return errors.Errorf("%v of %v updated replicas are available", available, updated)
+	}
+	return nil
+}
+
+func beRolledOut() types.GomegaMatcher {
+	return &rolledOutMatcher{}
+}
+
+type rolledOutMatcher struct {
+	err error
+}
+
+func (m *rolledOutMatcher) Match(actual interface{}) (bool, error) {
+	m.err = rolloutProgress(actual)
+	return m.err == nil, nil
+}
+
+func (m *rolledOutMatcher) FailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected the deployment to be rolled out: %v", m.err)
+}
+
+func (m *rolledOutMatcher) NegatedFailureMessage(actual interface{}) string {
+	return "Expected the deployment not to be rolled out"
+}
+
+// waiter polls an object, keeping its last observed state for the failure
+// message.
+type waiter struct {
+	ctx       context.Context
+	namespace string
+	kind      string
+	name      string
+	cfg       waitConfig
+
+	mu   sync.Mutex
+	last string
+}
+
+func newWaiter(ctx context.Context, namespace, kind, name string, opts []WaitOption) *waiter {
+	w := &waiter{
+		ctx:       ctx,
+		namespace: namespace,
+		kind:      kind,
+		name:      name,
+		cfg:       waitConfig{timeout: DefaultWaitTimeout, interval: DefaultWaitInterval},
+	}
+	for _, opt := range opts {
+		opt(&w.cfg)
+	}
+	return w
+}
+
+// wait polls until poll succeeds, failing the spec on timeout.
+func (w *waiter) wait(poll func(g Gomega), description string) {
+	EventuallyWithOffset(2, poll).
+		WithContext(w.ctx).
+		WithTimeout(w.cfg.timeout).
+		WithPolling(w.cfg.interval).
+		Should(Succeed(), func() string { return w.report(description) })
+}
+
+func (w *waiter) ref() string {
+	if w.namespace == "" {
+		return w.kind + "/" + w.name
+	}
+	return fmt.Sprintf("%s/%s in namespace %s", w.kind, w.name, w.namespace)
+}
+
+func (w *waiter) args(verb string, extra ...string) []string {
+	args := []string{verb, w.kind, w.name}
+	if w.namespace != "" {
+		args = append(args, "-n", w.namespace)
+	}
+	return append(append(args, extra...), "-ojson")
+}
+
+// get fetches the object, failing the poll if it can't be fetched.
+func (w *waiter) get(g Gomega) interface{} {
+	res, err := KubectlResult(w.ctx, w.args("get")...)
+	w.observe(res, err)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	obj, err := ToJSONObject(res.Stdout)
+	g.Expect(err).ToNot(HaveOccurred())
+	return obj
+}
+
+func (w *waiter) observe(res *CommandResult, err error) {
+	state := res.Stdout
+	if err != nil {
+		state = err.Error()
+	} else if obj, err := ToJSONObject(res.Stdout); err == nil {
+		if m, ok := obj.(map[string]interface{}); ok {
+			if metadata, ok := m["metadata"].(map[string]interface{}); ok {
+				delete(metadata, "managedFields")
+			}
+		}
+		if data, err := json.MarshalIndent(obj, "", "  "); err == nil {
+			state = string(data)
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.last = state
+}
+
+// report describes the last observed state of the object and its recent
+// events.
+func (w *waiter) report(description string) string {
+	w.mu.Lock()
+	last := w.last
+	w.mu.Unlock()
+	if strings.TrimSpace(last) == "" {
+		last = "<none>"
+	}
+
+	return fmt.Sprintf("waiting for %s %s\nlast observed state:\n%s\nrecent events:\n%s",
+		w.ref(), description, truncateOutput(last, MaxAuditOutput), w.recentEvents())
+}
+
+// recentEvents returns the last events about the object, or about the
+// objects generated from it, e.g. the pods of a deployment.
+func (w *waiter) recentEvents() string {
+	// the spec context may be done already
+	ctx := w.ctx
+	if ctx.Err() != nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, diagnosticsTimeout)
+	defer cancel()
+
+	args := []string{"get", "events", "--sort-by=.lastTimestamp"}
+	if w.namespace == "" {
+		args = append(args, "-A")
+	} else {
+		args = append(args, "-n", w.namespace)
+	}
+	res, err := KubectlResult(ctx, args...)
+	if err != nil {
+		return fmt.Sprintf("<unavailable: %v>", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(res.Stdout), "\n")
+	if len(lines) < 2 {
+		return "<none>"
+	}
+	// pods and replica sets are named <name>-<hash>[-<id>]
+	involved := regexp.MustCompile(`/` + regexp.QuoteMeta(w.name) + `(-[a-z0-9]{5,10}){0,2}\s`)
+	var events []string
+	for _, l := range lines[1:] {
+		if involved.MatchString(l) {
+			events = append(events, l)
+		}
+	}
+	if len(events) == 0 {
+		return "<none>"
+	}
+	if len(events) > MaxWaitEvents {
+		events = events[len(events)-MaxWaitEvents:]
+	}
+	return strings.Join(append([]string{lines[0]}, events...), "\n")
+}
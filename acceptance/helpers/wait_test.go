@@ -0,0 +1,144 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers_test
+
+import (
+	"time"
+
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	"github.com/aquarist-labs/s3gw/acceptance/helpers/fakebin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const eventsTable = `NAMESPACE   LAST SEEN   TYPE      REASON    OBJECT                      MESSAGE
+ns          10s         Normal    Pulled    pod/s3gw-ui-5d8f7-abcde     Container image already present
+ns          5s          Warning   Failed    pod/s3gw-7c9b4-xyz12        Error: ImagePullBackOff
+`
+
+var _ = Describe("WaitFor", func() {
+	var fake *fakebin.Harness
+	opts := []WaitOption{WithWaitTimeout(500 * time.Millisecond), WithWaitInterval(10 * time.Millisecond)}
+
+	BeforeEach(func() {
+		fake = fakebin.New(GinkgoT(), "kubectl")
+		fake.On("kubectl", `^get events`, fakebin.Response{Stdout: eventsTable})
+	})
+
+	Describe("WaitForRollout", func() {
+		It("succeeds once every replica is updated and available", func(ctx SpecContext) {
+			fake.On("kubectl", `^get deployment s3gw -n ns -ojson$`, fakebin.Response{Stdout: `{
+				"metadata": {"generation": 2},
+				"spec": {"replicas": 2},
+				"status": {"observedGeneration": 2, "replicas": 2, "updatedReplicas": 2, "availableReplicas": 2}
+			}`})
+
+			WaitForRollout(ctx, "ns", "s3gw", opts...)
+			Expect(fake.Invocations("kubectl")).To(HaveLen(1))
+		})
+
+		It("reports the last state and the recent events on timeout", func(ctx SpecContext) {
+			fake.On("kubectl", `^get deployment s3gw -n ns -ojson$`, fakebin.Response{Stdout: `{
+				"metadata": {"generation": 2, "managedFields": [{"manager": "helm"}]},
+				"spec": {"replicas": 2},
+				"status": {"observedGeneration": 2, "replicas": 2, "updatedReplicas": 2, "availableReplicas": 1}
+			}`})
+
+			failures := InterceptGomegaFailures(func() {
+				WaitForRollout(ctx, "ns", "s3gw", opts...)
+			})
+			Expect(failures).To(HaveLen(1))
+			Expect(failures[0]).To(And(
+				ContainSubstring("waiting for deployment/s3gw in namespace ns to be rolled out"),
+				ContainSubstring("1 of 2 updated replicas are available"),
+				ContainSubstring(`"availableReplicas": 1`),
+				ContainSubstring("pod/s3gw-7c9b4-xyz12"),
+				ContainSubstring("LAST SEEN"),
+			))
+			Expect(failures[0]).ToNot(ContainSubstring("managedFields"))
+			Expect(failures[0]).ToNot(ContainSubstring("s3gw-ui"))
+		})
+
+		It("stops waiting when the progress deadline is exceeded", func(ctx SpecContext) {
+			fake.On("kubectl", `^get deployment s3gw -n ns -ojson$`, fakebin.Response{Stdout: `{
+				"spec": {"replicas": 1},
+				"status": {"conditions": [{"type": "Progressing", "status": "False", "reason": "ProgressDeadlineExceeded"}]}
+			}`})
+
+			failures := InterceptGomegaFailures(func() {
+				WaitForRollout(ctx, "ns", "s3gw", WithWaitTimeout(time.Minute), WithWaitInterval(10*time.Millisecond))
+			})
+			Expect(failures).To(ConsistOf(ContainSubstring("exceeded its progress deadline")))
+			Expect(fake.Invocations("kubectl")).To(HaveLen(2))
+		})
+	})
+
+	Describe("WaitForCondition", func() {
+		BeforeEach(func() {
+			fake.On("kubectl", `^get bucketclaim claim -n ns -ojson$`, fakebin.Response{Stdout: `{
+				"status": {"conditions": [{"type": "Ready", "status": "False"}]}
+			}`})
+		})
+
+		It("matches the condition type and status", func(ctx SpecContext) {
+			WaitForCondition(ctx, "ns", "bucketclaim", "claim", "Ready=false", opts...)
+
+			failures := InterceptGomegaFailures(func() {
+				WaitForCondition(ctx, "ns", "bucketclaim", "claim", "Ready", opts...)
+			})
+			Expect(failures).To(ConsistOf(And(
+				ContainSubstring("to have condition Ready=True"),
+				ContainSubstring("status.conditions entry {type=Ready, status=True}"),
+			)))
+		})
+	})
+
+	Describe("WaitForJSONPath", func() {
+		It("polls until the node matches", func(ctx SpecContext) {
+			fake.On("kubectl", `^get bucketclaim claim -n ns -ojson$`, fakebin.Response{Stdout: `{"status": {"bucketReady": false}}`})
+			go func() {
+				defer GinkgoRecover()
+				time.Sleep(100 * time.Millisecond)
+				fake.On("kubectl", `^get bucketclaim claim -n ns -ojson$`, fakebin.Response{Stdout: `{"status": {"bucketReady": true}}`})
+			}()
+
+			WaitForJSONPath(ctx, "ns", "bucketclaim", "claim", "status.bucketReady", BeTrue(), opts...)
+			Expect(len(fake.Invocations("kubectl"))).To(BeNumerically(">", 1))
+		})
+	})
+
+	Describe("WaitForDeleted", func() {
+		It("succeeds once the object is not found", func(ctx SpecContext) {
+			fake.On("kubectl", `^get bucketclass class --ignore-not-found -ojson$`, fakebin.Response{})
+
+			WaitForDeleted(ctx, "", "bucketclass", "class", opts...)
+		})
+
+		It("fails while the object exists", func(ctx SpecContext) {
+			fake.On("kubectl", `^get bucketclass class --ignore-not-found -ojson$`, fakebin.Response{
+				Stdout: `{"metadata": {"name": "class", "deletionTimestamp": "2023-06-01T10:00:00Z"}}`,
+			})
+
+			failures := InterceptGomegaFailures(func() {
+				WaitForDeleted(ctx, "", "bucketclass", "class", opts...)
+			})
+			Expect(failures).To(ConsistOf(And(
+				ContainSubstring("waiting for bucketclass/class to be deleted"),
+				ContainSubstring("object still exists"),
+				ContainSubstring("deletionTimestamp"),
+			)))
+			Expect(fake.Invocations("kubectl")).To(ContainElement(
+				HaveField("Args", ContainElement("-A")),
+			))
+		})
+	})
+})
@@ -0,0 +1,312 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers
+
+import (
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/format"
+	"github.com/onsi/gomega/types"
+	"github.com/pkg/errors"
+)
+
+// The matchers below check the Kubernetes workloads fetched with
+// `kubectl get ... -ojson`. They accept the same documents as HaveJSONPath and
+// compose with it, e.g. the pod template labels of a deployment are checked
+// with HaveJSONPath("spec.template", HaveLabel(key, value)).
+// Expected values are either plain values or matchers.
+
+// HaveLabel succeeds if the object has the label key with, when given, the
+// expected value.
+func HaveLabel(key string, value ...interface{}) types.GomegaMatcher {
+	return HaveJSONPath(quotedKeyPath("metadata.labels", key), valueMatchers(value)...)
+}
+
+// HaveAnnotation succeeds if the object has the annotation key with, when
+// given, the expected value.
+func HaveAnnotation(key string, value ...interface{}) types.GomegaMatcher {
+	return HaveJSONPath(quotedKeyPath("metadata.annotations", key), valueMatchers(value)...)
+}
+
+// HaveStrategy succeeds if the deployment strategy type is strategy.
+func HaveStrategy(strategy interface{}) types.GomegaMatcher {
+	return HaveJSONPath("spec.strategy.type", matcherOrEqual(strategy))
+}
+
+// HaveContainer succeeds if the deployment, pod or pod spec has a container
+// named name satisfying every matcher. The matchers are applied to the
+// container, e.g. HaveImage, HavePort or HaveVolumeMount.
+func HaveContainer(name string, matcher ...types.GomegaMatcher) types.GomegaMatcher {
+	return &haveNamedMatcher{kind: "container", list: "containers", name: name, matchers: matcher}
+}
+
+// HaveVolume succeeds if the deployment, pod or pod spec has a volume named
+// name satisfying every matcher.
+func HaveVolume(name string, matcher ...types.GomegaMatcher) types.GomegaMatcher {
+	return &haveNamedMatcher{kind: "volume", list: "volumes", name: name, matchers: matcher}
+}
+
+// HaveImage succeeds if the container image is image.
+func HaveImage(image interface{}) types.GomegaMatcher {
+	return HaveJSONPath("image", matcherOrEqual(image))
+}
+
+// HaveArgs succeeds if the container args contain args in the given order,
+// one right after the other, e.g. HaveArgs("--rgw-backend-store", "sfs").
+func HaveArgs(args ...interface{}) types.GomegaMatcher {
+	return &haveArgsMatcher{args: args}
+}
+
+// HaveVolumeMount succeeds if the container mounts the volume name at path.
+func HaveVolumeMount(path, name string) types.GomegaMatcher {
+	return &haveEntryMatcher{list: "volumeMounts", fields: []entryField{
+		{"mountPath", path},
+		{"name", name},
+	}}
+}
+
+// HaveEnvFromSecret succeeds if the container environment is populated from
+// the secret name.
+func HaveEnvFromSecret(name string) types.GomegaMatcher {
+	return &haveEntryMatcher{list: "envFrom", fields: []entryField{{"secretRef.name", name}}}
+}
+
+// HaveEnvFromConfigMap succeeds if the container environment is populated
+// from the config map name.
+func HaveEnvFromConfigMap(name string) types.GomegaMatcher {
+	return &haveEntryMatcher{list: "envFrom", fields: []entryField{{"configMapRef.name", name}}}
+}
+
+// HavePort succeeds if the container exposes number with protocol.
+// An empty name or protocol matches any value, for unnamed ports.
+func HavePort(name string, number int, protocol string) types.GomegaMatcher {
+	fields := []entryField{{"containerPort", number}}
+	if name != "" {
+		fields = append(fields, entryField{"name", name})
+	}
+	if protocol != "" {
+		fields = append(fields, entryField{"protocol", protocol})
+	}
+	return &haveEntryMatcher{list: "ports", fields: fields}
+}
+
+func quotedKeyPath(prefix, key string) string {
+	return fmt.Sprintf(`%s["%s"]`, prefix, key)
+}
+
+func matcherOrEqual(v interface{}) types.GomegaMatcher {
+	if m, ok := v.(types.GomegaMatcher); ok {
+		return m
+	}
+	return BeEquivalentTo(v)
+}
+
+func valueMatchers(values []interface{}) []types.GomegaMatcher {
+	matchers := make([]types.GomegaMatcher, 0, len(values))
+	for _, v := range values {
+		matchers = append(matchers, matcherOrEqual(v))
+	}
+	return matchers
+}
+
+// podSpecList returns the list named list of the pod spec of a deployment,
+// a pod or a pod spec, or nil if there's none.
+func podSpecList(obj interface{}, list string) []interface{} {
+	for _, path := range []string{"spec.template.spec." + list, "spec." + list, list} {
+		if node, err := JSONPath(obj, path); err == nil {
+			entries, _ := node.([]interface{})
+			return entries
+		}
+	}
+	return nil
+}
+
+// lookupJSONPath is like JSONPath, but a missing node is not an error.
+func lookupJSONPath(obj interface{}, path string) (interface{}, bool, error) {
+	node, err := JSONPath(obj, path)
+	if err != nil {
+		var pathErr *JSONPathError
+		if errors.As(err, &pathErr) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return node, true, nil
+}
+
+type haveNamedMatcher struct {
+	kind     string
+	list     string
+	name     string
+	matchers []types.GomegaMatcher
+
+	// set by Match, for the failure messages
+	names []string
+	entry interface{}
+	inner types.GomegaMatcher
+}
+
+func (m *haveNamedMatcher) Match(actual interface{}) (bool, error) {
+	m.names, m.entry, m.inner = nil, nil, nil
+
+	obj, err := ToJSONObject(actual)
+	if err != nil {
+		return false, err
+	}
+	for _, e := range podSpecList(obj, m.list) {
+		name, _ := JSONPath(e, "name")
+		if name != m.name {
+			m.names = append(m.names, fmt.Sprint(name))
+			continue
+		}
+		m.entry = e
+		for _, matcher := range m.matchers {
+			ok, err := matcher.Match(e)
+			if err != nil || !ok {
+				m.inner = matcher
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+func (m *haveNamedMatcher) FailureMessage(actual interface{}) string {
+	if m.entry == nil {
+		return fmt.Sprintf("Expected a %s named %q, found [%s]", m.kind, m.name, strings.Join(m.names, ", "))
+	}
+	return fmt.Sprintf("In %s %q:\n%s", m.kind, m.name, m.inner.FailureMessage(m.entry))
+}
+
+func (m *haveNamedMatcher) NegatedFailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected no %s named %q satisfying the matchers, found\n%s",
+		m.kind, m.name, format.Object(m.entry, 1))
+}
+
+// entryField is a field of a list entry, addressed by a JSON path relative to
+// the entry.
+type entryField struct {
+	path  string
+	value interface{}
+}
+
+func (f entryField) String() string {
+	return fmt.Sprintf("%s=%v", f.path, f.value)
+}
+
+// haveEntryMatcher succeeds if the list of a container has an entry with all
+// the fields.
+type haveEntryMatcher struct {
+	list   string
+	fields []entryField
+
+	entries interface{}
+}
+
+func (m *haveEntryMatcher) Match(actual interface{}) (bool, error) {
+	m.entries = nil
+
+	node, found, err := lookupJSONPath(actual, m.list)
+	if err != nil || !found {
+		return false, err
+	}
+	m.entries = node
+	entries, ok := node.([]interface{})
+	if !ok {
+		return false, nil
+	}
+
+	for _, e := range entries {
+		if m.matchEntry(e) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *haveEntryMatcher) matchEntry(entry interface{}) bool {
+	for _, f := range m.fields {
+		v, err := JSONPath(entry, f.path)
+		if err != nil {
+			return false
+		}
+		if ok, err := BeEquivalentTo(f.value).Match(v); err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *haveEntryMatcher) describe() string {
+	fields := make([]string, 0, len(m.fields))
+	for _, f := range m.fields {
+		fields = append(fields, f.String())
+	}
+	return fmt.Sprintf("%s entry {%s}", m.list, strings.Join(fields, ", "))
+}
+
+func (m *haveEntryMatcher) FailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected %s, found\n%s", m.describe(), format.Object(m.entries, 1))
+}
+
+func (m *haveEntryMatcher) NegatedFailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected no %s, found\n%s", m.describe(), format.Object(m.entries, 1))
+}
+
+type haveArgsMatcher struct {
+	args []interface{}
+
+	actualArgs interface{}
+}
+
+func (m *haveArgsMatcher) Match(actual interface{}) (bool, error) {
+	m.actualArgs = nil
+
+	node, found, err := lookupJSONPath(actual, "args")
+	if err != nil || !found {
+		return false, err
+	}
+	m.actualArgs = node
+	args, ok := node.([]interface{})
+	if !ok {
+		return false, nil
+	}
+
+	for start := 0; start+len(m.args) <= len(args); start++ {
+		if m.matchAt(args, start) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *haveArgsMatcher) matchAt(args []interface{}, start int) bool {
+	for i, want := range m.args {
+		if ok, err := matcherOrEqual(want).Match(args[start+i]); err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *haveArgsMatcher) FailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected args to contain the sequence\n%s\nfound\n%s",
+		format.Object(m.args, 1), format.Object(m.actualArgs, 1))
+}
+
+func (m *haveArgsMatcher) NegatedFailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected args not to contain the sequence\n%s\nfound\n%s",
+		format.Object(m.args, 1), format.Object(m.actualArgs, 1))
+}
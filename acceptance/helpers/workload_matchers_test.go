@@ -0,0 +1,106 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers_test
+
+import (
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const workloadJSON = `{
+  "metadata": {
+    "name": "s3gw",
+    "labels": {"app.kubernetes.io/name": "s3gw", "helm.sh/chart": "s3gw-0.17.0"},
+    "annotations": {"deployment.kubernetes.io/revision": "2"}
+  },
+  "spec": {
+    "strategy": {"type": "Recreate"},
+    "template": {
+      "metadata": {"labels": {"app.kubernetes.io/component": "gateway"}},
+      "spec": {
+        "containers": [
+          {
+            "name": "s3gw",
+            "image": "quay.io/s3gw/s3gw:v0.17.0",
+            "args": ["--rgw-dns-name", "s3gw.local, s3gw.svc", "--rgw-backend-store", "sfs"],
+            "envFrom": [{"configMapRef": {"name": "s3gw-config"}}, {"secretRef": {"name": "s3gw-creds"}}],
+            "ports": [{"containerPort": 7481, "name": "s3-tls", "protocol": "TCP"}, {"containerPort": 7480, "name": "s3", "protocol": "TCP"}],
+            "volumeMounts": [{"mountPath": "/data", "name": "s3gw-lh-store"}]
+          },
+          {"name": "sidecar", "image": "quay.io/s3gw/sidecar:v0.17.0"}
+        ],
+        "volumes": [{"name": "s3gw-lh-store", "persistentVolumeClaim": {"claimName": "s3gw-pvc"}}]
+      }
+    }
+  }
+}`
+
+var _ = Describe("workload matchers", func() {
+	It("matches metadata", func() {
+		Expect(workloadJSON).To(HaveLabel("app.kubernetes.io/name", "s3gw"))
+		Expect(workloadJSON).To(HaveLabel("helm.sh/chart", HavePrefix("s3gw-")))
+		Expect(workloadJSON).To(HaveLabel("helm.sh/chart"))
+		Expect(workloadJSON).ToNot(HaveLabel("app.kubernetes.io/version"))
+		Expect(workloadJSON).To(HaveAnnotation("deployment.kubernetes.io/revision", "2"))
+		Expect(workloadJSON).To(HaveJSONPath("spec.template", HaveLabel("app.kubernetes.io/component", "gateway")))
+		Expect(workloadJSON).To(HaveStrategy("Recreate"))
+	})
+
+	It("matches containers regardless of the order of their entries", func() {
+		Expect(workloadJSON).To(HaveContainer("s3gw",
+			HaveImage("quay.io/s3gw/s3gw:v0.17.0"),
+			HaveArgs("--rgw-backend-store", "sfs"),
+			HaveArgs("--rgw-dns-name", HavePrefix("s3gw.local, ")),
+			HaveEnvFromSecret("s3gw-creds"),
+			HaveEnvFromConfigMap("s3gw-config"),
+			HavePort("s3", 7480, "TCP"),
+			HavePort("s3-tls", 7481, "TCP"),
+			HavePort("", 7480, ""),
+			HaveVolumeMount("/data", "s3gw-lh-store"),
+		))
+		Expect(workloadJSON).To(HaveContainer("sidecar", HaveImage(HaveSuffix(":v0.17.0"))))
+		Expect(workloadJSON).To(HaveVolume("s3gw-lh-store",
+			HaveJSONPath("persistentVolumeClaim.claimName", Equal("s3gw-pvc"))))
+	})
+
+	It("does not match partial entries", func() {
+		Expect(workloadJSON).ToNot(HaveContainer("s3gw", HavePort("s3", 7481, "TCP")))
+		Expect(workloadJSON).ToNot(HaveContainer("s3gw", HaveVolumeMount("/data", "other")))
+		Expect(workloadJSON).ToNot(HaveContainer("s3gw", HaveEnvFromSecret("s3gw-config")))
+		Expect(workloadJSON).ToNot(HaveContainer("s3gw", HaveArgs("sfs", "--rgw-backend-store")))
+		Expect(workloadJSON).ToNot(HaveContainer("sidecar", HavePort("", 7480, "")))
+	})
+
+	It("reports the missing container and the present ones", func() {
+		matcher := HaveContainer("s3gw-ui")
+		success, err := matcher.Match(workloadJSON)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(success).To(BeFalse())
+		Expect(matcher.FailureMessage(workloadJSON)).To(ContainSubstring(`container named "s3gw-ui", found [s3gw, sidecar]`))
+	})
+
+	It("reports the failing container matcher", func() {
+		matcher := HaveContainer("s3gw", HaveImage("quay.io/s3gw/s3gw:v0.16.0"))
+		success, err := matcher.Match(workloadJSON)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(success).To(BeFalse())
+		Expect(matcher.FailureMessage(workloadJSON)).To(And(
+			ContainSubstring(`In container "s3gw"`),
+			ContainSubstring(`At JSON path "image"`),
+		))
+
+		matcher = HaveContainer("s3gw", HaveVolumeMount("/tls", "tls"))
+		_, _ = matcher.Match(workloadJSON)
+		Expect(matcher.FailureMessage(workloadJSON)).To(ContainSubstring("volumeMounts entry {mountPath=/tls, name=tls}"))
+	})
+})
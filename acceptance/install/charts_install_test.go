@@ -12,18 +12,15 @@
 package install_test
 
 import (
-	"encoding/json"
-	"io"
-	"os"
-	"strings"
-
 	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	"github.com/aquarist-labs/s3gw/acceptance/helpers/helm"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("charts installations", Label("Charts"), func() {
-	var suiteProperties map[string]interface{}
+	var suiteProperties *SuiteProperties
+	expectations := CurrentChartExpectations
 	chartsRoot := "charts/charts/s3gw"
 	chartName := "s3gw"
 	s3gwImageName := "quay.io/s3gw/s3gw"
@@ -32,376 +29,337 @@ var _ = Describe("charts installations", Label("Charts"), func() {
 	s3gwCOSISidecarImageName := "quay.io/s3gw/s3gw-cosi-sidecar"
 
 	BeforeEach(func() {
-		if suitePropertiesF, err := os.Open("../suiteProperties.json"); err == nil {
-			defer suitePropertiesF.Close()
-			byteValue, _ := io.ReadAll(suitePropertiesF)
-			err = json.Unmarshal([]byte(byteValue), &suiteProperties)
-			Expect(err).ToNot(HaveOccurred())
-		} else {
-			//make this fail
-			Expect(err).ToNot(HaveOccurred())
-			Expect(suiteProperties).ToNot(BeNil())
-		}
+		UseSpecCassette()
+		AuditSpecCommands()
+
+		var err error
+		suiteProperties, err = LoadSuiteProperties(SuitePropertiesFile)
+		Expect(err).ToNot(HaveOccurred())
 	})
 
 	AfterEach(func() {
 	})
 
-	When("deploying s3gw-def/s3gw-def", Label("Default"), func() {
-		namespace := NanoSecName("s3gw-def")
-		releaseName := NanoSecName("s3gw-def")
-
-		BeforeEach(func() {
-			args := []string{"install", "--create-namespace", "-n", namespace,
-				"--set", "publicDomain=" + suiteProperties["S3GW_SYSTEM_DOMAIN"].(string),
-				"--set", "ui.publicDomain=" + suiteProperties["S3GW_SYSTEM_DOMAIN"].(string),
-				"--set", "imageTag=v" + suiteProperties["IMAGE_TAG"].(string),
-				"--set", "ui.imageTag=v" + suiteProperties["IMAGE_TAG"].(string),
-				releaseName, chartsRoot, "--wait"}
-
-			if extraArgs := suiteProperties["CHARTS_EXTRA_ARGS"].(string); len(extraArgs) > 0 {
-				out, err := Run("../..", true, "helm", append(args, strings.Split(extraArgs, " ")...)...)
-				Expect(err).ToNot(HaveOccurred(), out)
-			} else {
-				out, err := Run("../..", true, "helm", args...)
-				Expect(err).ToNot(HaveOccurred(), out)
-			}
-		})
-
-		AfterEach(func() {
-			out, err := Run("../..", true, "helm", "uninstall", "-n", namespace, releaseName, "--wait")
-			Expect(err).ToNot(HaveOccurred(), out)
-		})
-
-		It("deploys expected resources", func() {
-			By("getting the s3gw deployment", func() {
-				out, err := Kubectl("get", "deployments",
-					"-n", namespace,
-					releaseName,
-					"-ojson")
-				Expect(err).ToNot(HaveOccurred())
-
-				var dJson map[string]interface{}
-				err = json.Unmarshal([]byte(out), &dJson)
-				Expect(err).ToNot(HaveOccurred())
-				Expect(dJson).ToNot(BeNil())
-
-				//deployment metadata
-				Expect(dJson["metadata"].(map[string]interface{})["name"].(string)).To(Equal(releaseName))
-				Expect(dJson["metadata"].(map[string]interface{})["namespace"].(string)).To(Equal(namespace))
-
-				//annotations
-				annotationsNode := dJson["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
-				Expect(annotationsNode["deployment.kubernetes.io/revision"].(string)).To(Equal("1"))
-				Expect(annotationsNode["meta.helm.sh/release-name"].(string)).To(Equal(releaseName))
-				Expect(annotationsNode["meta.helm.sh/release-namespace"].(string)).To(Equal(namespace))
-
-				//labels
-				labelNode := dJson["metadata"].(map[string]interface{})["labels"].(map[string]interface{})
-				Expect(labelNode["app.kubernetes.io/instance"].(string)).To(Equal(releaseName))
-				Expect(labelNode["app.kubernetes.io/managed-by"].(string)).To(Equal("Helm"))
-				Expect(labelNode["app.kubernetes.io/name"].(string)).To(Equal(chartName))
-				Expect(labelNode["app.kubernetes.io/version"].(string)).To(Equal("latest"))
-				Expect(labelNode["helm.sh/chart"].(string)).To(Equal(chartName + "-" + suiteProperties["CHARTS_VER"].(string)))
-
-				//replicas
-				Expect(dJson["spec"].(map[string]interface{})["replicas"].(float64)).To(BeEquivalentTo(1))
-
-				//matching labels
-				matchingLabelsNode := dJson["spec"].(map[string]interface{})["selector"].(map[string]interface{})["matchLabels"].(map[string]interface{})
-				Expect(matchingLabelsNode["app.kubernetes.io/component"]).To(Equal("gateway"))
-				Expect(matchingLabelsNode["app.kubernetes.io/instance"]).To(Equal(releaseName))
-				Expect(matchingLabelsNode["app.kubernetes.io/name"]).To(Equal(chartName))
-
-				//strategy
-				Expect(dJson["spec"].(map[string]interface{})["strategy"].(map[string]interface{})["type"].(string)).To(Equal("Recreate"))
-
-				//spec template metadata labels
-				specTemplateMetadataLables := dJson["spec"].(map[string]interface{})["template"].(map[string]interface{})["metadata"].(map[string]interface{})["labels"].(map[string]interface{})
-				Expect(specTemplateMetadataLables["app.kubernetes.io/component"]).To(Equal("gateway"))
-				Expect(specTemplateMetadataLables["app.kubernetes.io/instance"]).To(Equal(releaseName))
-				Expect(specTemplateMetadataLables["app.kubernetes.io/name"]).To(Equal(chartName))
-
-				//containers
-				containersNode := dJson["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})
-
-				cnt0Node := containersNode[0].(map[string]interface{})
-				cnt0ArgsNode := cnt0Node["args"].([]interface{})
-
-				//radosgw args
-				Expect(cnt0ArgsNode[0].(string)).To(Equal("--rgw-dns-name"))
-
-				pubDNSName := releaseName + "-" + namespace + "." + suiteProperties["S3GW_SYSTEM_DOMAIN"].(string)
-				Expect(strings.Split(cnt0ArgsNode[1].(string), ", ")[0]).To(BeEquivalentTo(pubDNSName))
-
-				privDNSName := releaseName + "-" + namespace + "." + namespace + ".svc.cluster.local"
-				Expect(strings.Split(cnt0ArgsNode[1].(string), ", ")[1]).To(BeEquivalentTo(privDNSName))
-
-				Expect(cnt0ArgsNode[2].(string)).To(Equal("--rgw-backend-store"))
-				Expect(cnt0ArgsNode[3].(string)).To(Equal("sfs"))
-				Expect(cnt0ArgsNode[4].(string)).To(Equal("--debug-rgw"))
-				Expect(cnt0ArgsNode[5].(string)).To(Equal("1"))
-				Expect(cnt0ArgsNode[6].(string)).To(Equal("--rgw_frontends"))
-				Expect(cnt0ArgsNode[7].(string)).To(Equal("beast port=7480 ssl_port=7481 ssl_certificate=/s3gw-cluster-ip-tls/tls.crt ssl_private_key=/s3gw-cluster-ip-tls/tls.key"))
-
-				//envFrom
-				cnt0EnvFromNode := cnt0Node["envFrom"].([]interface{})
-				Expect(cnt0EnvFromNode[0].(map[string]interface{})["secretRef"].(map[string]interface{})["name"].(string)).To(Equal(releaseName + "-" + namespace + "-creds"))
-
-				//image
-				Expect(cnt0Node["image"].(string)).To(Equal(s3gwImageName + ":v" + suiteProperties["IMAGE_TAG"].(string)))
-
-				//imagePullPolicy
-				Expect(cnt0Node["imagePullPolicy"].(string)).To(Equal("IfNotPresent"))
-
-				//name
-				Expect(cnt0Node["name"].(string)).To(Equal(releaseName))
-
-				cnt0PortsNode := cnt0Node["ports"].([]interface{})
-
-				//ports
-				Expect(cnt0PortsNode[0].(map[string]interface{})["containerPort"].(float64)).To(BeEquivalentTo(7480))
-				Expect(cnt0PortsNode[0].(map[string]interface{})["name"].(string)).To(Equal("s3"))
-				Expect(cnt0PortsNode[0].(map[string]interface{})["protocol"].(string)).To(Equal("TCP"))
-
-				Expect(cnt0PortsNode[1].(map[string]interface{})["containerPort"].(float64)).To(BeEquivalentTo(7481))
-				Expect(cnt0PortsNode[1].(map[string]interface{})["name"].(string)).To(Equal("s3-tls"))
-				Expect(cnt0PortsNode[1].(map[string]interface{})["protocol"].(string)).To(Equal("TCP"))
-
-				volumeMountsNode := cnt0Node["volumeMounts"].([]interface{})
-
-				//volume mounts
-				Expect(volumeMountsNode[0].(map[string]interface{})["mountPath"].(string)).To(Equal("/data"))
-				Expect(volumeMountsNode[0].(map[string]interface{})["name"].(string)).To(Equal("s3gw-lh-store"))
-
-				Expect(volumeMountsNode[1].(map[string]interface{})["mountPath"].(string)).To(Equal("/s3gw-cluster-ip-tls"))
-				Expect(volumeMountsNode[1].(map[string]interface{})["name"].(string)).To(Equal("s3gw-cluster-ip-tls"))
-
-				//volumes
-				volumesNode := dJson["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["volumes"].([]interface{})
-
-				Expect(volumesNode[0].(map[string]interface{})["name"].(string)).To(Equal("s3gw-lh-store"))
-				Expect(volumesNode[0].(map[string]interface{})["persistentVolumeClaim"].(map[string]interface{})["claimName"]).To(Equal(releaseName + "-pvc"))
-
-				Expect(volumesNode[1].(map[string]interface{})["name"].(string)).To(Equal("s3gw-cluster-ip-tls"))
-				Expect(volumesNode[1].(map[string]interface{})["secret"].(map[string]interface{})["secretName"]).To(Equal(releaseName + "-" + namespace + "-cluster-ip-tls"))
+	// newGolden returns the snapshots of the chart version under test, with
+	// the values depending on the environment replaced by placeholders.
+	// The snapshots hold the deployments of a cluster, defaulted by the API
+	// server, the specs are skipped in render-only mode.
+	newGolden := func(nameBases ...string) *Golden {
+		if RenderOnly() {
+			Skip("golden snapshots are not compared with rendered charts")
+		}
+		golden := NewGolden(suiteProperties.ChartsVer).
+			Replace(suiteProperties.S3GWSystemDomain, "S3GW_SYSTEM_DOMAIN").
+			Replace(":v"+suiteProperties.ImageTag, ":vIMAGE_TAG")
+		for _, base := range nameBases {
+			golden.StripNameSuffix(base)
+		}
+		return golden
+	}
+
+	// renderChart renders the chart under test as installed by the specs,
+	// for the render-only mode.
+	renderChart := func(ctx SpecContext, namespace, releaseName string, values helm.Values) ([]interface{}, error) {
+		client := helm.NewMemory(namespace, nil)
+		client.Dir = "../.."
+		return client.Render(ctx, releaseName, chartsRoot, values)
+	}
+
+	for _, target := range SuiteClusterTargets() {
+		target := target
+
+		Context("on cluster "+target.Name, func() {
+			BeforeEach(func() {
+				UseClusterTarget(target)
 			})
 
-			By("getting the s3gw-ui deployment", func() {
-				out, err := Kubectl("get", "deployments",
-					"-n", namespace,
-					releaseName+"-ui",
-					"-ojson")
-				Expect(err).ToNot(HaveOccurred())
-
-				var dJson map[string]interface{}
-				err = json.Unmarshal([]byte(out), &dJson)
-				Expect(err).ToNot(HaveOccurred())
-				Expect(dJson).ToNot(BeNil())
-
-				//deployment metadata
-				Expect(dJson["metadata"].(map[string]interface{})["name"].(string)).To(Equal(releaseName + "-ui"))
-				Expect(dJson["metadata"].(map[string]interface{})["namespace"].(string)).To(Equal(namespace))
-
-				//annotations
-				annotationsNode := dJson["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
-				Expect(annotationsNode["deployment.kubernetes.io/revision"].(string)).To(Equal("1"))
-				Expect(annotationsNode["meta.helm.sh/release-name"].(string)).To(Equal(releaseName))
-				Expect(annotationsNode["meta.helm.sh/release-namespace"].(string)).To(Equal(namespace))
-
-				//labels
-				labelNode := dJson["metadata"].(map[string]interface{})["labels"].(map[string]interface{})
-				Expect(labelNode["app.kubernetes.io/instance"].(string)).To(Equal(releaseName))
-				Expect(labelNode["app.kubernetes.io/managed-by"].(string)).To(Equal("Helm"))
-				Expect(labelNode["app.kubernetes.io/name"].(string)).To(Equal(chartName))
-				Expect(labelNode["app.kubernetes.io/version"].(string)).To(Equal("latest"))
-				Expect(labelNode["helm.sh/chart"].(string)).To(Equal(chartName + "-" + suiteProperties["CHARTS_VER"].(string)))
-
-				//replicas
-				Expect(dJson["spec"].(map[string]interface{})["replicas"].(float64)).To(BeEquivalentTo(1))
-
-				//matching labels
-				matchingLabelsNode := dJson["spec"].(map[string]interface{})["selector"].(map[string]interface{})["matchLabels"].(map[string]interface{})
-				Expect(matchingLabelsNode["app.kubernetes.io/component"]).To(Equal("ui"))
-				Expect(matchingLabelsNode["app.kubernetes.io/instance"]).To(Equal(releaseName))
-				Expect(matchingLabelsNode["app.kubernetes.io/name"]).To(Equal(chartName))
-
-				//strategy
-				Expect(dJson["spec"].(map[string]interface{})["strategy"].(map[string]interface{})["type"].(string)).To(Equal("RollingUpdate"))
-
-				//spec template metadata labels
-				specTemplateMetadataLables := dJson["spec"].(map[string]interface{})["template"].(map[string]interface{})["metadata"].(map[string]interface{})["labels"].(map[string]interface{})
-				Expect(specTemplateMetadataLables["app.kubernetes.io/component"]).To(Equal("ui"))
-				Expect(specTemplateMetadataLables["app.kubernetes.io/instance"]).To(Equal(releaseName))
-				Expect(specTemplateMetadataLables["app.kubernetes.io/name"]).To(Equal(chartName))
-
-				//containers
-				containersNode := dJson["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})
-				cnt0Node := containersNode[0].(map[string]interface{})
-
-				//envFrom
-				cnt0EnvFromNode := cnt0Node["envFrom"].([]interface{})
-				Expect(cnt0EnvFromNode[0].(map[string]interface{})["configMapRef"].(map[string]interface{})["name"].(string)).To(Equal(releaseName + "-" + namespace + "-config"))
-				Expect(cnt0EnvFromNode[1].(map[string]interface{})["secretRef"].(map[string]interface{})["name"].(string)).To(Equal(releaseName + "-" + namespace + "-creds"))
-
-				//image
-				Expect(cnt0Node["image"].(string)).To(Equal(s3gwUiImageName + ":v" + suiteProperties["IMAGE_TAG"].(string)))
-
-				//imagePullPolicy
-				Expect(cnt0Node["imagePullPolicy"].(string)).To(Equal("IfNotPresent"))
-
-				//name
-				Expect(cnt0Node["name"].(string)).To(Equal("s3gw-ui"))
-
-				cnt0PortsNode := cnt0Node["ports"].([]interface{})
-
-				//ports
-				Expect(cnt0PortsNode[0].(map[string]interface{})["containerPort"].(float64)).To(BeEquivalentTo(8080))
-				Expect(cnt0PortsNode[0].(map[string]interface{})["protocol"].(string)).To(Equal("TCP"))
+			When("deploying s3gw-def/s3gw-def", Label("Default"), func() {
+				namespace := UniqueName("s3gw-def")
+				releaseName := UniqueName("s3gw-def")
+
+				BeforeEach(func(ctx SpecContext) {
+					Expect(CheckChartNames(releaseName, namespace)).To(Succeed())
+
+					values := helm.Values{
+						PublicDomain: suiteProperties.S3GWSystemDomain,
+						ImageTag:     "v" + suiteProperties.ImageTag,
+						UI: helm.UIValues{
+							PublicDomain: suiteProperties.S3GWSystemDomain,
+							ImageTag:     "v" + suiteProperties.ImageTag,
+						},
+						Cosi: helm.CosiValues{Enabled: helm.Bool(false)},
+					}
+					Expect(values.ParseExtraArgs(suiteProperties.ChartsExtraArgs)).To(Succeed())
+
+					if RenderOnly() {
+						objs, err := renderChart(ctx, namespace, releaseName, values)
+						Expect(err).ToNot(HaveOccurred())
+						UseRenderedObjects(objs)
+						return
+					}
+
+					TestNamespace(ctx, namespace)
+					client, err := helm.New(ctx, namespace)
+					Expect(err).ToNot(HaveOccurred())
+					client.Dir = "../.."
+
+					_, err = client.Install(ctx, releaseName, chartsRoot, values, helm.WithWait())
+					Expect(err).ToNot(HaveOccurred())
+					DeferCleanup(func(ctx SpecContext) {
+						Expect(client.Uninstall(ctx, releaseName, helm.WithWait())).To(Succeed())
+					})
+				})
+
+				JustAfterEach(func(ctx SpecContext) {
+					CollectDiagnosticsOnFailure(ctx, namespace)
+				})
+
+				It("deploys expected resources", func(ctx SpecContext) {
+					By("getting the s3gw deployment", func() {
+						dJson, err := GetObject(ctx, "Deployment", namespace, releaseName)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(dJson).ToNot(BeNil())
+
+						//deployment metadata
+						Expect(dJson).To(HaveJSONPath("metadata.name", Equal(releaseName)))
+						Expect(dJson).To(HaveJSONPath("metadata.namespace", Equal(namespace)))
+
+						//annotations
+						if !RenderOnly() {
+							// set by the deployment controller
+							Expect(dJson).To(HaveAnnotation("deployment.kubernetes.io/revision", "1"))
+						}
+						Expect(dJson).To(HaveAnnotation("meta.helm.sh/release-name", releaseName))
+						Expect(dJson).To(HaveAnnotation("meta.helm.sh/release-namespace", namespace))
+
+						//labels
+						Expect(dJson).To(HaveLabel("app.kubernetes.io/instance", releaseName))
+						Expect(dJson).To(HaveLabel("app.kubernetes.io/managed-by", "Helm"))
+						Expect(dJson).To(HaveLabel("app.kubernetes.io/name", chartName))
+						Expect(dJson).To(HaveLabel("app.kubernetes.io/version", "latest"))
+						Expect(dJson).To(HaveLabel("helm.sh/chart", chartName+"-"+suiteProperties.ChartsVer))
+
+						//replicas
+						Expect(dJson).To(HaveJSONPath("spec.replicas", BeEquivalentTo(1)))
+
+						//matching labels
+						Expect(dJson).To(HaveJSONPath("spec.selector.matchLabels", HaveKeyWithValue("app.kubernetes.io/component", "gateway")))
+						Expect(dJson).To(HaveJSONPath("spec.selector.matchLabels", HaveKeyWithValue("app.kubernetes.io/instance", releaseName)))
+						Expect(dJson).To(HaveJSONPath("spec.selector.matchLabels", HaveKeyWithValue("app.kubernetes.io/name", chartName)))
+
+						//strategy and volumes
+						Expect(dJson).To(And(expectations.Gateway.Deployment(releaseName, namespace)...))
+
+						//spec template metadata labels
+						Expect(dJson).To(HaveJSONPath("spec.template", HaveLabel("app.kubernetes.io/component", "gateway")))
+						Expect(dJson).To(HaveJSONPath("spec.template", HaveLabel("app.kubernetes.io/instance", releaseName)))
+						Expect(dJson).To(HaveJSONPath("spec.template", HaveLabel("app.kubernetes.io/name", chartName)))
+
+						//radosgw
+						pubDNSName := releaseName + "-" + namespace + "." + suiteProperties.S3GWSystemDomain
+						privDNSName := releaseName + "-" + namespace + "." + namespace + ".svc.cluster.local"
+						Expect(dJson).To(HaveContainer(releaseName,
+							HaveArgs("--rgw-dns-name", HavePrefix(pubDNSName+", "+privDNSName)),
+							HaveEnvFromSecret(releaseName+"-"+namespace+"-creds"),
+							HaveImage(s3gwImageName+":v"+suiteProperties.ImageTag),
+							HaveJSONPath("imagePullPolicy", Equal("IfNotPresent")),
+						))
+						Expect(dJson).To(HaveContainer(releaseName,
+							expectations.Gateway.Container(releaseName, namespace)...))
+					})
+
+					By("getting the s3gw-ui deployment", func() {
+						dJson, err := GetObject(ctx, "Deployment", namespace, releaseName+"-ui")
+						Expect(err).ToNot(HaveOccurred())
+						Expect(dJson).ToNot(BeNil())
+
+						//deployment metadata
+						Expect(dJson).To(HaveJSONPath("metadata.name", Equal(releaseName+"-ui")))
+						Expect(dJson).To(HaveJSONPath("metadata.namespace", Equal(namespace)))
+
+						//annotations
+						if !RenderOnly() {
+							// set by the deployment controller
+							Expect(dJson).To(HaveAnnotation("deployment.kubernetes.io/revision", "1"))
+						}
+						Expect(dJson).To(HaveAnnotation("meta.helm.sh/release-name", releaseName))
+						Expect(dJson).To(HaveAnnotation("meta.helm.sh/release-namespace", namespace))
+
+						//labels
+						Expect(dJson).To(HaveLabel("app.kubernetes.io/instance", releaseName))
+						Expect(dJson).To(HaveLabel("app.kubernetes.io/managed-by", "Helm"))
+						Expect(dJson).To(HaveLabel("app.kubernetes.io/name", chartName))
+						Expect(dJson).To(HaveLabel("app.kubernetes.io/version", "latest"))
+						Expect(dJson).To(HaveLabel("helm.sh/chart", chartName+"-"+suiteProperties.ChartsVer))
+
+						//replicas
+						Expect(dJson).To(HaveJSONPath("spec.replicas", BeEquivalentTo(1)))
+
+						//matching labels
+						Expect(dJson).To(HaveJSONPath("spec.selector.matchLabels", HaveKeyWithValue("app.kubernetes.io/component", "ui")))
+						Expect(dJson).To(HaveJSONPath("spec.selector.matchLabels", HaveKeyWithValue("app.kubernetes.io/instance", releaseName)))
+						Expect(dJson).To(HaveJSONPath("spec.selector.matchLabels", HaveKeyWithValue("app.kubernetes.io/name", chartName)))
+
+						//strategy
+						Expect(dJson).To(And(expectations.UI.Deployment(releaseName, namespace)...))
+
+						//spec template metadata labels
+						Expect(dJson).To(HaveJSONPath("spec.template", HaveLabel("app.kubernetes.io/component", "ui")))
+						Expect(dJson).To(HaveJSONPath("spec.template", HaveLabel("app.kubernetes.io/instance", releaseName)))
+						Expect(dJson).To(HaveJSONPath("spec.template", HaveLabel("app.kubernetes.io/name", chartName)))
+
+						//ui
+						Expect(dJson).To(HaveContainer("s3gw-ui",
+							HaveEnvFromConfigMap(releaseName+"-"+namespace+"-config"),
+							HaveEnvFromSecret(releaseName+"-"+namespace+"-creds"),
+							HaveImage(s3gwUiImageName+":v"+suiteProperties.ImageTag),
+							HaveJSONPath("imagePullPolicy", Equal("IfNotPresent")),
+						))
+						Expect(dJson).To(HaveContainer("s3gw-ui",
+							expectations.UI.Container(releaseName, namespace)...))
+					})
+				})
+
+				It("matches the golden snapshots", Label("Golden"), func(ctx SpecContext) {
+					golden := newGolden("s3gw-def")
+					Expect(golden.Available()).To(Succeed())
+
+					for _, d := range []struct{ snapshot, deployment string }{
+						{"s3gw", releaseName},
+						{"s3gw-ui", releaseName + "-ui"},
+					} {
+						res, err := KubectlResult(ctx, "get", "deployments", "-n", namespace, d.deployment, "-ojson")
+						Expect(err).ToNot(HaveOccurred(), res.Stderr)
+						Expect(res.Stdout).To(MatchGolden(golden, d.snapshot))
+					}
+				})
 			})
-		})
-	})
-
-	When("deploying s3gw-acceptance-cosi/s3gw-cosi", Label("COSI"), func() {
-		namespace := NanoSecName("s3gw-acceptance-cosi")
-		releaseName := NanoSecName("s3gw-cosi")
-
-		BeforeEach(func() {
-			args := []string{"install", "--create-namespace", "-n", namespace,
-				"--set", "publicDomain=" + suiteProperties["S3GW_SYSTEM_DOMAIN"].(string),
-				"--set", "ui.publicDomain=" + suiteProperties["S3GW_SYSTEM_DOMAIN"].(string),
-				"--set", "imageTag=v" + suiteProperties["IMAGE_TAG"].(string),
-				"--set", "ui.imageTag=v" + suiteProperties["IMAGE_TAG"].(string),
-				"--set", "cosi.driver.imageTag=v" + suiteProperties["IMAGE_TAG"].(string),
-				"--set", "cosi.sidecar.imageTag=v" + suiteProperties["IMAGE_TAG"].(string),
-				"--set", "cosi.enabled=true",
-				releaseName, chartsRoot, "--wait"}
-
-			if extraArgs := suiteProperties["CHARTS_EXTRA_ARGS"].(string); len(extraArgs) > 0 {
-				out, err := Run("../..", true, "helm", append(args, strings.Split(extraArgs, " ")...)...)
-				Expect(err).ToNot(HaveOccurred(), out)
-			} else {
-				out, err := Run("../..", true, "helm", args...)
-				Expect(err).ToNot(HaveOccurred(), out)
-			}
-		})
-
-		AfterEach(func() {
-			out, err := Run("../..", true, "helm", "uninstall", "-n", namespace, releaseName, "--wait")
-			Expect(err).ToNot(HaveOccurred(), out)
-		})
-
-		It("has the expected s3gw-cosi deployment static values", func() {
-			By("getting the objectstorage-provisioner deployment", func() {
-				out, err := Kubectl("get", "deployments",
-					"-n", namespace,
-					releaseName+"-objectstorage-provisioner",
-					"-ojson")
-				Expect(err).ToNot(HaveOccurred())
-
-				var dJson map[string]interface{}
-				err = json.Unmarshal([]byte(out), &dJson)
-				Expect(err).ToNot(HaveOccurred())
-				Expect(dJson).ToNot(BeNil())
-
-				//deployment metadata
-				Expect(dJson["metadata"].(map[string]interface{})["name"].(string)).To(Equal(releaseName + "-objectstorage-provisioner"))
-				Expect(dJson["metadata"].(map[string]interface{})["namespace"].(string)).To(Equal(namespace))
-
-				//annotations
-				annotationsNode := dJson["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
-				Expect(annotationsNode["deployment.kubernetes.io/revision"].(string)).To(Equal("1"))
-				Expect(annotationsNode["meta.helm.sh/release-name"].(string)).To(Equal(releaseName))
-				Expect(annotationsNode["meta.helm.sh/release-namespace"].(string)).To(Equal(namespace))
-
-				//labels
-				labelNode := dJson["metadata"].(map[string]interface{})["labels"].(map[string]interface{})
-				Expect(labelNode["app.kubernetes.io/instance"].(string)).To(Equal(releaseName))
-				Expect(labelNode["app.kubernetes.io/managed-by"].(string)).To(Equal("Helm"))
-				Expect(labelNode["app.kubernetes.io/name"].(string)).To(Equal(chartName))
-				Expect(labelNode["app.kubernetes.io/version"].(string)).To(Equal("latest"))
-				Expect(labelNode["helm.sh/chart"].(string)).To(Equal(chartName + "-" + suiteProperties["CHARTS_VER"].(string)))
-
-				//replicas
-				Expect(dJson["spec"].(map[string]interface{})["replicas"].(float64)).To(BeEquivalentTo(1))
-
-				//matching labels
-				matchingLabelsNode := dJson["spec"].(map[string]interface{})["selector"].(map[string]interface{})["matchLabels"].(map[string]interface{})
-				Expect(matchingLabelsNode["app.kubernetes.io/component"]).To(Equal("cosi"))
-				Expect(matchingLabelsNode["app.kubernetes.io/instance"]).To(Equal(releaseName))
-				Expect(matchingLabelsNode["app.kubernetes.io/name"]).To(Equal(chartName))
-
-				//strategy
-				Expect(dJson["spec"].(map[string]interface{})["strategy"].(map[string]interface{})["type"].(string)).To(Equal("Recreate"))
-
-				//spec template metadata labels
-				specTemplateMetadataLables := dJson["spec"].(map[string]interface{})["template"].(map[string]interface{})["metadata"].(map[string]interface{})["labels"].(map[string]interface{})
-				Expect(specTemplateMetadataLables["app.kubernetes.io/component"]).To(Equal("cosi"))
-				Expect(specTemplateMetadataLables["app.kubernetes.io/instance"]).To(Equal(releaseName))
-				Expect(specTemplateMetadataLables["app.kubernetes.io/name"]).To(Equal(chartName))
-
-				//containers
-				containersNode := dJson["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})
-
-				cnt0Node := containersNode[0].(map[string]interface{})
-
-				//envFrom
-				cnt0EnvFromNode := cnt0Node["envFrom"].([]interface{})
-				Expect(cnt0EnvFromNode[0].(map[string]interface{})["secretRef"].(map[string]interface{})["name"].(string)).To(Equal(releaseName + "-" + namespace + "-objectstorage-provisioner"))
-
-				//image
-				Expect(cnt0Node["image"].(string)).To(Equal(s3gwCOSIDriverImageName + ":v" + suiteProperties["IMAGE_TAG"].(string)))
 
-				//imagePullPolicy
-				Expect(cnt0Node["imagePullPolicy"].(string)).To(Equal("IfNotPresent"))
-
-				//name
-				Expect(cnt0Node["name"].(string)).To(Equal(releaseName + "-cosi-driver"))
-
-				volumeMountsNode := cnt0Node["volumeMounts"].([]interface{})
-
-				//volume mounts
-				Expect(volumeMountsNode[0].(map[string]interface{})["mountPath"].(string)).To(Equal("/var/lib/cosi"))
-				Expect(volumeMountsNode[0].(map[string]interface{})["name"].(string)).To(Equal("socket"))
-
-				cnt1Node := containersNode[1].(map[string]interface{})
-
-				//envFrom
-				cnt1EnvFromNode := cnt1Node["envFrom"].([]interface{})
-				Expect(cnt1EnvFromNode[0].(map[string]interface{})["secretRef"].(map[string]interface{})["name"].(string)).To(Equal(releaseName + "-" + namespace + "-objectstorage-provisioner"))
-
-				//image
-				Expect(cnt1Node["image"].(string)).To(Equal(s3gwCOSISidecarImageName + ":v" + suiteProperties["IMAGE_TAG"].(string)))
-
-				cnt1ArgsNode := cnt1Node["args"].([]interface{})
-
-				//cnt1 args
-				Expect(cnt1ArgsNode[0].(string)).To(Equal("--v=5"))
-
-				cnt1EnvNode := cnt1Node["env"].([]interface{})
-
-				//name
-				Expect(cnt1EnvNode[0].(map[string]interface{})["name"].(string)).To(Equal("POD_NAMESPACE"))
-
-				volumeMountsNode = cnt1Node["volumeMounts"].([]interface{})
-
-				//volume mounts
-				Expect(volumeMountsNode[0].(map[string]interface{})["mountPath"].(string)).To(Equal("/var/lib/cosi"))
-				Expect(volumeMountsNode[0].(map[string]interface{})["name"].(string)).To(Equal("socket"))
-
-				//serviceAccount
-				serviceAccount := dJson["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["serviceAccount"].(string)
-				Expect(serviceAccount).To(Equal(releaseName + "-" + namespace + "-objectstorage-provisioner-sa"))
-
-				//serviceAccountName
-				serviceAccountName := dJson["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["serviceAccountName"].(string)
-				Expect(serviceAccountName).To(Equal(releaseName + "-" + namespace + "-objectstorage-provisioner-sa"))
-
-				//volumes
-				volumesNode := dJson["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["volumes"].([]interface{})
-
-				Expect(volumesNode[0].(map[string]interface{})["name"].(string)).To(Equal("socket"))
+			When("deploying s3gw-cosi/s3gw", Label("COSI"), func() {
+				namespace := UniqueName("s3gw-cosi")
+				releaseName := UniqueName("s3gw")
+
+				BeforeEach(func(ctx SpecContext) {
+					Expect(CheckChartNames(releaseName, namespace)).To(Succeed())
+
+					values := helm.Values{
+						PublicDomain: suiteProperties.S3GWSystemDomain,
+						ImageTag:     "v" + suiteProperties.ImageTag,
+						UI: helm.UIValues{
+							PublicDomain: suiteProperties.S3GWSystemDomain,
+							ImageTag:     "v" + suiteProperties.ImageTag,
+						},
+						Cosi: helm.CosiValues{
+							Enabled: helm.Bool(true),
+							Driver:  helm.ImageValues{ImageTag: "v" + suiteProperties.ImageTag},
+							Sidecar: helm.ImageValues{ImageTag: "v" + suiteProperties.ImageTag},
+						},
+					}
+					Expect(values.ParseExtraArgs(suiteProperties.ChartsExtraArgs)).To(Succeed())
+
+					if RenderOnly() {
+						objs, err := renderChart(ctx, namespace, releaseName, values)
+						Expect(err).ToNot(HaveOccurred())
+						UseRenderedObjects(objs)
+						return
+					}
+
+					TestNamespace(ctx, namespace)
+					client, err := helm.New(ctx, namespace)
+					Expect(err).ToNot(HaveOccurred())
+					client.Dir = "../.."
+
+					_, err = client.Install(ctx, releaseName, chartsRoot, values, helm.WithWait())
+					Expect(err).ToNot(HaveOccurred())
+					DeferCleanup(func(ctx SpecContext) {
+						Expect(client.Uninstall(ctx, releaseName, helm.WithWait())).To(Succeed())
+					})
+				})
+
+				JustAfterEach(func(ctx SpecContext) {
+					CollectDiagnosticsOnFailure(ctx, namespace)
+				})
+
+				It("has the expected s3gw-cosi deployment static values", func(ctx SpecContext) {
+					By("getting the objectstorage-provisioner deployment", func() {
+						dJson, err := GetObject(ctx, "Deployment", namespace, releaseName+"-objectstorage-provisioner")
+						Expect(err).ToNot(HaveOccurred())
+						Expect(dJson).ToNot(BeNil())
+
+						//deployment metadata
+						Expect(dJson).To(HaveJSONPath("metadata.name", Equal(releaseName+"-objectstorage-provisioner")))
+						Expect(dJson).To(HaveJSONPath("metadata.namespace", Equal(namespace)))
+
+						//annotations
+						if !RenderOnly() {
+							// set by the deployment controller
+							Expect(dJson).To(HaveAnnotation("deployment.kubernetes.io/revision", "1"))
+						}
+						Expect(dJson).To(HaveAnnotation("meta.helm.sh/release-name", releaseName))
+						Expect(dJson).To(HaveAnnotation("meta.helm.sh/release-namespace", namespace))
+
+						//labels
+						Expect(dJson).To(HaveLabel("app.kubernetes.io/instance", releaseName))
+						Expect(dJson).To(HaveLabel("app.kubernetes.io/managed-by", "Helm"))
+						Expect(dJson).To(HaveLabel("app.kubernetes.io/name", chartName))
+						Expect(dJson).To(HaveLabel("app.kubernetes.io/version", "latest"))
+						Expect(dJson).To(HaveLabel("helm.sh/chart", chartName+"-"+suiteProperties.ChartsVer))
+
+						//replicas
+						Expect(dJson).To(HaveJSONPath("spec.replicas", BeEquivalentTo(1)))
+
+						//matching labels
+						Expect(dJson).To(HaveJSONPath("spec.selector.matchLabels", HaveKeyWithValue("app.kubernetes.io/component", "cosi")))
+						Expect(dJson).To(HaveJSONPath("spec.selector.matchLabels", HaveKeyWithValue("app.kubernetes.io/instance", releaseName)))
+						Expect(dJson).To(HaveJSONPath("spec.selector.matchLabels", HaveKeyWithValue("app.kubernetes.io/name", chartName)))
+
+						//strategy and volumes
+						Expect(dJson).To(And(expectations.COSI.Deployment(releaseName, namespace)...))
+
+						//spec template metadata labels
+						Expect(dJson).To(HaveJSONPath("spec.template", HaveLabel("app.kubernetes.io/component", "cosi")))
+						Expect(dJson).To(HaveJSONPath("spec.template", HaveLabel("app.kubernetes.io/instance", releaseName)))
+						Expect(dJson).To(HaveJSONPath("spec.template", HaveLabel("app.kubernetes.io/name", chartName)))
+
+						//cosi driver
+						Expect(dJson).To(HaveContainer(releaseName+"-cosi-driver",
+							HaveEnvFromSecret(releaseName+"-"+namespace+"-objectstorage-provisioner"),
+							HaveImage(s3gwCOSIDriverImageName+":v"+suiteProperties.ImageTag),
+							HaveJSONPath("imagePullPolicy", Equal("IfNotPresent")),
+						))
+						Expect(dJson).To(HaveContainer(releaseName+"-cosi-driver",
+							expectations.COSI.Container(releaseName, namespace)...))
+
+						//cosi sidecar
+						Expect(dJson).To(HaveJSONPath("spec.template.spec.containers[1]",
+							HaveEnvFromSecret(releaseName+"-"+namespace+"-objectstorage-provisioner"),
+							HaveImage(s3gwCOSISidecarImageName+":v"+suiteProperties.ImageTag),
+							HaveJSONPath("env[0].name", Equal("POD_NAMESPACE")),
+						))
+						Expect(dJson).To(HaveJSONPath("spec.template.spec.containers[1]",
+							expectations.COSISidecar.Container(releaseName, namespace)...))
+
+						//serviceAccount
+						Expect(dJson).To(HaveJSONPath("spec.template.spec.serviceAccount", Equal(releaseName+"-"+namespace+"-objectstorage-provisioner-sa")))
+
+						//serviceAccountName
+						Expect(dJson).To(HaveJSONPath("spec.template.spec.serviceAccountName", Equal(releaseName+"-"+namespace+"-objectstorage-provisioner-sa")))
+					})
+				})
+
+				It("matches the golden snapshots", Label("Golden"), func(ctx SpecContext) {
+					golden := newGolden("s3gw-cosi", "s3gw")
+					Expect(golden.Available()).To(Succeed())
+
+					for _, d := range []struct{ snapshot, deployment string }{
+						{"s3gw-objectstorage-provisioner", releaseName + "-objectstorage-provisioner"},
+					} {
+						res, err := KubectlResult(ctx, "get", "deployments", "-n", namespace, d.deployment, "-ojson")
+						Expect(err).ToNot(HaveOccurred(), res.Stderr)
+						Expect(res.Stdout).To(MatchGolden(golden, d.snapshot))
+					}
+				})
 			})
 		})
-	})
+	}
 })
@@ -0,0 +1,142 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package install_test
+
+import (
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	"github.com/aquarist-labs/s3gw/acceptance/helpers/helm"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// chartsMatrix holds the chart configurations installed by the matrix specs.
+var chartsMatrix = &helm.Matrix{
+	Dimensions: []helm.Dimension{
+		{Name: "cosi", Levels: []helm.Level{
+			{
+				Name:   "off",
+				Set:    []string{"cosi.enabled=false"},
+				Absent: []helm.Resource{{Kind: "Deployment", Name: "{release}-objectstorage-provisioner"}},
+			},
+			{
+				Name:    "on",
+				Set:     []string{"cosi.enabled=true"},
+				Present: []helm.Resource{{Kind: "Deployment", Name: "{release}-objectstorage-provisioner"}},
+			},
+		}},
+		{Name: "ui", Levels: []helm.Level{
+			{
+				Name:    "on",
+				Set:     []string{"ui.enabled=true"},
+				Present: []helm.Resource{{Kind: "Deployment", Name: "{release}-ui"}},
+			},
+			{
+				Name:   "off",
+				Set:    []string{"ui.enabled=false"},
+				Absent: []helm.Resource{{Kind: "Deployment", Name: "{release}-ui"}},
+			},
+		}},
+		{Name: "tls", Levels: []helm.Level{
+			{Name: "cert-manager", Set: []string{"useCertManager=true"}},
+			{Name: "none", Set: []string{"useCertManager=false"}},
+		}},
+		{Name: "storage", Levels: []helm.Level{
+			{Name: "default"},
+			{Name: "local-path", Set: []string{"storageClass.name=local-path"}},
+		}},
+		{Name: "log", Levels: []helm.Level{
+			{Name: "1", Set: []string{"logLevel=1"}},
+			{Name: "10", Set: []string{"logLevel=10"}},
+		}},
+	},
+	Present: []helm.Resource{
+		{Kind: "Deployment", Name: "{release}"},
+		{Kind: "Secret", Name: "{release}-{namespace}-creds"},
+	},
+}
+
+var _ = Describe("charts configurations", Label("Charts", "Matrix"), func() {
+	var suiteProperties *SuiteProperties
+	chartsRoot := "charts/charts/s3gw"
+
+	// an invalid mode fails every spec, the entries are the pairwise ones
+	mode, modeErr := helm.MatrixModeFromEnv()
+
+	BeforeEach(func() {
+		Expect(modeErr).ToNot(HaveOccurred())
+		UseSpecCassette()
+		AuditSpecCommands()
+
+		var err error
+		suiteProperties, err = LoadSuiteProperties(SuitePropertiesFile)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	for _, target := range SuiteClusterTargets() {
+		target := target
+
+		Context("on cluster "+target.Name, func() {
+			BeforeEach(func() {
+				UseClusterTarget(target)
+			})
+
+			DescribeTable("deploying the configuration",
+				func(ctx SpecContext, c helm.Combination, namespace, releaseName string) {
+					Expect(CheckChartNames(releaseName, namespace)).To(Succeed())
+
+					values := helm.Values{
+						PublicDomain: suiteProperties.S3GWSystemDomain,
+						ImageTag:     "v" + suiteProperties.ImageTag,
+						UI: helm.UIValues{
+							PublicDomain: suiteProperties.S3GWSystemDomain,
+							ImageTag:     "v" + suiteProperties.ImageTag,
+						},
+					}
+					c.Apply(&values)
+					Expect(values.ParseExtraArgs(suiteProperties.ChartsExtraArgs)).To(Succeed())
+
+					if RenderOnly() {
+						client := helm.NewMemory(namespace, nil)
+						client.Dir = "../.."
+						objs, err := client.Render(ctx, releaseName, chartsRoot, values)
+						Expect(err).ToNot(HaveOccurred())
+						UseRenderedObjects(objs)
+					} else {
+						TestNamespace(ctx, namespace)
+						client, err := helm.New(ctx, namespace)
+						Expect(err).ToNot(HaveOccurred())
+						client.Dir = "../.."
+
+						_, err = client.Install(ctx, releaseName, chartsRoot, values, helm.WithWait())
+						Expect(err).ToNot(HaveOccurred())
+						DeferCleanup(func(ctx SpecContext) {
+							CollectDiagnosticsOnFailure(ctx, namespace)
+							Expect(client.Uninstall(ctx, releaseName, helm.WithWait())).To(Succeed())
+						})
+					}
+
+					for _, r := range c.Present(releaseName, namespace) {
+						_, err := GetObject(ctx, r.Kind, namespace, r.Name)
+						Expect(err).ToNot(HaveOccurred(), "%s must exist", r)
+					}
+					for _, r := range c.Absent(releaseName, namespace) {
+						_, err := GetObject(ctx, r.Kind, namespace, r.Name)
+						Expect(err).To(MatchError(ErrObjectNotFound), "%s must not exist", r)
+					}
+				},
+				chartsMatrix.Entries(mode, func(c helm.Combination) []interface{} {
+					return []interface{}{UniqueName("s3gw-mx"), UniqueName("s3gw")}
+				}),
+			)
+		})
+	}
+})
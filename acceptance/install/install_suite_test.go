@@ -1,13 +1,24 @@
 package install_test
 
 import (
+	"flag"
 	"testing"
 
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
 
+func init() {
+	RegisterGoldenFlags(flag.CommandLine)
+}
+
 func TestInstall(t *testing.T) {
 	RegisterFailHandler(Fail)
+	DefaultRetryPolicy = &IdempotentRetryPolicy
 	RunSpecs(t, "Install Suite")
 }
+
+var _ = SynchronizedAfterSuite(func() {}, func(ctx SpecContext) {
+	ReportLeakedNamespaces(ctx)
+})
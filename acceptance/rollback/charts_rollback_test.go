@@ -0,0 +1,156 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollback_test
+
+import (
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	"github.com/aquarist-labs/s3gw/acceptance/helpers/helm"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("charts rollbacks", Label("Charts"), func() {
+	var suiteProperties *SuiteProperties
+	chartsRoot := "s3gw/s3gw"
+	chartName := "s3gw"
+	s3gwImageName := "quay.io/s3gw/s3gw"
+	s3gwUiImageName := "quay.io/s3gw/s3gw-ui"
+
+	BeforeEach(func() {
+		UseSpecCassette()
+		AuditSpecCommands()
+
+		var err error
+		suiteProperties, err = LoadSuiteProperties(SuitePropertiesFile, PropChartsVerPrev, PropImageTagPrev)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	for _, target := range SuiteClusterTargets() {
+		target := target
+
+		Context("on cluster "+target.Name, func() {
+			BeforeEach(func() {
+				UseClusterTarget(target)
+			})
+
+			Context("Rolling back s3gw chart [previous -> target -> previous], default installation", Label("Default"), func() {
+				namespace := UniqueName("s3gw-rb")
+				releaseName := UniqueName("s3gw")
+				var client *helm.Client
+
+				BeforeEach(func(ctx SpecContext) {
+					Expect(CheckChartNames(releaseName, namespace)).To(Succeed())
+					TestNamespace(ctx, namespace)
+
+					var err error
+					client, err = helm.New(ctx, namespace)
+					Expect(err).ToNot(HaveOccurred())
+					client.Dir = "../.."
+
+					values := helm.Values{
+						PublicDomain: suiteProperties.S3GWSystemDomain,
+						UI:           helm.UIValues{PublicDomain: suiteProperties.S3GWSystemDomain},
+					}
+					Expect(values.ParseExtraArgs(suiteProperties.ChartsPrevExtraArgs)).To(Succeed())
+
+					_, err = client.Install(ctx, releaseName, chartsRoot, values,
+						helm.WithVersion(suiteProperties.ChartsVerPrev), helm.WithWait())
+					Expect(err).ToNot(HaveOccurred())
+					DeferCleanup(func(ctx SpecContext) {
+						Expect(client.Uninstall(ctx, releaseName, helm.WithWait())).To(Succeed())
+					})
+				})
+
+				JustAfterEach(func(ctx SpecContext) {
+					CollectDiagnosticsOnFailure(ctx, namespace)
+				})
+
+				It("restores the [previous] release and keeps the data", func(ctx SpecContext) {
+					const bucket, key, content = "rollback", "written-by-previous", "s3gw rollback data"
+
+					By("writing data with the [previous] gateway", func() {
+						gw, err := GatewayOf(ctx, namespace, releaseName)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(gw.CreateBucket(ctx, bucket)).To(Succeed())
+						Expect(gw.PutObject(ctx, bucket, key, content)).To(Succeed())
+					})
+
+					By("upgrading to [target]", func() {
+						values := helm.Values{
+							PublicDomain: suiteProperties.S3GWSystemDomain,
+							UI:           helm.UIValues{PublicDomain: suiteProperties.S3GWSystemDomain},
+							StorageClass: helm.StorageClassValues{Name: "local-path"},
+						}
+						Expect(values.ParseExtraArgs(suiteProperties.ChartsExtraArgs)).To(Succeed())
+
+						_, err := client.Upgrade(ctx, releaseName, chartsRoot, values,
+							helm.WithVersion(suiteProperties.ChartsVer), helm.WithWait())
+						Expect(err).ToNot(HaveOccurred())
+					})
+
+					By("rolling back to [previous]", func() {
+						Expect(client.Rollback(ctx, releaseName, 1, helm.WithWait())).To(Succeed())
+						WaitForRollout(ctx, namespace, releaseName)
+						WaitForRollout(ctx, namespace, releaseName+"-ui")
+					})
+
+					By("checking the release history", func() {
+						history, err := client.History(ctx, releaseName)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(history).To(HaveExactElements(
+							And(
+								HaveField("Revision", 1),
+								HaveField("Status", "superseded"),
+								HaveField("Chart", chartName),
+								HaveField("ChartVersion", suiteProperties.ChartsVerPrev),
+							),
+							And(
+								HaveField("Revision", 2),
+								HaveField("Status", "superseded"),
+								HaveField("ChartVersion", suiteProperties.ChartsVer),
+							),
+							And(
+								HaveField("Revision", 3),
+								HaveField("Status", "deployed"),
+								HaveField("ChartVersion", suiteProperties.ChartsVerPrev),
+								HaveField("Description", "Rollback to 1"),
+							),
+						), "history of release %s", releaseName)
+					})
+
+					By("checking the deployments run the [previous] images", func() {
+						d, err := GetObject(ctx, "Deployment", namespace, releaseName)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(d).To(HaveAnnotation("meta.helm.sh/release-name", releaseName))
+						Expect(d).To(HaveLabel("helm.sh/chart", chartName+"-"+suiteProperties.ChartsVerPrev))
+						Expect(d).To(HaveContainer(releaseName,
+							HaveImage(s3gwImageName+":v"+suiteProperties.ImageTagPrev),
+						))
+
+						ui, err := GetObject(ctx, "Deployment", namespace, releaseName+"-ui")
+						Expect(err).ToNot(HaveOccurred())
+						Expect(ui).To(HaveLabel("helm.sh/chart", chartName+"-"+suiteProperties.ChartsVerPrev))
+						Expect(ui).To(HaveContainer("s3gw-ui",
+							HaveImage(s3gwUiImageName+":v"+suiteProperties.ImageTagPrev),
+						))
+					})
+
+					By("reading the data written before the upgrade", func() {
+						gw, err := GatewayOf(ctx, namespace, releaseName)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(gw.GetObject(ctx, bucket, key)).To(Equal(content))
+					})
+				})
+			})
+		})
+	}
+})
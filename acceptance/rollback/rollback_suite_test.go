@@ -0,0 +1,19 @@
+package rollback_test
+
+import (
+	"testing"
+
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestRollback(t *testing.T) {
+	RegisterFailHandler(Fail)
+	DefaultRetryPolicy = &IdempotentRetryPolicy
+	RunSpecs(t, "Rollback Suite")
+}
+
+var _ = SynchronizedAfterSuite(func() {}, func(ctx SpecContext) {
+	ReportLeakedNamespaces(ctx)
+})
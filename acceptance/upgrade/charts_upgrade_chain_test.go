@@ -0,0 +1,178 @@
+// Copyright © 2023 SUSE LLC
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upgrade_test
+
+import (
+	"fmt"
+
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	"github.com/aquarist-labs/s3gw/acceptance/helpers/helm"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("charts upgrade chains", Label("Charts", "Chain"), func() {
+	var suiteProperties *SuiteProperties
+	chartsRoot := "s3gw/s3gw"
+	chartName := "s3gw"
+	s3gwImageName := "quay.io/s3gw/s3gw"
+	s3gwUiImageName := "quay.io/s3gw/s3gw-ui"
+
+	BeforeEach(func() {
+		UseSpecCassette()
+		AuditSpecCommands()
+
+		var err error
+		suiteProperties, err = LoadSuiteProperties(SuitePropertiesFile)
+		Expect(err).ToNot(HaveOccurred())
+		if suiteProperties.UpgradeChainSpec == "" {
+			Skip(PropUpgradeChain + " is not set")
+		}
+	})
+
+	for _, target := range SuiteClusterTargets() {
+		target := target
+
+		Context("on cluster "+target.Name, func() {
+			BeforeEach(func() {
+				UseClusterTarget(target)
+			})
+
+			Context("Upgrading s3gw chart through every version of the chain, default installation", Label("Default"), func() {
+				namespace := UniqueName("s3gw-ch")
+				releaseName := UniqueName("s3gw")
+
+				BeforeEach(func(ctx SpecContext) {
+					Expect(CheckChartNames(releaseName, namespace)).To(Succeed())
+					TestNamespace(ctx, namespace)
+				})
+
+				JustAfterEach(func(ctx SpecContext) {
+					CollectDiagnosticsOnFailure(ctx, namespace)
+				})
+
+				It("keeps the release working and the data after every hop", func(ctx SpecContext) {
+					chain, err := suiteProperties.UpgradeChain()
+					Expect(err).ToNot(HaveOccurred())
+
+					// step is reported when the spec fails, naming the hop that broke
+					step := "installing " + chain[0].String()
+					DeferCleanup(func() {
+						if CurrentSpecReport().Failed() {
+							AddReportEntry("upgrade chain", "failed while "+step)
+						}
+					})
+
+					client, err := helm.New(ctx, namespace)
+					Expect(err).ToNot(HaveOccurred())
+					client.Dir = "../.."
+
+					// written holds the objects written so far, read back in order:
+					// the commands are recorded in the cassettes
+					const bucket = "chain"
+					type object struct{ key, content string }
+					var written []object
+					checkRelease := func(revision int, version ChainVersion) {
+						history, err := client.History(ctx, releaseName)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(history).To(HaveLen(revision))
+						Expect(history[revision-1]).To(And(
+							HaveField("Status", "deployed"),
+							HaveField("ChartVersion", version.ChartsVer),
+						), "release %s while %s", releaseName, step)
+
+						WaitForRollout(ctx, namespace, releaseName)
+						WaitForRollout(ctx, namespace, releaseName+"-ui")
+
+						expectations := CurrentChartExpectations
+
+						d, err := GetObject(ctx, "Deployment", namespace, releaseName)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(d).To(HaveAnnotation("meta.helm.sh/release-name", releaseName))
+						Expect(d).To(HaveLabel("helm.sh/chart", chartName+"-"+version.ChartsVer))
+						Expect(d).To(And(expectations.Gateway.Deployment(releaseName, namespace)...),
+							"s3gw deployment while %s", step)
+						Expect(d).To(HaveContainer(releaseName, append(
+							expectations.Gateway.Container(releaseName, namespace),
+							HaveImage(s3gwImageName+":v"+version.ImageTag),
+							HaveEnvFromSecret(releaseName+"-"+namespace+"-creds"),
+						)...), "s3gw deployment while %s", step)
+
+						ui, err := GetObject(ctx, "Deployment", namespace, releaseName+"-ui")
+						Expect(err).ToNot(HaveOccurred())
+						Expect(ui).To(HaveLabel("helm.sh/chart", chartName+"-"+version.ChartsVer))
+						Expect(ui).To(HaveContainer("s3gw-ui",
+							HaveImage(s3gwUiImageName+":v"+version.ImageTag),
+						), "s3gw-ui deployment while %s", step)
+
+						gw, err := GatewayOf(ctx, namespace, releaseName)
+						Expect(err).ToNot(HaveOccurred())
+						if len(written) == 0 {
+							Expect(gw.CreateBucket(ctx, bucket)).To(Succeed())
+						}
+						for _, o := range written {
+							Expect(gw.GetObject(ctx, bucket, o.key)).To(Equal(o.content),
+								"object %s while %s", o.key, step)
+						}
+						o := object{
+							key:     fmt.Sprintf("written-by-%d", revision),
+							content: "written by " + version.String(),
+						}
+						Expect(gw.PutObject(ctx, bucket, o.key, o.content)).To(Succeed())
+						written = append(written, o)
+					}
+
+					By(step, func() {
+						values := helm.Values{
+							PublicDomain: suiteProperties.S3GWSystemDomain,
+							ImageTag:     "v" + chain[0].ImageTag,
+							UI: helm.UIValues{
+								PublicDomain: suiteProperties.S3GWSystemDomain,
+								ImageTag:     "v" + chain[0].ImageTag,
+							},
+						}
+						Expect(values.ParseExtraArgs(suiteProperties.ChartsPrevExtraArgs)).To(Succeed())
+
+						_, err := client.Install(ctx, releaseName, chartsRoot, values,
+							helm.WithVersion(chain[0].ChartsVer), helm.WithWait())
+						Expect(err).ToNot(HaveOccurred())
+						DeferCleanup(func(ctx SpecContext) {
+							Expect(client.Uninstall(ctx, releaseName, helm.WithWait())).To(Succeed())
+						})
+						checkRelease(1, chain[0])
+					})
+
+					for i := 1; i < len(chain); i++ {
+						step = Hop(chain, i)
+						By(step, func() {
+							values := helm.Values{
+								PublicDomain: suiteProperties.S3GWSystemDomain,
+								ImageTag:     "v" + chain[i].ImageTag,
+								UI: helm.UIValues{
+									PublicDomain: suiteProperties.S3GWSystemDomain,
+									ImageTag:     "v" + chain[i].ImageTag,
+								},
+								StorageClass: helm.StorageClassValues{Name: "local-path"},
+							}
+							Expect(values.ParseExtraArgs(suiteProperties.ChartsExtraArgs)).To(Succeed())
+
+							_, err := client.Upgrade(ctx, releaseName, chartsRoot, values,
+								helm.WithVersion(chain[i].ChartsVer), helm.WithWait())
+							Expect(err).ToNot(HaveOccurred(), step)
+							checkRelease(i+1, chain[i])
+						})
+					}
+				})
+			})
+		})
+	}
+})
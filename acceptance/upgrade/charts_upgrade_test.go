@@ -13,276 +13,238 @@ package upgrade_test
 
 import (
 	"encoding/json"
-	"io"
-	"os"
-	"strings"
+	"strconv"
 
 	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
+	"github.com/aquarist-labs/s3gw/acceptance/helpers/helm"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("charts upgrades", Label("Charts"), func() {
-	var suiteProperties map[string]interface{}
+	var suiteProperties *SuiteProperties
+	expectations := CurrentChartExpectations
 	chartsRoot := "s3gw/s3gw"
 	chartName := "s3gw"
 	s3gwImageName := "quay.io/s3gw/s3gw"
 	s3gwUiImageName := "quay.io/s3gw/s3gw-ui"
 
 	BeforeEach(func() {
-		if suitePropertiesF, err := os.Open("../suiteProperties.json"); err == nil {
-			defer suitePropertiesF.Close()
-			byteValue, _ := io.ReadAll(suitePropertiesF)
-			err = json.Unmarshal([]byte(byteValue), &suiteProperties)
-			Expect(err).ToNot(HaveOccurred())
-		} else {
-			//make this fail
-			Expect(err).ToNot(HaveOccurred())
-			Expect(suiteProperties).ToNot(BeNil())
-		}
+		UseSpecCassette()
+		AuditSpecCommands()
+
+		var err error
+		suiteProperties, err = LoadSuiteProperties(SuitePropertiesFile, PropChartsVerPrev)
+		Expect(err).ToNot(HaveOccurred())
 	})
 
 	AfterEach(func() {
 	})
 
-	Context("Upgrading s3gw chart [previous -> target], default installation", Label("Default"), func() {
-		namespace := NanoSecName("s3gw")
-		releaseName := NanoSecName("s3gw")
-		expectedRevisionOnUpgrade := "2"
-
-		BeforeEach(func() {
-			if len(suiteProperties["RELEASE"].(string)) > 0 {
-				releaseName = suiteProperties["RELEASE"].(string)
-			}
-			if len(suiteProperties["NAMESPACE"].(string)) > 0 {
-				namespace = suiteProperties["NAMESPACE"].(string)
-			}
-			if len(suiteProperties["EXPECTED_REVISION_ON_UPGRADE"].(string)) > 0 {
-				expectedRevisionOnUpgrade = suiteProperties["EXPECTED_REVISION_ON_UPGRADE"].(string)
-			}
-
-			argsPrev := []string{"install", "--create-namespace", "-n", namespace,
-				releaseName, chartsRoot,
-				"--version", suiteProperties["CHARTS_VER_PREV"].(string),
-				"--wait",
-				"--set", "publicDomain=" + suiteProperties["S3GW_SYSTEM_DOMAIN"].(string),
-				"--set", "ui.publicDomain=" + suiteProperties["S3GW_SYSTEM_DOMAIN"].(string)}
-
-			if extraArgsPrev := suiteProperties["CHARTS_PREV_EXTRA_ARGS"].(string); len(extraArgsPrev) > 0 {
-				out, err := Run("../..", true, "helm", append(argsPrev, strings.Split(extraArgsPrev, " ")...)...)
-				Expect(err).ToNot(HaveOccurred(), out)
-			} else {
-				out, err := Run("../..", true, "helm", argsPrev...)
-				Expect(err).ToNot(HaveOccurred(), out)
-			}
-
-			argsCurr := []string{"upgrade", releaseName, "-n", namespace, chartsRoot,
-				"--version", suiteProperties["CHARTS_VER"].(string),
-				"--wait",
-				"--set", "publicDomain=" + suiteProperties["S3GW_SYSTEM_DOMAIN"].(string),
-				"--set", "ui.publicDomain=" + suiteProperties["S3GW_SYSTEM_DOMAIN"].(string),
-				"--set", "storageClass.name=local-path"}
-
-			if extraArgsCurr := suiteProperties["CHARTS_EXTRA_ARGS"].(string); len(extraArgsCurr) > 0 {
-				out, err := Run("../..", true, "helm", append(argsCurr, strings.Split(extraArgsCurr, " ")...)...)
-				Expect(err).ToNot(HaveOccurred(), out)
-			} else {
-				out, err := Run("../..", true, "helm", argsCurr...)
-				Expect(err).ToNot(HaveOccurred(), out)
-			}
-		})
-
-		AfterEach(func() {
-			out, err := Run("../..", true, "helm", "uninstall", "-n", namespace, releaseName, "--wait")
-			Expect(err).ToNot(HaveOccurred(), out)
-		})
-
-		It("deployed resources have [target] version properties", func() {
-			By("getting the s3gw deployment", func() {
-				out, err := Kubectl("get", "deployments",
-					"-n", namespace,
-					releaseName,
-					"-ojson")
-				Expect(err).ToNot(HaveOccurred())
-
-				var dJson map[string]interface{}
-				err = json.Unmarshal([]byte(out), &dJson)
-				Expect(err).ToNot(HaveOccurred())
-				Expect(dJson).ToNot(BeNil())
-
-				//deployment metadata
-				Expect(dJson["metadata"].(map[string]interface{})["name"].(string)).To(Equal(releaseName))
-				Expect(dJson["metadata"].(map[string]interface{})["namespace"].(string)).To(Equal(namespace))
-
-				//annotations
-				annotationsNode := dJson["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
-				Expect(annotationsNode["deployment.kubernetes.io/revision"].(string)).To(Equal(expectedRevisionOnUpgrade))
-				Expect(annotationsNode["meta.helm.sh/release-name"].(string)).To(Equal(releaseName))
-				Expect(annotationsNode["meta.helm.sh/release-namespace"].(string)).To(Equal(namespace))
-
-				//labels
-				labelNode := dJson["metadata"].(map[string]interface{})["labels"].(map[string]interface{})
-				Expect(labelNode["app.kubernetes.io/instance"].(string)).To(Equal(releaseName))
-				Expect(labelNode["app.kubernetes.io/managed-by"].(string)).To(Equal("Helm"))
-				Expect(labelNode["app.kubernetes.io/name"].(string)).To(Equal(chartName))
-				Expect(labelNode["app.kubernetes.io/version"].(string)).To(Equal("latest"))
-				Expect(labelNode["helm.sh/chart"].(string)).To(Equal(chartName + "-" + suiteProperties["CHARTS_VER"].(string)))
-
-				//replicas
-				Expect(dJson["spec"].(map[string]interface{})["replicas"].(float64)).To(BeEquivalentTo(1))
-
-				//matching labels
-				matchingLabelsNode := dJson["spec"].(map[string]interface{})["selector"].(map[string]interface{})["matchLabels"].(map[string]interface{})
-				Expect(matchingLabelsNode["app.kubernetes.io/component"]).To(Equal("gateway"))
-				Expect(matchingLabelsNode["app.kubernetes.io/instance"]).To(Equal(releaseName))
-				Expect(matchingLabelsNode["app.kubernetes.io/name"]).To(Equal(chartName))
-
-				//strategy
-				Expect(dJson["spec"].(map[string]interface{})["strategy"].(map[string]interface{})["type"].(string)).To(Equal("Recreate"))
-
-				//spec template metadata labels
-				specTemplateMetadataLables := dJson["spec"].(map[string]interface{})["template"].(map[string]interface{})["metadata"].(map[string]interface{})["labels"].(map[string]interface{})
-				Expect(specTemplateMetadataLables["app.kubernetes.io/component"]).To(Equal("gateway"))
-				Expect(specTemplateMetadataLables["app.kubernetes.io/instance"]).To(Equal(releaseName))
-				Expect(specTemplateMetadataLables["app.kubernetes.io/name"]).To(Equal(chartName))
-
-				//containers
-				containersNode := dJson["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})
-
-				cnt0Node := containersNode[0].(map[string]interface{})
-				cnt0ArgsNode := cnt0Node["args"].([]interface{})
-
-				//radosgw args
-				Expect(cnt0ArgsNode[0].(string)).To(Equal("--rgw-dns-name"))
+	for _, target := range SuiteClusterTargets() {
+		target := target
 
-				pubDNSName := releaseName + "-" + namespace + "." + suiteProperties["S3GW_SYSTEM_DOMAIN"].(string)
-				Expect(strings.Split(cnt0ArgsNode[1].(string), ", ")[0]).To(BeEquivalentTo(pubDNSName))
-
-				privDNSName := releaseName + "-" + namespace + "." + namespace + ".svc.cluster.local"
-				Expect(strings.Split(cnt0ArgsNode[1].(string), ", ")[1]).To(BeEquivalentTo(privDNSName))
-
-				Expect(cnt0ArgsNode[2].(string)).To(Equal("--rgw-backend-store"))
-				Expect(cnt0ArgsNode[3].(string)).To(Equal("sfs"))
-				Expect(cnt0ArgsNode[4].(string)).To(Equal("--debug-rgw"))
-				Expect(cnt0ArgsNode[5].(string)).To(Equal("1"))
-				Expect(cnt0ArgsNode[6].(string)).To(Equal("--rgw_frontends"))
-				Expect(cnt0ArgsNode[7].(string)).To(Equal("beast port=7480 ssl_port=7481 ssl_certificate=/s3gw-cluster-ip-tls/tls.crt ssl_private_key=/s3gw-cluster-ip-tls/tls.key"))
-
-				//envFrom
-				cnt0EnvFromNode := cnt0Node["envFrom"].([]interface{})
-				Expect(cnt0EnvFromNode[0].(map[string]interface{})["secretRef"].(map[string]interface{})["name"].(string)).To(Equal(releaseName + "-" + namespace + "-creds"))
-
-				//image
-				Expect(cnt0Node["image"].(string)).To(Equal(s3gwImageName + ":v" + suiteProperties["IMAGE_TAG"].(string)))
-
-				//imagePullPolicy
-				Expect(cnt0Node["imagePullPolicy"].(string)).To(Equal("IfNotPresent"))
-
-				//name
-				Expect(cnt0Node["name"].(string)).To(Equal(releaseName))
-
-				cnt0PortsNode := cnt0Node["ports"].([]interface{})
-
-				//ports
-				Expect(cnt0PortsNode[0].(map[string]interface{})["containerPort"].(float64)).To(BeEquivalentTo(7480))
-				Expect(cnt0PortsNode[0].(map[string]interface{})["name"].(string)).To(Equal("s3"))
-				Expect(cnt0PortsNode[0].(map[string]interface{})["protocol"].(string)).To(Equal("TCP"))
-
-				Expect(cnt0PortsNode[1].(map[string]interface{})["containerPort"].(float64)).To(BeEquivalentTo(7481))
-				Expect(cnt0PortsNode[1].(map[string]interface{})["name"].(string)).To(Equal("s3-tls"))
-				Expect(cnt0PortsNode[1].(map[string]interface{})["protocol"].(string)).To(Equal("TCP"))
-
-				volumeMountsNode := cnt0Node["volumeMounts"].([]interface{})
-
-				//volume mounts
-				Expect(volumeMountsNode[0].(map[string]interface{})["mountPath"].(string)).To(Equal("/data"))
-				Expect(volumeMountsNode[0].(map[string]interface{})["name"].(string)).To(Equal("s3gw-lh-store"))
-
-				Expect(volumeMountsNode[1].(map[string]interface{})["mountPath"].(string)).To(Equal("/s3gw-cluster-ip-tls"))
-				Expect(volumeMountsNode[1].(map[string]interface{})["name"].(string)).To(Equal("s3gw-cluster-ip-tls"))
-
-				//volumes
-				volumesNode := dJson["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["volumes"].([]interface{})
-
-				Expect(volumesNode[0].(map[string]interface{})["name"].(string)).To(Equal("s3gw-lh-store"))
-				Expect(volumesNode[0].(map[string]interface{})["persistentVolumeClaim"].(map[string]interface{})["claimName"]).To(Equal(releaseName + "-pvc"))
-
-				Expect(volumesNode[1].(map[string]interface{})["name"].(string)).To(Equal("s3gw-cluster-ip-tls"))
-				Expect(volumesNode[1].(map[string]interface{})["secret"].(map[string]interface{})["secretName"]).To(Equal(releaseName + "-" + namespace + "-cluster-ip-tls"))
+		Context("on cluster "+target.Name, func() {
+			BeforeEach(func() {
+				UseClusterTarget(target)
 			})
 
-			By("getting the s3gw-ui deployment", func() {
-				out, err := Kubectl("get", "deployments",
-					"-n", namespace,
-					releaseName+"-ui",
-					"-ojson")
-				Expect(err).ToNot(HaveOccurred())
-
-				var dJson map[string]interface{}
-				err = json.Unmarshal([]byte(out), &dJson)
-				Expect(err).ToNot(HaveOccurred())
-				Expect(dJson).ToNot(BeNil())
-
-				//deployment metadata
-				Expect(dJson["metadata"].(map[string]interface{})["name"].(string)).To(Equal(releaseName + "-ui"))
-				Expect(dJson["metadata"].(map[string]interface{})["namespace"].(string)).To(Equal(namespace))
-
-				//annotations
-				annotationsNode := dJson["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
-				Expect(annotationsNode["deployment.kubernetes.io/revision"].(string)).To(Equal(expectedRevisionOnUpgrade))
-				Expect(annotationsNode["meta.helm.sh/release-name"].(string)).To(Equal(releaseName))
-				Expect(annotationsNode["meta.helm.sh/release-namespace"].(string)).To(Equal(namespace))
-
-				//labels
-				labelNode := dJson["metadata"].(map[string]interface{})["labels"].(map[string]interface{})
-				Expect(labelNode["app.kubernetes.io/instance"].(string)).To(Equal(releaseName))
-				Expect(labelNode["app.kubernetes.io/managed-by"].(string)).To(Equal("Helm"))
-				Expect(labelNode["app.kubernetes.io/name"].(string)).To(Equal(chartName))
-				Expect(labelNode["app.kubernetes.io/version"].(string)).To(Equal("latest"))
-				Expect(labelNode["helm.sh/chart"].(string)).To(Equal(chartName + "-" + suiteProperties["CHARTS_VER"].(string)))
-
-				//replicas
-				Expect(dJson["spec"].(map[string]interface{})["replicas"].(float64)).To(BeEquivalentTo(1))
-
-				//matching labels
-				matchingLabelsNode := dJson["spec"].(map[string]interface{})["selector"].(map[string]interface{})["matchLabels"].(map[string]interface{})
-				Expect(matchingLabelsNode["app.kubernetes.io/component"]).To(Equal("ui"))
-				Expect(matchingLabelsNode["app.kubernetes.io/instance"]).To(Equal(releaseName))
-				Expect(matchingLabelsNode["app.kubernetes.io/name"]).To(Equal(chartName))
-
-				//strategy
-				Expect(dJson["spec"].(map[string]interface{})["strategy"].(map[string]interface{})["type"].(string)).To(Equal("RollingUpdate"))
-
-				//spec template metadata labels
-				specTemplateMetadataLables := dJson["spec"].(map[string]interface{})["template"].(map[string]interface{})["metadata"].(map[string]interface{})["labels"].(map[string]interface{})
-				Expect(specTemplateMetadataLables["app.kubernetes.io/component"]).To(Equal("ui"))
-				Expect(specTemplateMetadataLables["app.kubernetes.io/instance"]).To(Equal(releaseName))
-				Expect(specTemplateMetadataLables["app.kubernetes.io/name"]).To(Equal(chartName))
-
-				//containers
-				containersNode := dJson["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})
-				cnt0Node := containersNode[0].(map[string]interface{})
-
-				//envFrom
-				cnt0EnvFromNode := cnt0Node["envFrom"].([]interface{})
-				Expect(cnt0EnvFromNode[0].(map[string]interface{})["configMapRef"].(map[string]interface{})["name"].(string)).To(Equal(releaseName + "-" + namespace + "-config"))
-				Expect(cnt0EnvFromNode[1].(map[string]interface{})["secretRef"].(map[string]interface{})["name"].(string)).To(Equal(releaseName + "-" + namespace + "-creds"))
-
-				//image
-				Expect(cnt0Node["image"].(string)).To(Equal(s3gwUiImageName + ":v" + suiteProperties["IMAGE_TAG"].(string)))
-
-				//imagePullPolicy
-				Expect(cnt0Node["imagePullPolicy"].(string)).To(Equal("IfNotPresent"))
-
-				//name
-				Expect(cnt0Node["name"].(string)).To(Equal("s3gw-ui"))
-
-				cnt0PortsNode := cnt0Node["ports"].([]interface{})
-
-				//ports
-				Expect(cnt0PortsNode[0].(map[string]interface{})["containerPort"].(float64)).To(BeEquivalentTo(8080))
-				Expect(cnt0PortsNode[0].(map[string]interface{})["protocol"].(string)).To(Equal("TCP"))
+			Context("Upgrading s3gw chart [previous -> target], default installation", Label("Default"), func() {
+				namespace := UniqueName("s3gw")
+				releaseName := UniqueName("s3gw")
+				// expectedRevisions are the revisions of the deployments after
+				// the upgrade, by name
+				var expectedRevisions map[string]ExpectedRevision
+
+				BeforeEach(func(ctx SpecContext) {
+					if len(suiteProperties.Release) > 0 {
+						releaseName = suiteProperties.Release
+					}
+					if len(suiteProperties.Namespace) > 0 {
+						namespace = suiteProperties.Namespace
+					}
+					Expect(CheckChartNames(releaseName, namespace)).To(Succeed())
+					if len(suiteProperties.Namespace) == 0 {
+						TestNamespace(ctx, namespace)
+					}
+					client, err := helm.New(ctx, namespace)
+					Expect(err).ToNot(HaveOccurred())
+					client.Dir = "../.."
+
+					valuesPrev := helm.Values{
+						PublicDomain: suiteProperties.S3GWSystemDomain,
+						UI:           helm.UIValues{PublicDomain: suiteProperties.S3GWSystemDomain},
+					}
+					Expect(valuesPrev.ParseExtraArgs(suiteProperties.ChartsPrevExtraArgs)).To(Succeed())
+
+					_, err = client.Install(ctx, releaseName, chartsRoot, valuesPrev,
+						helm.WithVersion(suiteProperties.ChartsVerPrev), helm.WithCreateNamespace(), helm.WithWait())
+					Expect(err).ToNot(HaveOccurred())
+					DeferCleanup(func(ctx SpecContext) {
+						Expect(client.Uninstall(ctx, releaseName, helm.WithWait())).To(Succeed())
+					})
+
+					valuesCurr := helm.Values{
+						PublicDomain: suiteProperties.S3GWSystemDomain,
+						UI:           helm.UIValues{PublicDomain: suiteProperties.S3GWSystemDomain},
+						StorageClass: helm.StorageClassValues{Name: "local-path"},
+					}
+					Expect(valuesCurr.ParseExtraArgs(suiteProperties.ChartsExtraArgs)).To(Succeed())
+
+					// the deployments roll out a new revision only if the
+					// upgrade changes their pod template, rendered with the
+					// capabilities of the cluster
+					prevObjs, err := client.Render(ctx, releaseName, chartsRoot, valuesPrev,
+						helm.WithVersion(suiteProperties.ChartsVerPrev))
+					Expect(err).ToNot(HaveOccurred())
+					currObjs, err := client.Render(ctx, releaseName, chartsRoot, valuesCurr,
+						helm.WithVersion(suiteProperties.ChartsVer))
+					Expect(err).ToNot(HaveOccurred())
+
+					expectedRevisions = map[string]ExpectedRevision{}
+					for _, name := range []string{releaseName, releaseName + "-ui"} {
+						before, err := GetDeploymentRevision(ctx, namespace, name)
+						Expect(err).ToNot(HaveOccurred())
+						prev, err := FindObject(prevObjs, "Deployment", namespace, name)
+						Expect(err).ToNot(HaveOccurred())
+						curr, err := FindObject(currObjs, "Deployment", namespace, name)
+						Expect(err).ToNot(HaveOccurred())
+						changed, err := PodTemplateChanged(prev, curr)
+						Expect(err).ToNot(HaveOccurred())
+						expectedRevisions[name] = ExpectedRevision{Before: *before, TemplateChanged: changed}
+					}
+
+					_, err = client.Upgrade(ctx, releaseName, chartsRoot, valuesCurr,
+						helm.WithVersion(suiteProperties.ChartsVer), helm.WithWait())
+					Expect(err).ToNot(HaveOccurred())
+				})
+
+				JustAfterEach(func(ctx SpecContext) {
+					CollectDiagnosticsOnFailure(ctx, namespace)
+				})
+
+				It("deployed resources have [target] version properties", func(ctx SpecContext) {
+					By("getting the s3gw deployment", func() {
+						res, err := KubectlResult(ctx, "get", "deployments",
+							"-n", namespace,
+							releaseName,
+							"-ojson")
+						Expect(err).ToNot(HaveOccurred(), res.Stderr)
+
+						var dJson map[string]interface{}
+						err = json.Unmarshal([]byte(res.Stdout), &dJson)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(dJson).ToNot(BeNil())
+
+						//deployment metadata
+						Expect(dJson).To(HaveJSONPath("metadata.name", Equal(releaseName)))
+						Expect(dJson).To(HaveJSONPath("metadata.namespace", Equal(namespace)))
+
+						//annotations
+						expected := expectedRevisions[releaseName]
+						Expect(dJson).To(HaveAnnotation(RevisionAnnotation, strconv.Itoa(expected.Revision())), expected.String())
+						after, err := GetDeploymentRevision(ctx, namespace, releaseName)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(expected.Check(after)).To(Succeed())
+						Expect(dJson).To(HaveAnnotation("meta.helm.sh/release-name", releaseName))
+						Expect(dJson).To(HaveAnnotation("meta.helm.sh/release-namespace", namespace))
+
+						//labels
+						Expect(dJson).To(HaveLabel("app.kubernetes.io/instance", releaseName))
+						Expect(dJson).To(HaveLabel("app.kubernetes.io/managed-by", "Helm"))
+						Expect(dJson).To(HaveLabel("app.kubernetes.io/name", chartName))
+						Expect(dJson).To(HaveLabel("app.kubernetes.io/version", "latest"))
+						Expect(dJson).To(HaveLabel("helm.sh/chart", chartName+"-"+suiteProperties.ChartsVer))
+
+						//replicas
+						Expect(dJson).To(HaveJSONPath("spec.replicas", BeEquivalentTo(1)))
+
+						//matching labels
+						Expect(dJson).To(HaveJSONPath("spec.selector.matchLabels", HaveKeyWithValue("app.kubernetes.io/component", "gateway")))
+						Expect(dJson).To(HaveJSONPath("spec.selector.matchLabels", HaveKeyWithValue("app.kubernetes.io/instance", releaseName)))
+						Expect(dJson).To(HaveJSONPath("spec.selector.matchLabels", HaveKeyWithValue("app.kubernetes.io/name", chartName)))
+
+						//strategy and volumes
+						Expect(dJson).To(And(expectations.Gateway.Deployment(releaseName, namespace)...))
+
+						//spec template metadata labels
+						Expect(dJson).To(HaveJSONPath("spec.template", HaveLabel("app.kubernetes.io/component", "gateway")))
+						Expect(dJson).To(HaveJSONPath("spec.template", HaveLabel("app.kubernetes.io/instance", releaseName)))
+						Expect(dJson).To(HaveJSONPath("spec.template", HaveLabel("app.kubernetes.io/name", chartName)))
+
+						//radosgw
+						pubDNSName := releaseName + "-" + namespace + "." + suiteProperties.S3GWSystemDomain
+						privDNSName := releaseName + "-" + namespace + "." + namespace + ".svc.cluster.local"
+						Expect(dJson).To(HaveContainer(releaseName,
+							HaveArgs("--rgw-dns-name", HavePrefix(pubDNSName+", "+privDNSName)),
+							HaveEnvFromSecret(releaseName+"-"+namespace+"-creds"),
+							HaveImage(s3gwImageName+":v"+suiteProperties.ImageTag),
+							HaveJSONPath("imagePullPolicy", Equal("IfNotPresent")),
+						))
+						Expect(dJson).To(HaveContainer(releaseName,
+							expectations.Gateway.Container(releaseName, namespace)...))
+					})
+
+					By("getting the s3gw-ui deployment", func() {
+						res, err := KubectlResult(ctx, "get", "deployments",
+							"-n", namespace,
+							releaseName+"-ui",
+							"-ojson")
+						Expect(err).ToNot(HaveOccurred(), res.Stderr)
+
+						var dJson map[string]interface{}
+						err = json.Unmarshal([]byte(res.Stdout), &dJson)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(dJson).ToNot(BeNil())
+
+						//deployment metadata
+						Expect(dJson).To(HaveJSONPath("metadata.name", Equal(releaseName+"-ui")))
+						Expect(dJson).To(HaveJSONPath("metadata.namespace", Equal(namespace)))
+
+						//annotations
+						expected := expectedRevisions[releaseName+"-ui"]
+						Expect(dJson).To(HaveAnnotation(RevisionAnnotation, strconv.Itoa(expected.Revision())), expected.String())
+						after, err := GetDeploymentRevision(ctx, namespace, releaseName+"-ui")
+						Expect(err).ToNot(HaveOccurred())
+						Expect(expected.Check(after)).To(Succeed())
+						Expect(dJson).To(HaveAnnotation("meta.helm.sh/release-name", releaseName))
+						Expect(dJson).To(HaveAnnotation("meta.helm.sh/release-namespace", namespace))
+
+						//labels
+						Expect(dJson).To(HaveLabel("app.kubernetes.io/instance", releaseName))
+						Expect(dJson).To(HaveLabel("app.kubernetes.io/managed-by", "Helm"))
+						Expect(dJson).To(HaveLabel("app.kubernetes.io/name", chartName))
+						Expect(dJson).To(HaveLabel("app.kubernetes.io/version", "latest"))
+						Expect(dJson).To(HaveLabel("helm.sh/chart", chartName+"-"+suiteProperties.ChartsVer))
+
+						//replicas
+						Expect(dJson).To(HaveJSONPath("spec.replicas", BeEquivalentTo(1)))
+
+						//matching labels
+						Expect(dJson).To(HaveJSONPath("spec.selector.matchLabels", HaveKeyWithValue("app.kubernetes.io/component", "ui")))
+						Expect(dJson).To(HaveJSONPath("spec.selector.matchLabels", HaveKeyWithValue("app.kubernetes.io/instance", releaseName)))
+						Expect(dJson).To(HaveJSONPath("spec.selector.matchLabels", HaveKeyWithValue("app.kubernetes.io/name", chartName)))
+
+						//strategy
+						Expect(dJson).To(And(expectations.UI.Deployment(releaseName, namespace)...))
+
+						//spec template metadata labels
+						Expect(dJson).To(HaveJSONPath("spec.template", HaveLabel("app.kubernetes.io/component", "ui")))
+						Expect(dJson).To(HaveJSONPath("spec.template", HaveLabel("app.kubernetes.io/instance", releaseName)))
+						Expect(dJson).To(HaveJSONPath("spec.template", HaveLabel("app.kubernetes.io/name", chartName)))
+
+						//ui
+						Expect(dJson).To(HaveContainer("s3gw-ui",
+							HaveEnvFromConfigMap(releaseName+"-"+namespace+"-config"),
+							HaveEnvFromSecret(releaseName+"-"+namespace+"-creds"),
+							HaveImage(s3gwUiImageName+":v"+suiteProperties.ImageTag),
+							HaveJSONPath("imagePullPolicy", Equal("IfNotPresent")),
+						))
+						Expect(dJson).To(HaveContainer("s3gw-ui",
+							expectations.UI.Container(releaseName, namespace)...))
+					})
+				})
 			})
 		})
-	})
+	}
 })
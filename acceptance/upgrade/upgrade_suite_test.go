@@ -3,11 +3,17 @@ package upgrade_test
 import (
 	"testing"
 
+	. "github.com/aquarist-labs/s3gw/acceptance/helpers"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
 
 func TestUpgrade(t *testing.T) {
 	RegisterFailHandler(Fail)
+	DefaultRetryPolicy = &IdempotentRetryPolicy
 	RunSpecs(t, "Upgrade Suite")
 }
+
+var _ = SynchronizedAfterSuite(func() {}, func(ctx SpecContext) {
+	ReportLeakedNamespaces(ctx)
+})
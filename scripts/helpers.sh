@@ -37,23 +37,30 @@ function dump_suite_properties {
   echo S3GW_SYSTEM_DOMAIN:$S3GW_SYSTEM_DOMAIN
   echo RELEASE:$RELEASE
   echo NAMESPACE:$NAMESPACE
-  echo EXPECTED_REVISION_ON_UPGRADE:$EXPECTED_REVISION_ON_UPGRADE
+  echo CLUSTER_KUBECONFIG:$CLUSTER_KUBECONFIG
+  echo CLUSTER_CONTEXT:$CLUSTER_CONTEXT
+  echo CLUSTER_TARGETS:$CLUSTER_TARGETS
+  echo UPGRADE_CHAIN:$UPGRADE_CHAIN
 
-  cat > acceptance/suiteProperties.json << EOF
-{
-  "CHARTS_VER_PREV": "$CHARTS_VER_PREV",
-  "CHARTS_PREV_EXTRA_ARGS": "$CHARTS_PREV_EXTRA_ARGS",
-  "CHARTS_VER": "$CHARTS_VER",
-  "CHARTS_EXTRA_ARGS": "$CHARTS_EXTRA_ARGS",
-  "IMAGE_TAG_PREV": "$IMAGE_TAG_PREV",
-  "IMAGE_TAG": "$IMAGE_TAG",
-  "S3GW_CLUSTER_IP": "$S3GW_CLUSTER_IP",
-  "S3GW_SYSTEM_DOMAIN": "$S3GW_SYSTEM_DOMAIN",
-  "RELEASE": "$RELEASE",
-  "NAMESPACE": "$NAMESPACE",
-  "EXPECTED_REVISION_ON_UPGRADE": "$EXPECTED_REVISION_ON_UPGRADE"
-}
-EOF
+  # jq escapes the quotes and backslashes of the extra args.
+  # The extra args only accept the -f/--values, --set, --set-string and
+  # --set-json helm flags, the suites reject the others, e.g. --timeout.
+  jq -n \
+    --arg CHARTS_VER_PREV "$CHARTS_VER_PREV" \
+    --arg CHARTS_PREV_EXTRA_ARGS "$CHARTS_PREV_EXTRA_ARGS" \
+    --arg CHARTS_VER "$CHARTS_VER" \
+    --arg CHARTS_EXTRA_ARGS "$CHARTS_EXTRA_ARGS" \
+    --arg IMAGE_TAG_PREV "$IMAGE_TAG_PREV" \
+    --arg IMAGE_TAG "$IMAGE_TAG" \
+    --arg S3GW_CLUSTER_IP "$S3GW_CLUSTER_IP" \
+    --arg S3GW_SYSTEM_DOMAIN "$S3GW_SYSTEM_DOMAIN" \
+    --arg RELEASE "$RELEASE" \
+    --arg NAMESPACE "$NAMESPACE" \
+    --arg CLUSTER_KUBECONFIG "$CLUSTER_KUBECONFIG" \
+    --arg CLUSTER_CONTEXT "$CLUSTER_CONTEXT" \
+    --arg CLUSTER_TARGETS "$CLUSTER_TARGETS" \
+    --arg UPGRADE_CHAIN "$UPGRADE_CHAIN" \
+    '$ARGS.named' > acceptance/suiteProperties.json
 
   echo -e "dumped suiteProperties.json"
 }